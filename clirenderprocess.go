@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"log"
+	m "n9k-modeling/modeling"
+	r "n9k-modeling/rendering"
+	s "n9k-modeling/storing"
+	t "n9k-modeling/templating"
+)
+
+func main() {
+	InputFile := flag.String("in", "00000", "file contains templated data")
+	TemplatesDir := flag.String("templates", "", "directory with <Component>.tmpl files overriding the built-in CLI templates")
+	OutputFile := flag.String("out", "", "file to write the combined change document in")
+	OutputDir := flag.String("outdir", "", "directory to write one <device>.cfg file per device in")
+	RunID := flag.String("run", "", "stored run to read the data from instead of the input file")
+	flag.Parse()
+
+	var TemplatedData m.ProcessedData
+	if *RunID != "" {
+		Store := s.OpenConfiguredReadOnly("config.json")
+		if Store == nil {
+			log.Fatalf("No store is configured to read run %v from", *RunID)
+		}
+		defer Store.Close()
+		var err error
+		TemplatedData, err = s.LoadTemplatedData(Store, s.Query{RunID: *RunID})
+		if err != nil {
+			log.Fatalf("Can't load run %v: %v", *RunID, err)
+		}
+	} else {
+		TemplatedData = t.LoadProcessedData(*InputFile)
+	}
+
+	CLITemplatesMap := r.LoadCLITemplatesMap()
+	if *TemplatesDir != "" {
+		r.LoadCLITemplateOverrides(CLITemplatesMap, TemplatedData.ServiceName, *TemplatesDir)
+	}
+
+	CLIDataDB := r.RenderTemplatedDataCLI(TemplatedData, CLITemplatesMap)
+
+	if *OutputDir != "" {
+		r.WriteCLIFiles(*OutputDir, CLIDataDB)
+	}
+	if *OutputFile != "" {
+		m.WriteDataToFile(*OutputFile, r.CLIChangeDocument(TemplatedData.ServiceName, CLIDataDB))
+	}
+}
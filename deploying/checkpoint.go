@@ -0,0 +1,153 @@
+package deploying
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+
+	m "n9k-modeling/modeling"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+const (
+	RollbackNone   = "none"
+	RollbackDevice = "device"
+	RollbackFabric = "fabric"
+)
+
+func CheckpointName(RunID string) string {
+	return "n9k-modeling-" + RunID
+}
+
+func CreateCheckpoint(hmd cu.HostMetaData, Name string, DryRun bool) error {
+	Command := "checkpoint " + Name
+	if DryRun {
+		DryRunMutex.Lock()
+		defer DryRunMutex.Unlock()
+		fmt.Printf("POST %v/ins cli_conf: %v\n", hmd.Host.URL, Command)
+		return nil
+	}
+	_, err := m.NXAPICLICall(hmd, "cli_conf", []string{Command})
+	return err
+}
+
+func RollbackCheckpoint(hmd cu.HostMetaData, Name string) error {
+	_, err := m.NXAPICLICall(hmd, "cli_conf", []string{"rollback running-config checkpoint " + Name})
+	return err
+}
+
+func NeedsRollback(Entry DeployReportEntry) bool {
+	return Entry.Status == StatusFailed || Entry.Status == StatusDeploying || (Entry.Status == StatusDeployed && !Entry.Verified)
+}
+
+func Rollback(DeployReport *DeployReport, Inventory cu.Inventory, Policy string) {
+	Failed := false
+	for _, Entry := range DeployReport.Entries {
+		Failed = Failed || NeedsRollback(Entry)
+	}
+	if !Failed {
+		return
+	}
+
+	switch Policy {
+	case RollbackDevice:
+		RollbackEntries(DeployReport, Inventory, NeedsRollback)
+	case RollbackFabric:
+		RollbackEntries(DeployReport, Inventory, func(Entry DeployReportEntry) bool { return true })
+	}
+}
+
+func RollbackDevices(DeployReport *DeployReport, Inventory cu.Inventory, Devices []string) {
+	Selected := make(map[string]bool)
+	for _, Device := range Devices {
+		Selected[Device] = true
+	}
+	RollbackEntries(DeployReport, Inventory, func(Entry DeployReportEntry) bool {
+		return len(Devices) == 0 || Selected[Entry.DeviceName]
+	})
+}
+
+func RollbackEntries(DeployReport *DeployReport, Inventory cu.Inventory, Selected func(DeployReportEntry) bool) {
+	InventoryMap := LoadInventoryMap(Inventory)
+
+	var wg sync.WaitGroup
+	for i, Entry := range DeployReport.Entries {
+		if Entry.Checkpoint == "" || Entry.RolledBack || !Selected(Entry) {
+			continue
+		}
+		if Entry.Status != StatusDeployed && Entry.Status != StatusFailed && Entry.Status != StatusDeploying {
+			continue
+		}
+		hmd, ok := InventoryMap[Entry.DeviceName]
+		if !ok {
+			log.Println("Can't roll back device, it is not in the inventory:", Entry.DeviceName)
+			continue
+		}
+		wg.Add(1)
+		go func(Entry *DeployReportEntry, hmd cu.HostMetaData) {
+			defer wg.Done()
+			if err := RollbackCheckpoint(hmd, Entry.Checkpoint); err != nil {
+				log.Println("Rollback failed on device:", Entry.DeviceName, err)
+				Entry.RollbackError = err.Error()
+				return
+			}
+			log.Println("Device rolled back to checkpoint:", Entry.DeviceName, Entry.Checkpoint)
+			Entry.RolledBack = true
+			Entry.RollbackError = ""
+		}(&DeployReport.Entries[i], hmd)
+	}
+	wg.Wait()
+}
+
+type DeploymentLog []DeployReport
+
+func LoadDeploymentLog(fileName string) DeploymentLog {
+	DeploymentLog := make(DeploymentLog, 0)
+	DeploymentLogFile, err := os.Open(fileName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+		return DeploymentLog
+	}
+	defer DeploymentLogFile.Close()
+
+	DeploymentLogFileBytes, _ := ioutil.ReadAll(DeploymentLogFile)
+
+	err = json.Unmarshal(DeploymentLogFileBytes, &DeploymentLog)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return DeploymentLog
+}
+
+func WriteDeploymentLog(fileName string, DeployReport DeployReport) {
+	DeploymentLog := LoadDeploymentLog(fileName)
+
+	Replaced := false
+	for i, v := range DeploymentLog {
+		if v.RunID == DeployReport.RunID {
+			DeploymentLog[i] = DeployReport
+			Replaced = true
+		}
+	}
+	if !Replaced {
+		DeploymentLog = append(DeploymentLog, DeployReport)
+	}
+
+	m.WriteDataToFile(fileName, m.MarshalToJSON(DeploymentLog))
+}
+
+func (DeploymentLog DeploymentLog) FindRun(RunID string) (DeployReport, bool) {
+	for _, v := range DeploymentLog {
+		if v.RunID == RunID {
+			return v, true
+		}
+	}
+	return DeployReport{}, false
+}
@@ -0,0 +1,356 @@
+package deploying
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	m "n9k-modeling/modeling"
+	r "n9k-modeling/rendering"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+const DeployDMEPath = "sys"
+
+var DryRunMutex sync.Mutex
+
+const (
+	StatusDeploying = "deploying"
+	StatusDeployed  = "deployed"
+	StatusDryRun    = "dry-run"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+type DeployOptions struct {
+	DryRun     bool
+	BatchSize  int
+	Checkpoint bool
+	RunID      string
+	Record     func(DeployReport)
+}
+
+type DeployReport struct {
+	RunID       string              `json:"RunID"`
+	Timestamp   string              `json:"Timestamp"`
+	ServiceName string              `json:"ServiceName"`
+	Entries     []DeployReportEntry `json:"Entries"`
+}
+
+type DeployReportEntry struct {
+	DeviceName    string   `json:"DeviceName"`
+	Status        string   `json:"Status"`
+	Error         string   `json:"Error,omitempty"`
+	Checkpoint    string   `json:"Checkpoint,omitempty"`
+	Verified      bool     `json:"Verified"`
+	Mismatches    []string `json:"Mismatches,omitempty"`
+	RolledBack    bool     `json:"RolledBack"`
+	RollbackError string   `json:"RollbackError,omitempty"`
+}
+
+func LoadInventoryMap(Inventory cu.Inventory) map[string]cu.HostMetaData {
+	InventoryMap := make(map[string]cu.HostMetaData)
+	for _, v := range Inventory {
+		InventoryMap[v.Host.Hostname] = v
+	}
+	return InventoryMap
+}
+
+func CheckIMData(Response map[string]interface{}) error {
+	IMData, ok := Response["imdata"].([]interface{})
+	if !ok {
+		return nil
+	}
+	for _, Item := range IMData {
+		MO, ok := Item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if Error, ok := MO["error"].(map[string]interface{}); ok {
+			Attributes, _ := Error["attributes"].(map[string]interface{})
+			return fmt.Errorf("DME error %v: %v", Attributes["code"], Attributes["text"])
+		}
+	}
+	return nil
+}
+
+func DevicePayloads(Device r.RenderedDataDBEntry) []map[string]interface{} {
+	Payloads := make([]map[string]interface{}, 0)
+	if Device.Payload != nil {
+		Payloads = append(Payloads, Device.Payload)
+	}
+	return append(Payloads, Device.Payloads...)
+}
+
+func DeployDevice(hmd cu.HostMetaData, Device r.RenderedDataDBEntry, DryRun bool) error {
+	for _, Payload := range DevicePayloads(Device) {
+		if DryRun {
+			JSONData, err := json.Marshal(Payload)
+			if err != nil {
+				return err
+			}
+			DryRunMutex.Lock()
+			fmt.Printf("POST %v/api/mo/%v.json\n%s\n", hmd.Host.URL, DeployDMEPath, string(JSONData))
+			DryRunMutex.Unlock()
+			continue
+		}
+
+		Response, err := m.NXAPIPost(hmd, DeployDMEPath, Payload)
+		if err != nil {
+			return err
+		}
+		if err := CheckIMData(Response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func DeployBatches(RenderedData r.RenderedData, BatchSize int) []r.RenderedDataDB {
+	Units := make([]r.RenderedDataDB, 0)
+	Unit := make(map[string]int)
+	for _, Device := range RenderedData.RenderedDataDB {
+		Peer := ""
+		for _, VPCPair := range RenderedData.VPCPairs {
+			if VPCPair.Devices[0] == Device.DeviceName {
+				Peer = VPCPair.Devices[1]
+			}
+			if VPCPair.Devices[1] == Device.DeviceName {
+				Peer = VPCPair.Devices[0]
+			}
+		}
+		if i, ok := Unit[Peer]; ok && Peer != "" {
+			Units[i] = append(Units[i], Device)
+			continue
+		}
+		Unit[Device.DeviceName] = len(Units)
+		Units = append(Units, r.RenderedDataDB{Device})
+	}
+
+	if BatchSize <= 0 {
+		BatchSize = len(RenderedData.RenderedDataDB)
+	}
+	Batches := make([]r.RenderedDataDB, 0)
+	Batch := make(r.RenderedDataDB, 0)
+	for _, Unit := range Units {
+		if len(Batch) > 0 && len(Batch)+len(Unit) > BatchSize {
+			Batches = append(Batches, Batch)
+			Batch = make(r.RenderedDataDB, 0)
+		}
+		Batch = append(Batch, Unit...)
+	}
+	if len(Batch) > 0 {
+		Batches = append(Batches, Batch)
+	}
+	return Batches
+}
+
+func Deploy(RenderedData r.RenderedData, Inventory cu.Inventory, DeployOptions DeployOptions) DeployReport {
+	var DeployReport DeployReport
+	DeployReport.RunID = DeployOptions.RunID
+	DeployReport.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	DeployReport.ServiceName = RenderedData.ServiceName
+
+	InventoryMap := LoadInventoryMap(Inventory)
+
+	Failed := false
+	for _, Batch := range DeployBatches(RenderedData, DeployOptions.BatchSize) {
+		Entries := make([]DeployReportEntry, len(Batch))
+
+		if Failed {
+			for i, Device := range Batch {
+				Entries[i] = DeployReportEntry{DeviceName: Device.DeviceName, Status: StatusSkipped}
+			}
+			DeployReport.Entries = append(DeployReport.Entries, Entries...)
+			continue
+		}
+
+		log.Println("Deploying batch of", len(Batch), "devices")
+
+		var wg sync.WaitGroup
+		for i, Device := range Batch {
+			Entries[i].DeviceName = Device.DeviceName
+			if _, ok := InventoryMap[Device.DeviceName]; !ok {
+				Entries[i].Status = StatusSkipped
+				Entries[i].Error = "device is not in the inventory"
+				continue
+			}
+			Entries[i].Status = StatusDeploying
+		}
+
+		if DeployOptions.Checkpoint {
+			for i, Device := range Batch {
+				if Entries[i].Status != StatusDeploying {
+					continue
+				}
+				wg.Add(1)
+				go func(Entry *DeployReportEntry, hmd cu.HostMetaData) {
+					defer wg.Done()
+					Name := CheckpointName(DeployOptions.RunID)
+					if err := CreateCheckpoint(hmd, Name, DeployOptions.DryRun); err != nil {
+						Entry.Status = StatusFailed
+						Entry.Error = "can't create checkpoint: " + err.Error()
+						return
+					}
+					if !DeployOptions.DryRun {
+						Entry.Checkpoint = Name
+					}
+				}(&Entries[i], InventoryMap[Device.DeviceName])
+			}
+			wg.Wait()
+
+			if DeployOptions.Record != nil && !DeployOptions.DryRun {
+				Pending := DeployReport
+				Pending.Entries = append(append([]DeployReportEntry{}, DeployReport.Entries...), Entries...)
+				DeployOptions.Record(Pending)
+			}
+		}
+
+		for i, Device := range Batch {
+			if Entries[i].Status != StatusDeploying {
+				continue
+			}
+			wg.Add(1)
+			go func(Entry *DeployReportEntry, hmd cu.HostMetaData, Device r.RenderedDataDBEntry) {
+				defer wg.Done()
+				if err := DeployDevice(hmd, Device, DeployOptions.DryRun); err != nil {
+					Entry.Status = StatusFailed
+					Entry.Error = err.Error()
+					return
+				}
+				if DeployOptions.DryRun {
+					Entry.Status = StatusDryRun
+				} else {
+					Entry.Status = StatusDeployed
+				}
+			}(&Entries[i], InventoryMap[Device.DeviceName], Device)
+		}
+		wg.Wait()
+
+		for _, Entry := range Entries {
+			if Entry.Status == StatusFailed {
+				log.Println("Deployment failed on device:", Entry.DeviceName, Entry.Error)
+				Failed = true
+			}
+		}
+		DeployReport.Entries = append(DeployReport.Entries, Entries...)
+	}
+
+	return DeployReport
+}
+
+func CompareDeviceData(Intended m.DeviceData, Actual m.DeviceData) []string {
+	Mismatches := make([]string, 0)
+	for Key, IntendedValue := range Intended {
+		ActualValue, ok := Actual[Key]
+		if !ok {
+			Mismatches = append(Mismatches, fmt.Sprintf("%v: missing, expected %v", Key, r.ToDMEValue(IntendedValue)))
+			continue
+		}
+		if r.ToDMEValue(IntendedValue) != r.ToDMEValue(ActualValue) {
+			Mismatches = append(Mismatches, fmt.Sprintf("%v: %v, expected %v", Key, r.ToDMEValue(ActualValue), r.ToDMEValue(IntendedValue)))
+		}
+	}
+	sort.Strings(Mismatches)
+	return Mismatches
+}
+
+func CompareServiceLayout(Intended m.ServiceLayout, Actual m.ServiceLayout) []string {
+	Mismatches := make([]string, 0)
+	ActualMap := make(map[string]bool)
+	for _, Component := range Actual {
+		ActualMap[Component.Name] = Component.Value
+	}
+	for _, Component := range Intended {
+		if ActualMap[Component.Name] != Component.Value {
+			Mismatches = append(Mismatches, fmt.Sprintf("component %v: %v, expected %v", Component.Name, ActualMap[Component.Name], Component.Value))
+		}
+	}
+	return Mismatches
+}
+
+func RemodelDeployed(md *m.MetaData, ServiceDefinition m.ServiceDefinition, srcVal interface{}, Inventory cu.Inventory, DeployReport *DeployReport) (map[string]m.DeviceData, map[string]m.ServiceLayout) {
+	InventoryMap := LoadInventoryMap(Inventory)
+	ActualData := make(map[string]m.DeviceData)
+	ActualLayout := make(map[string]m.ServiceLayout)
+
+	var DeployedInventory cu.Inventory
+	for _, Entry := range DeployReport.Entries {
+		if Entry.Status == StatusDeployed {
+			DeployedInventory = append(DeployedInventory, InventoryMap[Entry.DeviceName])
+		}
+	}
+	if len(DeployedInventory) == 0 {
+		return ActualData, ActualLayout
+	}
+
+	RawDataDB := m.CollectRawDataDB(md, DeployedInventory, "sys")
+	ProcessedData := m.ConstructProcessedData(ServiceDefinition, RawDataDB, srcVal, md.ConversionMap)
+
+	for _, v := range ProcessedData.ServiceDataDB {
+		ActualData[v.DeviceName] = v.DeviceData
+	}
+	for _, v := range ProcessedData.ServiceLayoutDB {
+		ActualLayout[v.DeviceName] = v.ServiceLayout
+	}
+	return ActualData, ActualLayout
+}
+
+func RecordVerification(DeployReport *DeployReport, ActualData map[string]m.DeviceData, Compare func(DeviceName string) []string) {
+	for i, Entry := range DeployReport.Entries {
+		if Entry.Status != StatusDeployed {
+			continue
+		}
+		if _, ok := ActualData[Entry.DeviceName]; !ok {
+			DeployReport.Entries[i].Mismatches = []string{"device was not re-collected"}
+			continue
+		}
+		Mismatches := Compare(Entry.DeviceName)
+		DeployReport.Entries[i].Mismatches = Mismatches
+		DeployReport.Entries[i].Verified = len(Mismatches) == 0
+		if len(Mismatches) > 0 {
+			log.Println("Verification failed on device:", Entry.DeviceName, Mismatches)
+		}
+	}
+}
+
+func VerifyDeployment(md *m.MetaData, ServiceDefinition m.ServiceDefinition, srcVal interface{}, TemplatedData m.ProcessedData, Inventory cu.Inventory, DeployReport *DeployReport) {
+	ActualData, ActualLayout := RemodelDeployed(md, ServiceDefinition, srcVal, Inventory, DeployReport)
+
+	IntendedData := make(map[string]m.DeviceData)
+	for _, v := range TemplatedData.ServiceDataDB {
+		IntendedData[v.DeviceName] = v.DeviceData
+	}
+	IntendedLayout := make(map[string]m.ServiceLayout)
+	for _, v := range TemplatedData.ServiceLayoutDB {
+		IntendedLayout[v.DeviceName] = v.ServiceLayout
+	}
+
+	RecordVerification(DeployReport, ActualData, func(DeviceName string) []string {
+		Mismatches := CompareDeviceData(IntendedData[DeviceName], ActualData[DeviceName])
+		return append(Mismatches, CompareServiceLayout(IntendedLayout[DeviceName], ActualLayout[DeviceName])...)
+	})
+}
+
+func VerifyRemoval(md *m.MetaData, ServiceDefinition m.ServiceDefinition, srcVal interface{}, RenderSchema r.RenderSchema, Inventory cu.Inventory, DeployReport *DeployReport) {
+	ActualData, ActualLayout := RemodelDeployed(md, ServiceDefinition, srcVal, Inventory, DeployReport)
+
+	RecordVerification(DeployReport, ActualData, func(DeviceName string) []string {
+		Mismatches := make([]string, 0)
+		for _, RemovalStep := range ServiceDefinition.ServiceRemoval {
+			if r.HasClassData(ActualData[DeviceName], RenderSchema, RemovalStep.Class) {
+				Mismatches = append(Mismatches, fmt.Sprintf("%v is left behind", RemovalStep.Class))
+			}
+		}
+		for _, Component := range ActualLayout[DeviceName] {
+			if Component.Value {
+				Mismatches = append(Mismatches, fmt.Sprintf("component %v is still present", Component.Name))
+			}
+		}
+		return Mismatches
+	})
+}
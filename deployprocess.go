@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log"
+	d "n9k-modeling/deploying"
+	m "n9k-modeling/modeling"
+	r "n9k-modeling/rendering"
+	t "n9k-modeling/templating"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+func main() {
+	srcVal := flag.String("key", "00000", "vnid to re-model the devices with after deployment")
+	ServiceDefinitionFile := flag.String("service", "00000", "service definition")
+	InventoryFile := flag.String("i", "00000", "inventory file with the devices to deploy to")
+	RenderedFile := flag.String("in", "00000", "file contains rendered DME payloads")
+	TemplatedFile := flag.String("templated", "00000", "file contains templated data to verify the deployment against")
+	OutputFile := flag.String("out", "00000", "file to write the deployment report in")
+	BatchSize := flag.Int("batch", 0, "number of devices to deploy at once, 0 deploys to all devices in one batch, vPC peers of pair-wise templated data always share a batch")
+	DryRun := flag.Bool("dry-run", false, "print the requests instead of sending them")
+	Checkpoint := flag.Bool("checkpoint", true, "create a configuration checkpoint on each device before deploying")
+	RollbackPolicy := flag.String("rollback", d.RollbackDevice, "rollback on failure: none, device (failed devices only) or fabric (every device changed in the run)")
+	Remove := flag.Bool("remove", false, "payloads remove the service, verify that nothing of it is left behind")
+	LogFile := flag.String("log", "deployments.json", "deployment log file to record the run and its checkpoints in")
+	flag.Parse()
+
+	Config, Filter, Enrich := cu.Initialize("config.json")
+	Inventory := cu.LoadInventory(*InventoryFile)
+	ServiceDefinition := m.LoadServiceDefinition(*ServiceDefinitionFile)
+	KeysMap := m.LoadKeysMap(ServiceDefinition.DMEProcessing)
+	ConversionMap := cu.CreateConversionMap()
+	MetaData := &m.MetaData{Config: Config, Filter: Filter, Enrich: Enrich, KeysMap: KeysMap, CLIMap: m.LoadCLIMap(ServiceDefinition.CLIProcessing), GNMIMap: m.LoadGNMIMap(ServiceDefinition.GNMIProcessing), PropInclude: ServiceDefinition.PropInclude, NETCONFFilter: ServiceDefinition.NETCONFFilter, ConversionMap: ConversionMap}
+
+	RenderedData := r.LoadRenderedData(*RenderedFile)
+	DeployOptions := d.DeployOptions{DryRun: *DryRun, BatchSize: *BatchSize, Checkpoint: *Checkpoint, RunID: m.NewRunID()}
+	DeployOptions.Record = func(DeployReport d.DeployReport) { d.WriteDeploymentLog(*LogFile, DeployReport) }
+	DeployReport := d.Deploy(RenderedData, Inventory, DeployOptions)
+
+	if !*DryRun {
+		if *Remove {
+			RenderSchema := r.LoadRenderSchema(ServiceDefinition, KeysMap)
+			d.VerifyRemoval(MetaData, ServiceDefinition, *srcVal, RenderSchema, Inventory, &DeployReport)
+		} else {
+			TemplatedData := t.LoadProcessedData(*TemplatedFile)
+			d.VerifyDeployment(MetaData, ServiceDefinition, *srcVal, TemplatedData, Inventory, &DeployReport)
+		}
+		d.Rollback(&DeployReport, Inventory, *RollbackPolicy)
+		d.WriteDeploymentLog(*LogFile, DeployReport)
+		log.Println("Deployment run recorded:", DeployReport.RunID)
+	}
+
+	MarshalledDeployReport := m.MarshalToJSON(DeployReport)
+	m.WriteDataToFile(*OutputFile, MarshalledDeployReport)
+}
@@ -0,0 +1,69 @@
+package diffing
+
+import (
+	"strings"
+	"time"
+
+	m "n9k-modeling/modeling"
+	s "n9k-modeling/storing"
+)
+
+type TimelineEntry struct {
+	RunID      string    `json:"RunID"`
+	Timestamp  time.Time `json:"Timestamp"`
+	DeviceName string    `json:"DeviceName"`
+	Changes    []string  `json:"Changes"`
+}
+
+func InitialSummary(ServiceLayout m.ServiceLayout) []string {
+	Components := make([]string, 0)
+	for _, Component := range ServiceLayout {
+		if Component.Value {
+			Components = append(Components, Component.Name)
+		}
+	}
+	return []string{"first seen with " + strings.Join(Components, ", ")}
+}
+
+func BuildTimeline(Store s.Store, Query s.Query) ([]TimelineEntry, error) {
+	Timeline := make([]TimelineEntry, 0)
+
+	Runs, err := Store.ListRuns(s.Query{ServiceName: Query.ServiceName, InstanceKey: Query.InstanceKey, From: Query.From, To: Query.To})
+	if err != nil {
+		return Timeline, err
+	}
+
+	var Previous m.ProcessedData
+	for i, Run := range Runs {
+		Current, err := s.LoadProcessedData(Store, s.Query{RunID: Run.RunID, DeviceName: Query.DeviceName})
+		if err != nil {
+			return Timeline, err
+		}
+
+		if i == 0 {
+			for _, v := range Current.ServiceLayoutDB {
+				Timeline = append(Timeline, TimelineEntry{RunID: Run.RunID, Timestamp: Run.Timestamp, DeviceName: v.DeviceName, Changes: InitialSummary(v.ServiceLayout)})
+			}
+		} else {
+			ServiceDiff := DiffProcessedData(Previous, Current, Runs[i-1].RunID, Run.RunID)
+			for _, DeviceDiff := range ServiceDiff.Devices {
+				Timeline = append(Timeline, TimelineEntry{RunID: Run.RunID, Timestamp: Run.Timestamp, DeviceName: DeviceDiff.DeviceName, Changes: DeviceDiff.Summary()})
+			}
+		}
+		Previous = Current
+	}
+
+	return Timeline, nil
+}
+
+func DiffRuns(Store s.Store, From string, To string, DeviceName string) (ServiceDiff, error) {
+	Old, err := s.LoadProcessedData(Store, s.Query{RunID: From, DeviceName: DeviceName})
+	if err != nil {
+		return ServiceDiff{}, err
+	}
+	New, err := s.LoadProcessedData(Store, s.Query{RunID: To, DeviceName: DeviceName})
+	if err != nil {
+		return ServiceDiff{}, err
+	}
+	return DiffProcessedData(Old, New, From, To), nil
+}
@@ -0,0 +1,78 @@
+package diffing
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	s "n9k-modeling/storing"
+)
+
+func OpenHistoryStore(t *testing.T) s.Store {
+	Store, err := s.OpenBoltStore(s.StoreConfig{Type: "bolt", Path: filepath.Join(t.TempDir(), "runs.db")})
+	if err != nil {
+		t.Fatalf("Can't open the store: %v", err)
+	}
+	t.Cleanup(func() { Store.Close() })
+
+	// The runs are saved out of order, the timeline follows their timestamps.
+	Start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, i := range []int{2, 0, 1} {
+		Run := s.NewRun([]string{"run-1", "run-2", "run-3"}[i], "inventory.json", "VNI", "10100")
+		Run.Timestamp = Start.Add(time.Duration(i) * time.Hour)
+		if err := s.SaveProcessedData(Store, Run, Snapshots[i]); err != nil {
+			t.Fatalf("Can't save %v: %v", Run.RunID, err)
+		}
+	}
+	return Store
+}
+
+func TestBuildTimeline(t *testing.T) {
+	Store := OpenHistoryStore(t)
+
+	Timeline, err := BuildTimeline(Store, s.Query{ServiceName: "VNI", InstanceKey: "10100"})
+	if err != nil {
+		t.Fatalf("Can't build the timeline: %v", err)
+	}
+	Expected := []TimelineEntry{
+		{RunID: "run-1", DeviceName: "leaf1", Changes: []string{"first seen with L2VNI, PIM"}},
+		{RunID: "run-2", DeviceName: "leaf1", Changes: []string{"AGW added"}},
+		{RunID: "run-2", DeviceName: "leaf2", Changes: []string{"device added", "L2VNI added", "vnid set to 10100"}},
+		{RunID: "run-3", DeviceName: "leaf1", Changes: []string{"PIM→IR", "rtctrlRttEntry.rtt.import changed route-target:as2-nn4:65001:10100→route-target:as2-nn4:65001:20100"}},
+	}
+	if len(Timeline) != len(Expected) {
+		t.Fatalf("Got timeline %+v, expected %+v", Timeline, Expected)
+	}
+	for i := range Expected {
+		Expected[i].Timestamp = Timeline[i].Timestamp
+		if !reflect.DeepEqual(Timeline[i], Expected[i]) {
+			t.Errorf("Got timeline entry %+v, expected %+v", Timeline[i], Expected[i])
+		}
+		if i > 0 && Timeline[i].Timestamp.Before(Timeline[i-1].Timestamp) {
+			t.Errorf("Timeline entry %v is older than the one before it", i)
+		}
+	}
+
+	Timeline, err = BuildTimeline(Store, s.Query{ServiceName: "VNI", InstanceKey: "10100", DeviceName: "leaf2"})
+	if err != nil || len(Timeline) != 1 || Timeline[0].RunID != "run-2" || !reflect.DeepEqual(Timeline[0].Changes, []string{"device added", "L2VNI added", "vnid set to 10100"}) {
+		t.Errorf("Unexpected timeline of leaf2: %+v %v", Timeline, err)
+	}
+}
+
+func TestDiffRuns(t *testing.T) {
+	Store := OpenHistoryStore(t)
+
+	ServiceDiff, err := DiffRuns(Store, "run-1", "run-3", "leaf1")
+	if err != nil {
+		t.Fatalf("Can't diff the runs: %v", err)
+	}
+	Expected := map[string][]string{"leaf1": {"AGW added", "IR added", "PIM removed", "rtctrlRttEntry.rtt.import changed route-target:as2-nn4:65001:10100→route-target:as2-nn4:65001:20100"}}
+	if Summaries := Summaries(ServiceDiff); ServiceDiff.From != "run-1" || ServiceDiff.To != "run-3" || !reflect.DeepEqual(Summaries, Expected) {
+		t.Errorf("Got changes %q from %v to %v, expected %q", Summaries, ServiceDiff.From, ServiceDiff.To, Expected)
+	}
+
+	if _, err := DiffRuns(Store, "run-1", "run-4", ""); err == nil {
+		t.Errorf("Unknown run is diffed")
+	}
+}
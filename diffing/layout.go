@@ -0,0 +1,282 @@
+package diffing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	m "n9k-modeling/modeling"
+	r "n9k-modeling/rendering"
+)
+
+type LayoutViolation struct {
+	DeviceName string `json:"DeviceName"`
+	Component  string `json:"Component"`
+	Message    string `json:"Message"`
+}
+
+func CheckLayoutConsistency(ProcessedData m.ProcessedData, ServiceConsistency m.ServiceConsistency) []LayoutViolation {
+	Violations := make([]LayoutViolation, 0)
+
+	Active := make(map[string]map[string]bool)
+	DeviceNames := make([]string, 0)
+	for _, v := range ProcessedData.ServiceLayoutDB {
+		Components := make(map[string]bool)
+		for _, Component := range v.ServiceLayout {
+			if Component.Value {
+				Components[Component.Name] = true
+			}
+		}
+		if len(Components) == 0 {
+			continue
+		}
+		Active[v.DeviceName] = Components
+		DeviceNames = append(DeviceNames, v.DeviceName)
+	}
+	sort.Strings(DeviceNames)
+
+	for _, Component := range ServiceConsistency.Uniform {
+		Present := make([]string, 0)
+		Missing := make([]string, 0)
+		for _, DeviceName := range DeviceNames {
+			if Active[DeviceName][Component] {
+				Present = append(Present, DeviceName)
+			} else {
+				Missing = append(Missing, DeviceName)
+			}
+		}
+		if len(Present) == 0 || len(Missing) == 0 {
+			continue
+		}
+		for _, DeviceName := range Missing {
+			Violations = append(Violations, LayoutViolation{DeviceName: DeviceName, Component: Component, Message: fmt.Sprintf("%v is missing, present on %v of %v devices", Component, len(Present), len(DeviceNames))})
+		}
+	}
+
+	for _, Group := range ServiceConsistency.Exclusive {
+		for _, DeviceName := range DeviceNames {
+			Present := make([]string, 0)
+			for _, Component := range Group {
+				if Active[DeviceName][Component] {
+					Present = append(Present, Component)
+				}
+			}
+			if len(Present) > 1 {
+				Violations = append(Violations, LayoutViolation{DeviceName: DeviceName, Component: strings.Join(Present, ","), Message: fmt.Sprintf("%v are mutually exclusive", strings.Join(Present, " and "))})
+			}
+		}
+	}
+
+	for _, Group := range ServiceConsistency.Requires {
+		if len(Group) < 2 {
+			continue
+		}
+		for _, DeviceName := range DeviceNames {
+			if !Active[DeviceName][Group[0]] {
+				continue
+			}
+			Missing := make([]string, 0)
+			for _, Component := range Group[1:] {
+				if !Active[DeviceName][Component] {
+					Missing = append(Missing, Component)
+				}
+			}
+			if len(Missing) > 0 {
+				Violations = append(Violations, LayoutViolation{DeviceName: DeviceName, Component: Group[0], Message: fmt.Sprintf("%v requires %v", Group[0], strings.Join(Missing, " and "))})
+			}
+		}
+	}
+
+	for _, v := range ProcessedData.ServiceLayoutDB {
+		for _, Component := range v.ServiceLayout {
+			if Component.Value && Component.Oper == "down" {
+				Violations = append(Violations, LayoutViolation{DeviceName: v.DeviceName, Component: Component.Name, Message: fmt.Sprintf("%v is configured but down", Component.Name)})
+			}
+		}
+	}
+
+	for _, PeerPair := range ServiceConsistency.PeerPairs {
+		Violations = append(Violations, CheckPeerPair(ProcessedData, PeerPair)...)
+	}
+
+	Violations = append(Violations, CheckVPCPairs(ProcessedData, Active, ServiceConsistency.PairKeys)...)
+
+	return Violations
+}
+
+func CheckVPCPairs(ProcessedData m.ProcessedData, Active map[string]map[string]bool, PairKeys []string) []LayoutViolation {
+	Violations := make([]LayoutViolation, 0)
+
+	Devices, _ := IndexProcessedData(ProcessedData)
+	for _, VPCPair := range ProcessedData.VPCPairs {
+		a, b := VPCPair.Devices[0], VPCPair.Devices[1]
+		if len(Active[a]) == 0 && len(Active[b]) == 0 {
+			continue
+		}
+
+		for _, Device := range [][2]string{{a, b}, {b, a}} {
+			Components := make([]string, 0)
+			for Component := range Active[Device[1]] {
+				if !Active[Device[0]][Component] {
+					Components = append(Components, Component)
+				}
+			}
+			sort.Strings(Components)
+			for _, Component := range Components {
+				Violations = append(Violations, LayoutViolation{DeviceName: Device[0], Component: Component, Message: fmt.Sprintf("%v is missing, present on vPC peer %v", Component, Device[1])})
+			}
+		}
+
+		for _, Key := range PairKeys {
+			aValue, aOk := Devices[a][Key]
+			bValue, bOk := Devices[b][Key]
+			if !aOk && !bOk {
+				continue
+			}
+			aText, bText := "nothing", "nothing"
+			if aOk {
+				aText = r.ToDMEValue(aValue)
+			}
+			if bOk {
+				bText = r.ToDMEValue(bValue)
+			}
+			if aText != bText {
+				Violations = append(Violations, LayoutViolation{DeviceName: a, Component: "vPC", Message: fmt.Sprintf("%v is %v here and %v on vPC peer %v", Key, aText, bText, b)})
+			}
+		}
+	}
+
+	return Violations
+}
+
+func ListValues(v interface{}) []string {
+	if v == nil {
+		return nil
+	}
+	if Values, ok := v.([]interface{}); ok {
+		Items := make([]string, 0)
+		for _, Item := range Values {
+			Items = append(Items, r.ToDMEValue(Item))
+		}
+		return Items
+	}
+	return []string{r.ToDMEValue(v)}
+}
+
+func SortedKeys(Map map[string]string) []string {
+	Keys := make([]string, 0)
+	for Key := range Map {
+		Keys = append(Keys, Key)
+	}
+	sort.Strings(Keys)
+	return Keys
+}
+
+// PeerRecords turns the session lists of a device into one record per peer
+// address, a key is left out of a record when that session doesn't have it.
+func PeerRecords(DeviceData m.DeviceData, PeerKey string, Keys []string) map[string]map[string]string {
+	Records := make(map[string]map[string]string)
+	for i, Peer := range AsList(DeviceData[PeerKey]) {
+		if Peer == nil {
+			continue
+		}
+		Record := make(map[string]string)
+		for _, Key := range Keys {
+			if Values := AsList(DeviceData[Key]); i < len(Values) && Values[i] != nil {
+				Record[Key] = r.ToDMEValue(Values[i])
+			}
+		}
+		Records[r.ToDMEValue(Peer)] = Record
+	}
+	return Records
+}
+
+func AsList(v interface{}) []interface{} {
+	if v == nil {
+		return nil
+	}
+	if Values, ok := v.([]interface{}); ok {
+		return Values
+	}
+	return []interface{}{v}
+}
+
+// LocalAddresses lists the addresses a device peers from, without the prefix
+// length an interface address carries.
+func LocalAddresses(DeviceData m.DeviceData, LocalKeys []string) []string {
+	Addresses := make([]string, 0)
+	for _, Key := range LocalKeys {
+		for _, v := range ListValues(DeviceData[Key]) {
+			Addresses = append(Addresses, strings.SplitN(v, "/", 2)[0])
+		}
+	}
+	return Addresses
+}
+
+func CheckPeerPair(ProcessedData m.ProcessedData, PeerPair m.PeerPair) []LayoutViolation {
+	Violations := make([]LayoutViolation, 0)
+
+	RecordKeys := make([]string, 0)
+	RecordKeys = append(RecordKeys, SortedKeys(PeerPair.PeerValues)...)
+	RecordKeys = append(RecordKeys, SortedKeys(PeerPair.PeerMatches)...)
+
+	Devices := make(map[string]m.DeviceData)
+	Records := make(map[string]map[string]map[string]string)
+	Locals := make(map[string]string)
+	DeviceNames := make([]string, 0)
+	for _, v := range ProcessedData.ServiceDataDB {
+		Devices[v.DeviceName] = v.DeviceData
+		Records[v.DeviceName] = PeerRecords(v.DeviceData, PeerPair.PeerKey, RecordKeys)
+		DeviceNames = append(DeviceNames, v.DeviceName)
+		for _, Local := range LocalAddresses(v.DeviceData, PeerPair.LocalKeys) {
+			Locals[Local] = v.DeviceName
+		}
+	}
+	sort.Strings(DeviceNames)
+
+	for _, DeviceName := range DeviceNames {
+		Peers := make([]string, 0)
+		for Peer := range Records[DeviceName] {
+			Peers = append(Peers, Peer)
+		}
+		sort.Strings(Peers)
+
+		for _, Peer := range Peers {
+			Record := Records[DeviceName][Peer]
+			for _, Key := range SortedKeys(PeerPair.PeerValues) {
+				if Got, ok := Record[Key]; !ok || Got != PeerPair.PeerValues[Key] {
+					if !ok {
+						Got = "nothing"
+					}
+					Violations = append(Violations, LayoutViolation{DeviceName: DeviceName, Component: PeerPair.PeerKey, Message: fmt.Sprintf("session to %v has %v %v, expected %v", Peer, Key, Got, PeerPair.PeerValues[Key])})
+				}
+			}
+
+			Remote, ok := Locals[Peer]
+			if !ok || Remote == DeviceName {
+				continue
+			}
+			RemoteData := Devices[Remote]
+			for _, Key := range SortedKeys(PeerPair.PeerMatches) {
+				Want := r.ToDMEValue(RemoteData[PeerPair.PeerMatches[Key]])
+				if Got, ok := Record[Key]; !ok || Got != Want {
+					if !ok {
+						Got = "nothing"
+					}
+					Violations = append(Violations, LayoutViolation{DeviceName: DeviceName, Component: PeerPair.PeerKey, Message: fmt.Sprintf("session to %v (%v) has %v %v, %v has %v %v", Remote, Peer, Key, Got, Remote, PeerPair.PeerMatches[Key], Want)})
+				}
+			}
+			SessionBack := false
+			for _, Local := range LocalAddresses(Devices[DeviceName], PeerPair.LocalKeys) {
+				if _, ok := Records[Remote][Local]; ok {
+					SessionBack = true
+				}
+			}
+			if !SessionBack {
+				Violations = append(Violations, LayoutViolation{DeviceName: DeviceName, Component: PeerPair.PeerKey, Message: fmt.Sprintf("peers with %v (%v) but %v has no session back", Remote, Peer, Remote)})
+			}
+		}
+	}
+
+	return Violations
+}
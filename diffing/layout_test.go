@@ -0,0 +1,54 @@
+package diffing
+
+import (
+	"testing"
+
+	m "n9k-modeling/modeling"
+)
+
+func TestCheckPeerPair(t *testing.T) {
+	PeerPair := m.PeerPair{
+		LocalKeys:   []string{"bgpDom.rtrId", "ipv4Addr.addr"},
+		PeerKey:     "bgpPeer.addr.l2vpn-evpn",
+		PeerValues:  map[string]string{"bgpPeerAf.sendComExt.l2vpn-evpn": "enabled"},
+		PeerMatches: map[string]string{"bgpPeer.asn.l2vpn-evpn": "bgpInst.asn"},
+	}
+	ProcessedData := m.ProcessedData{ServiceDataDB: m.ServiceDataDB{
+		{DeviceName: "spine1", DeviceData: m.DeviceData{
+			"bgpDom.rtrId":                    "10.0.0.1",
+			"bgpInst.asn":                     float64(65001),
+			"bgpPeer.addr.l2vpn-evpn":         []interface{}{"10.0.1.11", "10.0.0.12"},
+			"bgpPeer.asn.l2vpn-evpn":          []interface{}{"65001", "65001"},
+			"bgpPeerAf.sendComExt.l2vpn-evpn": []interface{}{nil, "enabled"},
+		}},
+		{DeviceName: "leaf1", DeviceData: m.DeviceData{
+			"bgpDom.rtrId":                    "10.0.0.11",
+			"ipv4Addr.addr":                   "10.0.1.11/32",
+			"bgpInst.asn":                     float64(65001),
+			"bgpPeer.addr.l2vpn-evpn":         []interface{}{"10.0.0.1"},
+			"bgpPeer.asn.l2vpn-evpn":          []interface{}{"65001"},
+			"bgpPeerAf.sendComExt.l2vpn-evpn": []interface{}{"enabled"},
+		}},
+		{DeviceName: "leaf2", DeviceData: m.DeviceData{
+			"bgpDom.rtrId":                    "10.0.0.12",
+			"bgpInst.asn":                     float64(65001),
+			"bgpPeer.addr.l2vpn-evpn":         []interface{}{"10.0.0.1"},
+			"bgpPeer.asn.l2vpn-evpn":          []interface{}{"65002"},
+			"bgpPeerAf.sendComExt.l2vpn-evpn": []interface{}{"enabled"},
+		}},
+	}}
+
+	Violations := CheckPeerPair(ProcessedData, PeerPair)
+	Expected := []LayoutViolation{
+		{DeviceName: "leaf2", Component: "bgpPeer.addr.l2vpn-evpn", Message: "session to spine1 (10.0.0.1) has bgpPeer.asn.l2vpn-evpn 65002, spine1 has bgpInst.asn 65001"},
+		{DeviceName: "spine1", Component: "bgpPeer.addr.l2vpn-evpn", Message: "session to 10.0.1.11 has bgpPeerAf.sendComExt.l2vpn-evpn nothing, expected enabled"},
+	}
+	if len(Violations) != len(Expected) {
+		t.Fatalf("Got violations %+v, expected %+v", Violations, Expected)
+	}
+	for i := range Expected {
+		if Violations[i] != Expected[i] {
+			t.Errorf("Got violation %+v, expected %+v", Violations[i], Expected[i])
+		}
+	}
+}
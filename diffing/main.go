@@ -0,0 +1,169 @@
+package diffing
+
+import (
+	"fmt"
+	"sort"
+
+	m "n9k-modeling/modeling"
+	r "n9k-modeling/rendering"
+)
+
+type ValueChange struct {
+	Key      string      `json:"Key"`
+	OldValue interface{} `json:"OldValue"`
+	NewValue interface{} `json:"NewValue"`
+}
+
+type DeviceDiff struct {
+	DeviceName        string        `json:"DeviceName"`
+	DeviceAdded       bool          `json:"DeviceAdded,omitempty"`
+	DeviceRemoved     bool          `json:"DeviceRemoved,omitempty"`
+	ComponentsAdded   []string      `json:"ComponentsAdded,omitempty"`
+	ComponentsRemoved []string      `json:"ComponentsRemoved,omitempty"`
+	ValueChanges      []ValueChange `json:"ValueChanges,omitempty"`
+}
+
+type ServiceDiff struct {
+	ServiceName string       `json:"ServiceName"`
+	From        string       `json:"From"`
+	To          string       `json:"To"`
+	Devices     []DeviceDiff `json:"Devices"`
+}
+
+func (d DeviceDiff) IsEmpty() bool {
+	return !d.DeviceAdded && !d.DeviceRemoved && len(d.ComponentsAdded) == 0 && len(d.ComponentsRemoved) == 0 && len(d.ValueChanges) == 0
+}
+
+func (d DeviceDiff) Summary() []string {
+	Summary := make([]string, 0)
+	if d.DeviceAdded {
+		Summary = append(Summary, "device added")
+	}
+	if d.DeviceRemoved {
+		Summary = append(Summary, "device removed")
+	}
+	if len(d.ComponentsAdded) == 1 && len(d.ComponentsRemoved) == 1 {
+		Summary = append(Summary, d.ComponentsRemoved[0]+"→"+d.ComponentsAdded[0])
+	} else {
+		for _, Component := range d.ComponentsAdded {
+			Summary = append(Summary, Component+" added")
+		}
+		for _, Component := range d.ComponentsRemoved {
+			Summary = append(Summary, Component+" removed")
+		}
+	}
+	for _, Change := range d.ValueChanges {
+		switch {
+		case Change.OldValue == nil:
+			Summary = append(Summary, fmt.Sprintf("%v set to %v", Change.Key, r.ToDMEValue(Change.NewValue)))
+		case Change.NewValue == nil:
+			Summary = append(Summary, fmt.Sprintf("%v unset, was %v", Change.Key, r.ToDMEValue(Change.OldValue)))
+		default:
+			Summary = append(Summary, fmt.Sprintf("%v changed %v→%v", Change.Key, r.ToDMEValue(Change.OldValue), r.ToDMEValue(Change.NewValue)))
+		}
+	}
+	return Summary
+}
+
+func DiffDeviceData(Old m.DeviceData, New m.DeviceData) []ValueChange {
+	Keys := make(map[string]bool)
+	for Key := range Old {
+		Keys[Key] = true
+	}
+	for Key := range New {
+		Keys[Key] = true
+	}
+	SortedKeys := make([]string, 0)
+	for Key := range Keys {
+		SortedKeys = append(SortedKeys, Key)
+	}
+	sort.Strings(SortedKeys)
+
+	ValueChanges := make([]ValueChange, 0)
+	for _, Key := range SortedKeys {
+		OldValue, InOld := Old[Key]
+		NewValue, InNew := New[Key]
+		if InOld && InNew && r.ToDMEValue(OldValue) == r.ToDMEValue(NewValue) {
+			continue
+		}
+		ValueChanges = append(ValueChanges, ValueChange{Key: Key, OldValue: OldValue, NewValue: NewValue})
+	}
+	return ValueChanges
+}
+
+func DiffServiceLayout(Old m.ServiceLayout, New m.ServiceLayout) ([]string, []string) {
+	OldMap := make(map[string]bool)
+	for _, Component := range Old {
+		OldMap[Component.Name] = Component.Value
+	}
+	NewMap := make(map[string]bool)
+	for _, Component := range New {
+		NewMap[Component.Name] = Component.Value
+	}
+
+	Added := make([]string, 0)
+	Removed := make([]string, 0)
+	for _, Component := range New {
+		if Component.Value && !OldMap[Component.Name] {
+			Added = append(Added, Component.Name)
+		}
+	}
+	for _, Component := range Old {
+		if Component.Value && !NewMap[Component.Name] {
+			Removed = append(Removed, Component.Name)
+		}
+	}
+	return Added, Removed
+}
+
+func DiffProcessedData(Old m.ProcessedData, New m.ProcessedData, From string, To string) ServiceDiff {
+	var ServiceDiff ServiceDiff
+	ServiceDiff.ServiceName = New.ServiceName
+	ServiceDiff.From = From
+	ServiceDiff.To = To
+	ServiceDiff.Devices = make([]DeviceDiff, 0)
+
+	OldData, OldLayout := IndexProcessedData(Old)
+	NewData, NewLayout := IndexProcessedData(New)
+
+	DeviceNames := make(map[string]bool)
+	for DeviceName := range OldData {
+		DeviceNames[DeviceName] = true
+	}
+	for DeviceName := range NewData {
+		DeviceNames[DeviceName] = true
+	}
+	SortedDeviceNames := make([]string, 0)
+	for DeviceName := range DeviceNames {
+		SortedDeviceNames = append(SortedDeviceNames, DeviceName)
+	}
+	sort.Strings(SortedDeviceNames)
+
+	for _, DeviceName := range SortedDeviceNames {
+		var DeviceDiff DeviceDiff
+		DeviceDiff.DeviceName = DeviceName
+		_, InOld := OldData[DeviceName]
+		_, InNew := NewData[DeviceName]
+		DeviceDiff.DeviceAdded = !InOld && InNew
+		DeviceDiff.DeviceRemoved = InOld && !InNew
+		DeviceDiff.ComponentsAdded, DeviceDiff.ComponentsRemoved = DiffServiceLayout(OldLayout[DeviceName], NewLayout[DeviceName])
+		DeviceDiff.ValueChanges = DiffDeviceData(OldData[DeviceName], NewData[DeviceName])
+		if !DeviceDiff.IsEmpty() {
+			ServiceDiff.Devices = append(ServiceDiff.Devices, DeviceDiff)
+		}
+	}
+
+	return ServiceDiff
+}
+
+func IndexProcessedData(ProcessedData m.ProcessedData) (map[string]m.DeviceData, map[string]m.ServiceLayout) {
+	Data := make(map[string]m.DeviceData)
+	for _, v := range ProcessedData.ServiceDataDB {
+		Data[v.DeviceName] = v.DeviceData
+	}
+	Layout := make(map[string]m.ServiceLayout)
+	for _, v := range ProcessedData.ServiceLayoutDB {
+		Layout[v.DeviceName] = v.ServiceLayout
+	}
+	return Data, Layout
+}
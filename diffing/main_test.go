@@ -0,0 +1,82 @@
+package diffing
+
+import (
+	"reflect"
+	"testing"
+
+	m "n9k-modeling/modeling"
+)
+
+// Snapshot is one run of VNI 10100 with the device data and enabled
+// components of each device.
+func Snapshot(Devices map[string]m.DeviceData, Layouts map[string][]string) m.ProcessedData {
+	ProcessedData := m.ProcessedData{ServiceName: "VNI"}
+	for _, DeviceName := range []string{"leaf1", "leaf2"} {
+		DeviceData, ok := Devices[DeviceName]
+		if !ok {
+			continue
+		}
+		ProcessedData.ServiceDataDB = append(ProcessedData.ServiceDataDB, m.ServiceDataDBEntry{DeviceName: DeviceName, DeviceData: DeviceData})
+		ServiceLayout := make(m.ServiceLayout, 0)
+		for _, Component := range []string{"L2VNI", "AGW", "PIM", "IR"} {
+			Enabled := false
+			for _, Name := range Layouts[DeviceName] {
+				Enabled = Enabled || Name == Component
+			}
+			ServiceLayout = append(ServiceLayout, m.ComponentBitMap{Name: Component, Value: Enabled})
+		}
+		ProcessedData.ServiceLayoutDB = append(ProcessedData.ServiceLayoutDB, m.ServiceLayoutDBEntry{DeviceName: DeviceName, ServiceLayout: ServiceLayout})
+	}
+	return ProcessedData
+}
+
+var Snapshots = []m.ProcessedData{
+	Snapshot(map[string]m.DeviceData{
+		"leaf1": {"vnid": float64(10100), "rtctrlRttEntry.rtt.import": "route-target:as2-nn4:65001:10100"},
+	}, map[string][]string{"leaf1": {"L2VNI", "PIM"}}),
+	Snapshot(map[string]m.DeviceData{
+		"leaf1": {"vnid": float64(10100), "rtctrlRttEntry.rtt.import": "route-target:as2-nn4:65001:10100"},
+		"leaf2": {"vnid": float64(10100)},
+	}, map[string][]string{"leaf1": {"L2VNI", "AGW", "PIM"}, "leaf2": {"L2VNI"}}),
+	Snapshot(map[string]m.DeviceData{
+		"leaf1": {"vnid": float64(10100), "rtctrlRttEntry.rtt.import": "route-target:as2-nn4:65001:20100"},
+		"leaf2": {"vnid": float64(10100)},
+	}, map[string][]string{"leaf1": {"L2VNI", "AGW", "IR"}, "leaf2": {"L2VNI"}}),
+}
+
+func Summaries(ServiceDiff ServiceDiff) map[string][]string {
+	Summaries := make(map[string][]string)
+	for _, DeviceDiff := range ServiceDiff.Devices {
+		Summaries[DeviceDiff.DeviceName] = DeviceDiff.Summary()
+	}
+	return Summaries
+}
+
+func TestDiffProcessedData(t *testing.T) {
+	for _, Test := range []struct {
+		Old      m.ProcessedData
+		New      m.ProcessedData
+		Expected map[string][]string
+	}{
+		{Snapshots[0], Snapshots[1], map[string][]string{
+			"leaf1": {"AGW added"},
+			"leaf2": {"device added", "L2VNI added", "vnid set to 10100"},
+		}},
+		{Snapshots[1], Snapshots[2], map[string][]string{
+			"leaf1": {"PIM→IR", "rtctrlRttEntry.rtt.import changed route-target:as2-nn4:65001:10100→route-target:as2-nn4:65001:20100"},
+		}},
+		{Snapshots[2], Snapshots[0], map[string][]string{
+			"leaf1": {"PIM added", "AGW removed", "IR removed", "rtctrlRttEntry.rtt.import changed route-target:as2-nn4:65001:20100→route-target:as2-nn4:65001:10100"},
+			"leaf2": {"device removed", "L2VNI removed", "vnid unset, was 10100"},
+		}},
+		{Snapshots[2], Snapshots[2], map[string][]string{}},
+	} {
+		ServiceDiff := DiffProcessedData(Test.Old, Test.New, "run-a", "run-b")
+		if ServiceDiff.ServiceName != "VNI" || ServiceDiff.From != "run-a" || ServiceDiff.To != "run-b" {
+			t.Errorf("Unexpected diff header: %+v", ServiceDiff)
+		}
+		if Summaries := Summaries(ServiceDiff); !reflect.DeepEqual(Summaries, Test.Expected) {
+			t.Errorf("Got changes %q, expected %q", Summaries, Test.Expected)
+		}
+	}
+}
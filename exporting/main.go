@@ -0,0 +1,245 @@
+package exporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	m "n9k-modeling/modeling"
+	s "n9k-modeling/storing"
+
+	es "github.com/elastic/go-elasticsearch"
+	esapi "github.com/elastic/go-elasticsearch/esapi"
+)
+
+const DefaultIndexPrefix = "n9k-modeling"
+
+const (
+	DMEIndexSuffix           = "-dme"
+	ServiceDataIndexSuffix   = "-servicedata"
+	ServiceLayoutIndexSuffix = "-layout"
+)
+
+const IndexTemplate = `{
+  "index_patterns": ["%v-*"],
+  "settings": {
+    "number_of_shards": 1
+  },
+  "mappings": {
+    "numeric_detection": false,
+    "date_detection": false,
+    "dynamic_templates": [
+      {
+        "strings_as_keywords": {
+          "match_mapping_type": "string",
+          "mapping": {
+            "type": "keyword"
+          }
+        }
+      }
+    ],
+    "properties": {
+      "Timestamp": {"type": "date"},
+      "RunID": {"type": "keyword"},
+      "Inventory": {"type": "keyword"},
+      "ServiceName": {"type": "keyword"},
+      "InstanceKey": {"type": "keyword"},
+      "DeviceName": {"type": "keyword"},
+      "Site": {"type": "keyword"},
+      "Chunk": {"type": "keyword"},
+      "Component": {"type": "keyword"},
+      "Value": {"type": "boolean"}
+    }
+  }
+}`
+
+func SiteFromDeviceName(DeviceName string) string {
+	if Index := strings.Index(DeviceName, "-"); Index > 0 {
+		return DeviceName[:Index]
+	}
+	return DeviceName
+}
+
+func PutIndexTemplate(esClient *es.Client, IndexPrefix string) error {
+	Request := esapi.IndicesPutTemplateRequest{
+		Name: IndexPrefix,
+		Body: strings.NewReader(fmt.Sprintf(IndexTemplate, IndexPrefix)),
+	}
+
+	res, err := Request.Do(context.Background(), esClient)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("Can't put index template %v: %v %s", IndexPrefix, res.Status(), body)
+	}
+	return nil
+}
+
+func RunFields(Run s.RunMetaData, DeviceName string) map[string]interface{} {
+	return map[string]interface{}{
+		"Timestamp":   Run.Timestamp.Format(time.RFC3339),
+		"RunID":       Run.RunID,
+		"Inventory":   Run.Inventory,
+		"ServiceName": Run.ServiceName,
+		"InstanceKey": Run.InstanceKey,
+		"DeviceName":  DeviceName,
+		"Site":        SiteFromDeviceName(DeviceName),
+	}
+}
+
+// EscapeFieldNames replaces the dots of flattened keys, Elasticsearch would
+// otherwise read "rtctrlRttEntry.rtt" as a value and "rtctrlRttEntry.rtt.export"
+// as an object under the same field and reject the document.
+func EscapeFieldNames(Data map[string]interface{}) map[string]interface{} {
+	Escaped := make(map[string]interface{})
+	for Key, Value := range Data {
+		Escaped[strings.Replace(Key, ".", "_", -1)] = Value
+	}
+	return Escaped
+}
+
+func DMEDocuments(Run s.RunMetaData, RawDataDB m.RawDataDB) []map[string]interface{} {
+	Documents := make([]map[string]interface{}, 0)
+	for _, DBEntry := range RawDataDB {
+		ChunkNames := make([]string, 0)
+		for ChunkName := range DBEntry.DMEChunkMap {
+			ChunkNames = append(ChunkNames, ChunkName)
+		}
+		sort.Strings(ChunkNames)
+
+		for _, ChunkName := range ChunkNames {
+			for _, Row := range DBEntry.DMEChunkMap[ChunkName] {
+				Document := RunFields(Run, DBEntry.DeviceName)
+				Document["Chunk"] = ChunkName
+				Document["Data"] = EscapeFieldNames(Row)
+				Documents = append(Documents, Document)
+			}
+		}
+	}
+	return Documents
+}
+
+func ServiceDataDocuments(Run s.RunMetaData, ProcessedData m.ProcessedData) []map[string]interface{} {
+	Documents := make([]map[string]interface{}, 0)
+	for _, v := range ProcessedData.ServiceDataDB {
+		Document := RunFields(Run, v.DeviceName)
+		Document["Data"] = EscapeFieldNames(v.DeviceData)
+		Documents = append(Documents, Document)
+	}
+	return Documents
+}
+
+func ServiceLayoutDocuments(Run s.RunMetaData, ProcessedData m.ProcessedData) []map[string]interface{} {
+	Documents := make([]map[string]interface{}, 0)
+	for _, v := range ProcessedData.ServiceLayoutDB {
+		for _, Component := range v.ServiceLayout {
+			Document := RunFields(Run, v.DeviceName)
+			Document["Component"] = Component.Name
+			Document["Value"] = Component.Value
+			if Component.Oper != "" {
+				Document["Oper"] = Component.Oper
+			}
+			Documents = append(Documents, Document)
+		}
+	}
+	return Documents
+}
+
+type BulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func BulkIndex(esClient *es.Client, IndexName string, Documents []map[string]interface{}) error {
+	if len(Documents) == 0 {
+		return nil
+	}
+
+	var Body bytes.Buffer
+	JSONmetaData := `{"index":{"_index":"` + IndexName + `"}}`
+	for _, Document := range Documents {
+		JSONData, err := json.Marshal(Document)
+		if err != nil {
+			return err
+		}
+		Body.WriteString(JSONmetaData + "\n")
+		Body.Write(JSONData)
+		Body.WriteString("\n")
+	}
+
+	Request := esapi.BulkRequest{
+		Index: IndexName,
+		Body:  &Body,
+	}
+
+	res, err := Request.Do(context.Background(), esClient)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return fmt.Errorf("Bulk request to %v failed: %v %s", IndexName, res.Status(), body)
+	}
+
+	var BulkResponse BulkResponse
+	if err := json.Unmarshal(body, &BulkResponse); err != nil {
+		return err
+	}
+	if BulkResponse.Errors {
+		Failed := 0
+		var FirstError error
+		for _, Item := range BulkResponse.Items {
+			for _, Result := range Item {
+				if Result.Status > 299 {
+					Failed++
+					if FirstError == nil {
+						FirstError = errors.New(Result.Error.Type + ": " + Result.Error.Reason)
+					}
+				}
+			}
+		}
+		return fmt.Errorf("%v of %v documents were not indexed in %v, first error: %v", Failed, len(Documents), IndexName, FirstError)
+	}
+
+	log.Println("Indexed", len(Documents), "documents in", IndexName)
+	return nil
+}
+
+func ExportRun(esClient *es.Client, IndexPrefix string, Run s.RunMetaData, RawDataDB m.RawDataDB, ProcessedData m.ProcessedData) error {
+	if IndexPrefix == "" {
+		IndexPrefix = DefaultIndexPrefix
+	}
+
+	if err := PutIndexTemplate(esClient, IndexPrefix); err != nil {
+		return err
+	}
+	if err := BulkIndex(esClient, IndexPrefix+DMEIndexSuffix, DMEDocuments(Run, RawDataDB)); err != nil {
+		return err
+	}
+	if err := BulkIndex(esClient, IndexPrefix+ServiceDataIndexSuffix, ServiceDataDocuments(Run, ProcessedData)); err != nil {
+		return err
+	}
+	return BulkIndex(esClient, IndexPrefix+ServiceLayoutIndexSuffix, ServiceLayoutDocuments(Run, ProcessedData))
+}
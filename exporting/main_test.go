@@ -0,0 +1,150 @@
+package exporting
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	m "n9k-modeling/modeling"
+	s "n9k-modeling/storing"
+
+	es "github.com/elastic/go-elasticsearch"
+)
+
+type BulkRequestLog struct {
+	Mutex     sync.Mutex
+	Templates []string
+	Documents map[string][]map[string]interface{}
+	Errors    []string
+}
+
+// Fail records a malformed request for the test to report, since the handler
+// runs on a server goroutine.
+func (l *BulkRequestLog) Fail(w http.ResponseWriter, Format string, Args ...interface{}) {
+	l.Errors = append(l.Errors, fmt.Sprintf(Format, Args...))
+	w.WriteHeader(http.StatusBadRequest)
+}
+
+func FakeBulkEndpoint(Log *BulkRequestLog) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Log.Mutex.Lock()
+		defer Log.Mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+
+		if strings.HasPrefix(r.URL.Path, "/_template/") {
+			Log.Templates = append(Log.Templates, strings.TrimPrefix(r.URL.Path, "/_template/"))
+			w.Write([]byte(`{"acknowledged":true}`))
+			return
+		}
+		if !strings.HasSuffix(r.URL.Path, "/_bulk") {
+			Log.Fail(w, "Unexpected request: %v %v", r.Method, r.URL.Path)
+			return
+		}
+
+		Scanner := bufio.NewScanner(r.Body)
+		Scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		Items := make([]string, 0)
+		for Scanner.Scan() {
+			var Action map[string]map[string]string
+			if err := json.Unmarshal(Scanner.Bytes(), &Action); err != nil {
+				Log.Fail(w, "Malformed bulk action: %v", err)
+				return
+			}
+			if !Scanner.Scan() {
+				Log.Fail(w, "Bulk action without a document")
+				return
+			}
+			var Document map[string]interface{}
+			if err := json.Unmarshal(Scanner.Bytes(), &Document); err != nil {
+				Log.Fail(w, "Malformed bulk document: %v", err)
+				return
+			}
+			Index := Action["index"]["_index"]
+			Log.Documents[Index] = append(Log.Documents[Index], Document)
+			Items = append(Items, `{"index":{"status":201}}`)
+		}
+		w.Write([]byte(`{"errors":false,"items":[` + strings.Join(Items, ",") + `]}`))
+	}))
+}
+
+func TestExportRun(t *testing.T) {
+	Log := &BulkRequestLog{Documents: make(map[string][]map[string]interface{})}
+	Server := FakeBulkEndpoint(Log)
+	defer Server.Close()
+
+	esClient, err := es.NewClient(es.Config{Addresses: []string{Server.URL}})
+	if err != nil {
+		t.Fatalf("Can't create client: %v", err)
+	}
+
+	Run := s.RunMetaData{RunID: "run-1", Timestamp: time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC), ServiceName: "VNI", InstanceKey: "10100"}
+	RawDataDB := m.RawDataDB{{DeviceName: "SITE1-leaf1", DMEChunkMap: m.DMEChunkMap{
+		"l2BD": {{"l2BD.id": 100, "l2BD.accEncap": "vxlan-10100"}},
+	}}}
+	ProcessedData := m.ProcessedData{
+		ServiceName: "VNI",
+		ServiceDataDB: m.ServiceDataDB{{DeviceName: "SITE1-leaf1", DeviceData: m.DeviceData{
+			"rtctrlRttEntry.rtt":        "route-target:unknown:0:0",
+			"rtctrlRttEntry.rtt.export": "route-target:unknown:0:0",
+		}}},
+		ServiceLayoutDB: m.ServiceLayoutDB{{DeviceName: "SITE1-leaf1", ServiceLayout: m.ServiceLayout{
+			{Name: "L2VNI", Value: true, Oper: "up"},
+			{Name: "AGW", Value: false},
+		}}},
+	}
+
+	err = ExportRun(esClient, "", Run, RawDataDB, ProcessedData)
+	for _, Error := range Log.Errors {
+		t.Errorf("Bulk endpoint: %v", Error)
+	}
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	if len(Log.Templates) != 1 || Log.Templates[0] != DefaultIndexPrefix {
+		t.Errorf("Unexpected index templates: %v", Log.Templates)
+	}
+
+	DMEDocuments := Log.Documents[DefaultIndexPrefix+DMEIndexSuffix]
+	if len(DMEDocuments) != 1 || DMEDocuments[0]["Chunk"] != "l2BD" || DMEDocuments[0]["Site"] != "SITE1" {
+		t.Fatalf("Unexpected DME documents: %v", DMEDocuments)
+	}
+	if Data := DMEDocuments[0]["Data"].(map[string]interface{}); Data["l2BD_accEncap"] != "vxlan-10100" {
+		t.Errorf("Unexpected DME row: %v", Data)
+	}
+
+	ServiceDataDocuments := Log.Documents[DefaultIndexPrefix+ServiceDataIndexSuffix]
+	if len(ServiceDataDocuments) != 1 {
+		t.Fatalf("Unexpected service data documents: %v", ServiceDataDocuments)
+	}
+	for Key := range ServiceDataDocuments[0]["Data"].(map[string]interface{}) {
+		if strings.Contains(Key, ".") {
+			t.Errorf("Field name is not escaped: %v", Key)
+		}
+	}
+
+	LayoutDocuments := Log.Documents[DefaultIndexPrefix+ServiceLayoutIndexSuffix]
+	if len(LayoutDocuments) != 2 || LayoutDocuments[0]["Component"] != "L2VNI" || LayoutDocuments[0]["Oper"] != "up" || LayoutDocuments[1]["Value"] != false {
+		t.Errorf("Unexpected layout documents: %v", LayoutDocuments)
+	}
+}
+
+func TestBulkIndexReportsItemErrors(t *testing.T) {
+	Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors":true,"items":[{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"object mapping conflict"}}}]}`))
+	}))
+	defer Server.Close()
+
+	esClient, _ := es.NewClient(es.Config{Addresses: []string{Server.URL}})
+	err := BulkIndex(esClient, "test", []map[string]interface{}{{"a": 1}})
+	if err == nil || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Errorf("Item error is not reported: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"log"
+	e "n9k-modeling/exporting"
+	s "n9k-modeling/storing"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+func main() {
+	RunID := flag.String("run", "00000", "stored run to export to Elasticsearch")
+	flag.Parse()
+
+	Config, _, _ := cu.Initialize("config.json")
+
+	Store := s.OpenConfiguredReadOnly("config.json")
+	if Store == nil {
+		log.Fatalf("No store is configured to read run %v from", *RunID)
+	}
+	defer Store.Close()
+
+	Run, err := s.FindRun(Store, *RunID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	RawDataDB, err := s.LoadRawDataDB(Store, s.Query{RunID: *RunID})
+	if err != nil {
+		log.Fatal(err)
+	}
+	ProcessedData, err := s.LoadProcessedData(Store, s.Query{RunID: *RunID})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	esClient, err := cu.ESConnect(Config.ESHost, Config.ESPort)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := e.ExportRun(esClient, Config.ESIndex, Run, RawDataDB, ProcessedData); err != nil {
+		log.Fatal(err)
+	}
+}
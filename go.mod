@@ -6,6 +6,11 @@ replace github.com/achelovekov/collectorutils => /Users/achelove/Go/src/github.c
 
 require (
 	github.com/achelovekov/collectorutils v0.0.0-20210401112550-6f70067e1724
-	github.com/elastic/go-elasticsearch v0.0.0 // indirect
-	go.mongodb.org/mongo-driver v1.5.1 // indirect
+	github.com/elastic/go-elasticsearch v0.0.0
+	github.com/openconfig/gnmi v0.0.0-20210707145734-c69a5df04b53
+	github.com/prometheus/client_golang v1.10.0
+	go.etcd.io/bbolt v1.3.5
+	go.mongodb.org/mongo-driver v1.5.1
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	google.golang.org/grpc v1.36.0
 )
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	df "n9k-modeling/diffing"
+	m "n9k-modeling/modeling"
+	n "n9k-modeling/notifying"
+	s "n9k-modeling/storing"
+)
+
+func ParseTime(v string) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	for _, Layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(Layout, v); err == nil {
+			return t
+		}
+	}
+	log.Fatalf("Can't parse time %v, use RFC3339 or YYYY-MM-DD", v)
+	return time.Time{}
+}
+
+func main() {
+	ServiceName := flag.String("service", "VNI", "service name to look the runs up for")
+	InstanceKey := flag.String("key", "", "service instance key, e.g. the vnid")
+	DeviceName := flag.String("device", "", "limit the history to one device")
+	From := flag.String("from", "", "list runs since this time, RFC3339 or YYYY-MM-DD")
+	To := flag.String("to", "", "list runs until this time, RFC3339 or YYYY-MM-DD")
+	RunA := flag.String("a", "", "run to diff from")
+	RunB := flag.String("b", "", "run to diff to")
+	Timeline := flag.Bool("timeline", false, "show the component changes per device across all the runs")
+	OutputFile := flag.String("out", "", "file to write the JSON result in")
+	NotifyConfigFile := flag.String("notify", "", "notification sinks to send the diff of -a and -b to")
+	flag.Parse()
+
+	Store := s.OpenConfiguredReadOnly("config.json")
+	if Store == nil {
+		log.Fatalf("No store is configured in config.json")
+	}
+	defer Store.Close()
+
+	Query := s.Query{ServiceName: *ServiceName, InstanceKey: *InstanceKey, DeviceName: *DeviceName, From: ParseTime(*From), To: ParseTime(*To)}
+
+	var Result interface{}
+	switch {
+	case *RunA != "" && *RunB != "":
+		ServiceDiff, err := df.DiffRuns(Store, *RunA, *RunB, *DeviceName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, DeviceDiff := range ServiceDiff.Devices {
+			for _, Change := range DeviceDiff.Summary() {
+				fmt.Printf("%v: %v\n", DeviceDiff.DeviceName, Change)
+			}
+		}
+		if *NotifyConfigFile != "" {
+			n.LoadNotifier(*NotifyConfigFile).Notify(n.FromServiceDiff(ServiceDiff, *InstanceKey)...)
+		}
+		Result = ServiceDiff
+	case *Timeline:
+		TimelineEntries, err := df.BuildTimeline(Store, Query)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, Entry := range TimelineEntries {
+			for _, Change := range Entry.Changes {
+				fmt.Printf("%v %v %v: %v\n", Entry.Timestamp.Format(time.RFC3339), Entry.RunID, Entry.DeviceName, Change)
+			}
+		}
+		Result = TimelineEntries
+	default:
+		Runs, err := Store.ListRuns(Query)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, Run := range Runs {
+			fmt.Printf("%v %v %v %v %v\n", Run.RunID, Run.Timestamp.Format(time.RFC3339), Run.ServiceName, Run.InstanceKey, Run.Inventory)
+		}
+		Result = Runs
+	}
+
+	if *OutputFile != "" {
+		m.WriteDataToFile(*OutputFile, m.MarshalToJSON(Result))
+	}
+}
@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const Namespace = "n9k_modeling"
+
+var Registry = prometheus.NewRegistry()
+
+const (
+	BackendNXAPI   = "nxapi"
+	BackendNETCONF = "netconf"
+	BackendGNMI    = "gnmi"
+)
+
+var (
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "device_request_duration_seconds",
+		Help:      "Device request latency per device, backend (nxapi, netconf, gnmi) and operation (login, fetch, post, cli, get-config, get).",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"device", "backend", "operation"})
+
+	ResponseBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "device_response_bytes",
+		Help:      "Device response size on the wire per device, backend and operation.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+	}, []string{"device", "backend", "operation"})
+
+	Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "errors_total",
+		Help:      "Collection and deployment errors per device and type.",
+	}, []string{"device", "type"})
+
+	CollectionLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "collection_last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful DME collection per device.",
+	}, []string{"device"})
+
+	CollectionFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "collection_consecutive_failures",
+		Help:      "Consecutive failed DME collections per device.",
+	}, []string{"device"})
+
+	FlattenedRows = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "flattened_rows",
+		Help:      "Rows flattened from the DME tree per device and chunk in the last collection.",
+	}, []string{"device", "chunk"})
+
+	InstanceDevices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "instance_devices",
+		Help:      "Devices the service instance is modeled on.",
+	}, []string{"service", "key"})
+
+	ComponentDevices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "component_devices",
+		Help:      "Devices the service component is present on per service instance.",
+	}, []string{"service", "key", "component"})
+
+	IntendedDriftDevices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "intended_drift_devices",
+		Help:      "Devices whose modeled data differs from the intended templated data.",
+	}, []string{"service", "key"})
+
+	Events = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "events_total",
+		Help:      "Change and drift events per service and type.",
+	}, []string{"service", "type"})
+)
+
+func init() {
+	Registry.MustRegister(
+		RequestDuration,
+		ResponseBytes,
+		Errors,
+		CollectionLastSuccess,
+		CollectionFailures,
+		FlattenedRows,
+		InstanceDevices,
+		ComponentDevices,
+		IntendedDriftDevices,
+		Events,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+}
+
+func ObserveRequest(DeviceName string, Backend string, Operation string, Start time.Time, Size int) {
+	RequestDuration.WithLabelValues(DeviceName, Backend, Operation).Observe(time.Since(Start).Seconds())
+	if Size >= 0 {
+		ResponseBytes.WithLabelValues(DeviceName, Backend, Operation).Observe(float64(Size))
+	}
+}
+
+func ObserveError(DeviceName string, Type string) {
+	Errors.WithLabelValues(DeviceName, Type).Inc()
+}
+
+func ObserveCollection(DeviceName string, Success bool) {
+	if Success {
+		CollectionLastSuccess.WithLabelValues(DeviceName).SetToCurrentTime()
+		CollectionFailures.WithLabelValues(DeviceName).Set(0)
+	} else {
+		CollectionFailures.WithLabelValues(DeviceName).Inc()
+	}
+}
+
+func ObserveRows(DeviceName string, Chunk string, Rows int) {
+	FlattenedRows.WithLabelValues(DeviceName, Chunk).Set(float64(Rows))
+}
+
+func ObserveInstance(ServiceName string, InstanceKey string, Devices int, Components map[string]int) {
+	InstanceDevices.WithLabelValues(ServiceName, InstanceKey).Set(float64(Devices))
+	for Component, Count := range Components {
+		ComponentDevices.WithLabelValues(ServiceName, InstanceKey, Component).Set(float64(Count))
+	}
+}
+
+func ObserveIntendedDrift(ServiceName string, InstanceKey string, Devices int) {
+	IntendedDriftDevices.WithLabelValues(ServiceName, InstanceKey).Set(float64(Devices))
+}
+
+func ObserveEvent(ServiceName string, Type string) {
+	Events.WithLabelValues(ServiceName, Type).Inc()
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+func WriteTextfile(fileName string) error {
+	return prometheus.WriteToTextfile(fileName, Registry)
+}
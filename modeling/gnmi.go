@@ -0,0 +1,373 @@
+package modeling
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	mt "n9k-modeling/metrics"
+
+	cu "github.com/achelovekov/collectorutils"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+type GNMIKeyDefinition struct {
+	Key      string                       `json:"Key"`
+	Path     string                       `json:"Path"`
+	Fields   map[string]string            `json:"Fields"`
+	ValueMap map[string]map[string]string `json:"ValueMap"`
+}
+
+type GNMIMap map[string][]GNMIKeyDefinition
+
+func LoadGNMIMap(GNMIKeysDefinition []GNMIKeyDefinition) GNMIMap {
+	GNMIMap := make(GNMIMap)
+	for _, v := range GNMIKeysDefinition {
+		GNMIMap[v.Key] = append(GNMIMap[v.Key], v)
+	}
+	return GNMIMap
+}
+
+func IsGNMIHost(hmd cu.HostMetaData) bool {
+	return strings.HasPrefix(hmd.Host.URL, "gnmi://")
+}
+
+func GNMIAddress(hmd cu.HostMetaData) (string, error) {
+	HostURL, err := url.Parse(hmd.Host.URL)
+	if err != nil {
+		return "", err
+	}
+	if HostURL.Port() == "" {
+		return net.JoinHostPort(HostURL.Hostname(), "50051"), nil
+	}
+	return HostURL.Host, nil
+}
+
+// GNMIDialTimeout bounds the connection to a device. A failed TLS handshake
+// is retried until it expires.
+var GNMIDialTimeout = 30 * time.Second
+
+// GNMITLSConfig verifies the device certificate against the system roots, or
+// against the PEM bundle of the ?ca= query. ?insecure=true skips verification.
+func GNMITLSConfig(hmd cu.HostMetaData) (*tls.Config, error) {
+	HostURL, err := url.Parse(hmd.Host.URL)
+	if err != nil {
+		return nil, err
+	}
+	Query := HostURL.Query()
+	TLSConfig := &tls.Config{}
+	if Query.Get("insecure") == "true" {
+		TLSConfig.InsecureSkipVerify = true
+		return TLSConfig, nil
+	}
+	if File := Query.Get("ca"); File != "" {
+		PEMData, err := ioutil.ReadFile(File)
+		if err != nil {
+			return nil, err
+		}
+		TLSConfig.RootCAs = x509.NewCertPool()
+		if !TLSConfig.RootCAs.AppendCertsFromPEM(PEMData) {
+			return nil, fmt.Errorf("No certificates in CA file %v", File)
+		}
+	}
+	return TLSConfig, nil
+}
+
+func GNMIDial(hmd cu.HostMetaData) (*grpc.ClientConn, error) {
+	Address, err := GNMIAddress(hmd)
+	if err != nil {
+		return nil, err
+	}
+	TLSConfig, err := GNMITLSConfig(hmd)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), GNMIDialTimeout)
+	defer cancel()
+	return grpc.DialContext(ctx, Address, grpc.WithBlock(), grpc.WithReturnConnectionError(), grpc.WithTransportCredentials(credentials.NewTLS(TLSConfig)))
+}
+
+func ParseGNMIPath(Path string) (*gpb.Path, error) {
+	GNMIPath := &gpb.Path{}
+	if Index := strings.Index(Path, ":/"); Index > 0 {
+		GNMIPath.Origin = Path[:Index]
+		Path = Path[Index+1:]
+	}
+	for _, Elem := range SplitGNMIPath(Path) {
+		PathElem := &gpb.PathElem{}
+		Index := strings.Index(Elem, "[")
+		if Index < 0 {
+			PathElem.Name = Elem
+			GNMIPath.Elem = append(GNMIPath.Elem, PathElem)
+			continue
+		}
+		PathElem.Name = Elem[:Index]
+		PathElem.Key = make(map[string]string)
+		for _, Key := range strings.Split(strings.TrimSuffix(Elem[Index+1:], "]"), "][") {
+			KeyValue := strings.SplitN(Key, "=", 2)
+			if len(KeyValue) != 2 {
+				return nil, fmt.Errorf("Malformed key %q in gNMI path %v", Key, Path)
+			}
+			PathElem.Key[KeyValue[0]] = KeyValue[1]
+		}
+		GNMIPath.Elem = append(GNMIPath.Elem, PathElem)
+	}
+	return GNMIPath, nil
+}
+
+func SplitGNMIPath(Path string) []string {
+	Elems := make([]string, 0)
+	Depth := 0
+	Start := 0
+	for i, c := range Path {
+		switch c {
+		case '[':
+			Depth++
+		case ']':
+			Depth--
+		case '/':
+			if Depth == 0 {
+				if i > Start {
+					Elems = append(Elems, Path[Start:i])
+				}
+				Start = i + 1
+			}
+		}
+	}
+	if Start < len(Path) {
+		Elems = append(Elems, Path[Start:])
+	}
+	return Elems
+}
+
+func GNMICall(Client gpb.GNMIClient, hmd cu.HostMetaData, Path string, DataType gpb.GetRequest_DataType) ([]*gpb.Notification, error) {
+	GNMIPath, err := ParseGNMIPath(Path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "username", hmd.Host.Username, "password", hmd.Host.Password)
+
+	Start := time.Now()
+	Response, err := Client.Get(ctx, &gpb.GetRequest{Path: []*gpb.Path{GNMIPath}, Encoding: gpb.Encoding_JSON_IETF, Type: DataType})
+	if err != nil {
+		return nil, err
+	}
+	mt.ObserveRequest(hmd.Host.Hostname, mt.BackendGNMI, "get", Start, proto.Size(Response))
+
+	return Response.Notification, nil
+}
+
+func GetGNMIData(md *MetaData, hmd cu.HostMetaData) (RawDataDBEntry, error) {
+	var RawDataDBEntry RawDataDBEntry
+	RawDataDBEntry.DeviceName = hmd.Host.Hostname
+	RawDataDBEntry.DMEChunkMap = make(DMEChunkMap)
+
+	Conn, err := GNMIDial(hmd)
+	if err != nil {
+		mt.ObserveError(hmd.Host.Hostname, "unreachable")
+		return RawDataDBEntry, fmt.Errorf("Can't connect to gNMI on device: %v: %v", hmd.Host.Hostname, err)
+	}
+	defer Conn.Close()
+	Client := gpb.NewGNMIClient(Conn)
+
+	MapKeys := make([]string, 0)
+	for MapKey := range md.GNMIMap {
+		MapKeys = append(MapKeys, MapKey)
+	}
+	sort.Strings(MapKeys)
+
+	DataType := gpb.GetRequest_CONFIG
+	if md.PropInclude == "all" {
+		DataType = gpb.GetRequest_ALL
+	}
+
+	for _, MapKey := range MapKeys {
+		DMEChunk := make([]map[string]interface{}, 0)
+		for _, GNMIKeyDefinition := range md.GNMIMap[MapKey] {
+			Notifications, err := GNMICall(Client, hmd, GNMIKeyDefinition.Path, DataType)
+			if err != nil {
+				mt.ObserveError(hmd.Host.Hostname, "gnmi")
+				log.Println("Can't get", GNMIKeyDefinition.Path, "from device:", hmd.Host.Hostname, err)
+				continue
+			}
+			DMEChunk = append(DMEChunk, GNMIRows(Notifications, GNMIKeyDefinition)...)
+		}
+		mt.ObserveRows(hmd.Host.Hostname, MapKey, len(DMEChunk))
+		RawDataDBEntry.DMEChunkMap[MapKey] = DMEChunk
+	}
+
+	return RawDataDBEntry, nil
+}
+
+func GNMIRows(Notifications []*gpb.Notification, GNMIKeyDefinition GNMIKeyDefinition) DMEChunk {
+	DMEChunk := make(DMEChunk, 0)
+	for _, Notification := range Notifications {
+		for _, Update := range Notification.Update {
+			PathKeys := make(map[string]string)
+			for _, Path := range []*gpb.Path{Notification.Prefix, Update.Path} {
+				for _, Elem := range Path.GetElem() {
+					for Key, Value := range Elem.Key {
+						PathKeys[Elem.Name+"["+Key+"]"] = Value
+					}
+				}
+			}
+
+			var Value interface{}
+			JSONValue := Update.Val.GetJsonIetfVal()
+			if JSONValue == nil {
+				JSONValue = Update.Val.GetJsonVal()
+			}
+			if err := json.Unmarshal(JSONValue, &Value); err != nil {
+				log.Println("Can't decode gNMI value for", GNMIKeyDefinition.Path, err)
+				continue
+			}
+
+			for _, Entry := range GNMIEntries(Value) {
+				Row := make(map[string]interface{})
+				for ChunkKey, FieldPath := range GNMIKeyDefinition.Fields {
+					FieldValue, ok := PathKeys[FieldPath]
+					var Field interface{} = FieldValue
+					if !ok {
+						Field, ok = GNMIField(Entry, FieldPath)
+					}
+					if !ok {
+						continue
+					}
+					if Mapped, ok := MapGNMIValue(Field, GNMIKeyDefinition.ValueMap[ChunkKey]); ok {
+						Row[ChunkKey] = Mapped
+					}
+				}
+				if len(Row) > 0 {
+					DMEChunk = append(DMEChunk, Row)
+				}
+			}
+		}
+	}
+	return DMEChunk
+}
+
+func GNMIEntries(Value interface{}) []map[string]interface{} {
+	Entries := make([]map[string]interface{}, 0)
+	switch Value := Value.(type) {
+	case []interface{}:
+		for _, Item := range Value {
+			if Entry, ok := Item.(map[string]interface{}); ok {
+				Entries = append(Entries, Entry)
+			}
+		}
+	case map[string]interface{}:
+		if len(Value) == 1 {
+			for _, Inner := range Value {
+				if List, ok := Inner.([]interface{}); ok {
+					return GNMIEntries(List)
+				}
+			}
+		}
+		Entries = append(Entries, Value)
+	}
+	return Entries
+}
+
+func LocalName(Name string) string {
+	if Index := strings.LastIndex(Name, ":"); Index >= 0 {
+		return Name[Index+1:]
+	}
+	return Name
+}
+
+func IdentityName(Value string) string {
+	Index := strings.Index(Value, ":")
+	if Index <= 0 || strings.Count(Value, ":") != 1 || Index == len(Value)-1 {
+		return Value
+	}
+	for i, c := range Value[:Index] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '_')) {
+			return Value
+		}
+	}
+	return Value[Index+1:]
+}
+
+func GNMIField(Entry map[string]interface{}, FieldPath string) (interface{}, bool) {
+	var Current interface{} = Entry
+	for _, Elem := range SplitGNMIPath(FieldPath) {
+		Name, Selector := Elem, ""
+		if Index := strings.Index(Elem, "["); Index >= 0 {
+			Name, Selector = Elem[:Index], strings.Trim(Elem[Index:], "[]")
+		}
+
+		Object, ok := Current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		Found := false
+		for Key, Value := range Object {
+			if LocalName(Key) == Name {
+				Current, Found = Value, true
+				break
+			}
+		}
+		if !Found {
+			return nil, false
+		}
+
+		if Selector != "" {
+			KeyValue := strings.SplitN(Selector, "=", 2)
+			List, ok := Current.([]interface{})
+			if !ok || len(KeyValue) != 2 {
+				return nil, false
+			}
+			Found = false
+			for _, Item := range List {
+				if Item, ok := Item.(map[string]interface{}); ok {
+					if v, ok := GNMIField(Item, KeyValue[0]); ok && IdentityName(fmt.Sprint(v)) == KeyValue[1] {
+						Current, Found = Item, true
+						break
+					}
+				}
+			}
+			if !Found {
+				return nil, false
+			}
+		}
+	}
+	return Current, true
+}
+
+func MapGNMIValue(Value interface{}, ValueMap map[string]string) (interface{}, bool) {
+	if Constant, ok := ValueMap["*"]; ok {
+		return Constant, true
+	}
+	switch v := Value.(type) {
+	case map[string]interface{}, []interface{}:
+		return nil, false
+	case float64:
+		if v == float64(int64(v)) {
+			Value = int64(v)
+		}
+	case bool:
+		Value = fmt.Sprint(v)
+	case string:
+		Value = IdentityName(v)
+	}
+	if Mapped, ok := ValueMap[fmt.Sprint(Value)]; ok {
+		return cu.ToNum(Mapped), true
+	}
+	return cu.ToNum(Value), true
+}
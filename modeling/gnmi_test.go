@@ -0,0 +1,193 @@
+package modeling
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	cu "github.com/achelovekov/collectorutils"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// GNMIStandIn answers Get requests from Updates, keyed by the requested path
+// with its keys in the form of the service definitions.
+type GNMIStandIn struct {
+	gpb.UnimplementedGNMIServer
+	Updates map[string][]*gpb.Update
+}
+
+func (s *GNMIStandIn) Get(ctx context.Context, Request *gpb.GetRequest) (*gpb.GetResponse, error) {
+	MD, _ := metadata.FromIncomingContext(ctx)
+	if len(MD["username"]) == 0 || MD["username"][0] != "admin" || len(MD["password"]) == 0 || MD["password"][0] != "secret" {
+		return nil, errors.New("Authentication failed")
+	}
+	Path := ""
+	for _, Elem := range Request.Path[0].Elem {
+		Path += "/" + Elem.Name
+		Keys := make([]string, 0)
+		for Key := range Elem.Key {
+			Keys = append(Keys, Key)
+		}
+		sort.Strings(Keys)
+		for _, Key := range Keys {
+			Path += "[" + Key + "=" + Elem.Key[Key] + "]"
+		}
+	}
+	return &gpb.GetResponse{Notification: []*gpb.Notification{{Timestamp: time.Now().UnixNano(), Update: s.Updates[Path]}}}, nil
+}
+
+func GNMIUpdate(t *testing.T, Path string, Value interface{}) *gpb.Update {
+	GNMIPath, err := ParseGNMIPath(Path)
+	if err != nil {
+		t.Fatalf("Can't parse %v: %v", Path, err)
+	}
+	JSONValue, err := json.Marshal(Value)
+	if err != nil {
+		t.Fatalf("Can't encode %v: %v", Value, err)
+	}
+	return &gpb.Update{Path: GNMIPath, Val: &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: JSONValue}}}
+}
+
+// StartGNMIStandIn serves Updates over TLS on a local port and returns the
+// address and a CA file with the server certificate.
+func StartGNMIStandIn(t *testing.T, Updates map[string][]*gpb.Update) (string, string) {
+	Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Can't generate a key: %v", err)
+	}
+	Template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	Certificate, err := x509.CreateCertificate(rand.Reader, Template, Template, &Key.PublicKey, Key)
+	if err != nil {
+		t.Fatalf("Can't create a certificate: %v", err)
+	}
+	CAFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(CAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: Certificate}), 0600); err != nil {
+		t.Fatalf("Can't write the CA file: %v", err)
+	}
+
+	Server := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&tls.Certificate{Certificate: [][]byte{Certificate}, PrivateKey: Key})))
+	gpb.RegisterGNMIServer(Server, &GNMIStandIn{Updates: Updates})
+	Listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Can't listen: %v", err)
+	}
+	go Server.Serve(Listener)
+	t.Cleanup(Server.Stop)
+	return Listener.Addr().String(), CAFile
+}
+
+func GNMIHost(Name string, URL string) cu.HostMetaData {
+	var hmd cu.HostMetaData
+	hmd.Host.Hostname = Name
+	hmd.Host.URL = URL
+	hmd.Host.Username = "admin"
+	hmd.Host.Password = "secret"
+	return hmd
+}
+
+// BGWUpdates is a vPC border gateway with L2VNI 10100 on VLAN 100.
+func BGWUpdates(t *testing.T, SrcIP string, DestIP string) map[string][]*gpb.Update {
+	return map[string][]*gpb.Update{
+		"/System/bd-items/bd-items/BD-list": {GNMIUpdate(t, "/System/bd-items/bd-items", map[string]interface{}{"BD-list": []interface{}{
+			map[string]interface{}{"id": 100, "accEncap": "vxlan-10100", "name": "web", "operSt": "up"}}})},
+		"/System/eps-items/epId-items/Ep-list[epId=*]/nws-items/vni-items/Nw-list": {GNMIUpdate(t, "/System/eps-items/epId-items/Ep-list[epId=1]/nws-items/vni-items", map[string]interface{}{"Nw-list": []interface{}{
+			map[string]interface{}{"vni": 10100, "mcastGroup": "239.1.1.1", "suppressARP": "enabled", "multisiteIngRepl": "enable"}}})},
+		"/System/eps-items/epId-items/Ep-list[epId=*]/nws-items/opervni-items/OperNw-list": {GNMIUpdate(t, "/System/eps-items/epId-items/Ep-list[epId=1]/nws-items/opervni-items", map[string]interface{}{"OperNw-list": []interface{}{
+			map[string]interface{}{"vni": 10100, "mode": "control-plane", "state": "up"}}})},
+		"/System/eps-items/epId-items/Ep-list[epId=*]/peers-items/dy_peer-items/DyPeer-list": {GNMIUpdate(t, "/System/eps-items/epId-items/Ep-list[epId=1]/peers-items/dy_peer-items", map[string]interface{}{"DyPeer-list": []interface{}{
+			map[string]interface{}{"ip": "10.0.0.2", "state": "Up"}}})},
+		"/System/evpn-items/bdevi-items/BDEvi-list[encap=*]/rttp-items/RttP-list[type=*]/ent-items/RttEntry-list": {
+			GNMIUpdate(t, "/System/evpn-items/bdevi-items/BDEvi-list[encap=vxlan-10100]/rttp-items/RttP-list[type=import]/ent-items", map[string]interface{}{"RttEntry-list": []interface{}{map[string]interface{}{"rtt": "route-target:unknown:0:0"}}}),
+			GNMIUpdate(t, "/System/evpn-items/bdevi-items/BDEvi-list[encap=vxlan-10100]/rttp-items/RttP-list[type=export]/ent-items", map[string]interface{}{"RttEntry-list": []interface{}{map[string]interface{}{"rtt": "route-target:unknown:0:0"}}})},
+		"/System/eps-items/multisite-items": {GNMIUpdate(t, "/System/eps-items/multisite-items", map[string]interface{}{"siteId": "100", "delayRestoreTime": 300})},
+		"/System/intf-items/phys-items/PhysIf-list[id=*]/multisiteiftracking-items": {
+			GNMIUpdate(t, "/System/intf-items/phys-items/PhysIf-list[id=eth1/1]/multisiteiftracking-items", map[string]interface{}{"tracking": "dci-tracking"}),
+			GNMIUpdate(t, "/System/intf-items/phys-items/PhysIf-list[id=eth1/49]/multisiteiftracking-items", map[string]interface{}{"tracking": "fabric-tracking"})},
+		"/System/vpc-items/inst-items/dom-items": {GNMIUpdate(t, "/System/vpc-items/inst-items/dom-items", map[string]interface{}{"id": 10, "keepalive-items": map[string]interface{}{"srcIp": SrcIP, "destIp": DestIP}})},
+	}
+}
+
+func TestGNMICollection(t *testing.T) {
+	Address1, CAFile1 := StartGNMIStandIn(t, BGWUpdates(t, "10.1.1.1", "10.1.1.2"))
+	Address2, CAFile2 := StartGNMIStandIn(t, BGWUpdates(t, "10.1.1.2", "10.1.1.1"))
+	ServiceDefinition, MetaData := LoadTestService(t, "VNI.service")
+
+	RawDataDB := CollectRawDataDB(MetaData, cu.Inventory{
+		GNMIHost("bgw1", "gnmi://"+Address1+"?ca="+CAFile1),
+		GNMIHost("bgw2", "gnmi://"+Address2+"?ca="+CAFile2),
+	}, "sys")
+	if len(RawDataDB) != 2 {
+		t.Fatalf("%v of 2 devices are collected over gNMI", len(RawDataDB))
+	}
+
+	VPCPairs := DiscoverVPCPairs(RawDataDB)
+	if len(VPCPairs) != 1 || VPCPairs[0].DomainID != "10" {
+		t.Errorf("Unexpected vPC pairs: %+v", VPCPairs)
+	}
+
+	ProcessedData := ConstructProcessedData(ServiceDefinition, RawDataDB, "10100", MetaData.ConversionMap)
+	for _, v := range ProcessedData.ServiceDataDB {
+		if v.OperData["TABLE_nve_vni.vni-state"] != "Up" {
+			t.Errorf("VNI state of %v is %v, expected Up", v.DeviceName, v.OperData["TABLE_nve_vni.vni-state"])
+		}
+	}
+	for _, DeviceName := range []string{"bgw1", "bgw2"} {
+		Layout := make(map[string]ComponentBitMap)
+		for _, v := range ProcessedData.ServiceLayoutDB {
+			if v.DeviceName == DeviceName {
+				for _, Component := range v.ServiceLayout {
+					Layout[Component.Name] = Component
+				}
+			}
+		}
+		for Component, Value := range map[string]bool{"L2VNI": true, "BGW": true, "Leaf": false, "DCI-Tracking": true, "Fabric-Tracking": true, "MS-IR": true} {
+			if Layout[Component].Value != Value {
+				t.Errorf("Component %v of %v is %v, expected %v", Component, DeviceName, Layout[Component].Value, Value)
+			}
+		}
+		if Layout["L2VNI"].Oper != "up" {
+			t.Errorf("L2VNI of %v is %q, expected up", DeviceName, Layout["L2VNI"].Oper)
+		}
+	}
+}
+
+func TestGNMIUnverifiedCertificate(t *testing.T) {
+	Address, _ := StartGNMIStandIn(t, nil)
+
+	Timeout := GNMIDialTimeout
+	GNMIDialTimeout = time.Second
+	defer func() { GNMIDialTimeout = Timeout }()
+
+	if _, err := GetGNMIData(&MetaData{}, GNMIHost("bgw1", "gnmi://"+Address)); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Unexpected error from a device with an untrusted certificate: %v", err)
+	}
+	if _, err := GetGNMIData(&MetaData{}, GNMIHost("bgw1", "gnmi://"+Address+"?insecure=true")); err != nil {
+		t.Errorf("Device is not collected with verification off: %v", err)
+	}
+}
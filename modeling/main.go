@@ -11,17 +11,30 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	mt "n9k-modeling/metrics"
 
 	cu "github.com/achelovekov/collectorutils"
 )
 
+func NewRunID() string {
+	return strings.Replace(time.Now().UTC().Format("20060102-150405.000000"), ".", "-", 1)
+}
+
 type MetaData struct {
 	Config        cu.Config
 	Enrich        cu.Enrich
 	Filter        cu.Filter
 	KeysMap       cu.KeysMap
+	CLIMap        CLIMap
+	GNMIMap       GNMIMap
+	PropInclude   string
+	NETCONFFilter string
 	ConversionMap cu.ConversionMap
 }
 
@@ -48,15 +61,15 @@ type NXAPILoginResponse struct {
 	}
 }
 
-func NXAPICall(hmd cu.HostMetaData, DMEPath string) (map[string]interface{}, error) {
-	src := make(map[string]interface{})
-
+func NXAPIClient() *http.Client {
 	transport := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 
-	client := &http.Client{Transport: transport}
+	return &http.Client{Transport: transport}
+}
 
+func NXAPILogin(client *http.Client, hmd cu.HostMetaData) (string, error) {
 	NXAPILoginBody := &NXAPILoginBody{
 		AaaUser: AaaUser{
 			Attributes: Attributes{
@@ -73,15 +86,19 @@ func NXAPICall(hmd cu.HostMetaData, DMEPath string) (map[string]interface{}, err
 
 	url := hmd.Host.URL + "/api/mo/aaaLogin.json"
 
+	Start := time.Now()
 	res, err := client.Post(url, "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
 		log.Println(err)
-		return src, errors.New("Can't reach device API")
+		mt.ObserveError(hmd.Host.Hostname, "unreachable")
+		return "", errors.New("Can't reach device API")
 	}
 
 	if res.StatusCode != 200 {
 		log.Println("Unauthorized acces or something goes wrong while receiving access cookie")
-		return src, fmt.Errorf("Can't get access cookie from device: %v", hmd.Host.Hostname)
+		res.Body.Close()
+		mt.ObserveError(hmd.Host.Hostname, "login")
+		return "", fmt.Errorf("Can't get access cookie from device: %v", hmd.Host.Hostname)
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
@@ -89,68 +106,301 @@ func NXAPICall(hmd cu.HostMetaData, DMEPath string) (map[string]interface{}, err
 		log.Println(err)
 	}
 	res.Body.Close()
+	mt.ObserveRequest(hmd.Host.Hostname, mt.BackendNXAPI, "login", Start, len(body))
 
 	var NXAPILoginResponse NXAPILoginResponse
 
 	err = json.Unmarshal([]byte(body), &NXAPILoginResponse)
+	if err != nil || len(NXAPILoginResponse.Imdata) == 0 {
+		mt.ObserveError(hmd.Host.Hostname, "decode")
+		return "", fmt.Errorf("Can't parse access cookie from device: %v", hmd.Host.Hostname)
+	}
 
-	token := "APIC-cookie=" + NXAPILoginResponse.Imdata[0].AaaLogin.Attributes.Token
+	return "APIC-cookie=" + NXAPILoginResponse.Imdata[0].AaaLogin.Attributes.Token, nil
+}
 
-	url = hmd.Host.URL + "/api/mo/" + DMEPath + ".json?rsp-subtree=full&rsp-prop-include=config-only"
+func NXAPICall(hmd cu.HostMetaData, DMEPath string) (map[string]interface{}, error) {
+	return NXAPIPropCall(hmd, DMEPath, "config-only")
+}
+
+func NXAPIPropCall(hmd cu.HostMetaData, DMEPath string, PropInclude string) (map[string]interface{}, error) {
+	src := make(map[string]interface{})
+
+	client := NXAPIClient()
+
+	token, err := NXAPILogin(client, hmd)
+	if err != nil {
+		return src, err
+	}
+
+	url := hmd.Host.URL + "/api/mo/" + DMEPath + ".json?rsp-subtree=full&rsp-prop-include=" + PropInclude
 
 	req, err := http.NewRequest("GET", url, io.Reader(nil))
+	if err != nil {
+		return src, err
+	}
 	req.Header.Set("Cookie", token)
 
+	Start := time.Now()
 	resp, err := client.Do(req)
-	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		mt.ObserveError(hmd.Host.Hostname, "unreachable")
+		return src, fmt.Errorf("Can't get data from device: %v: %v", hmd.Host.Hostname, err)
+	}
+	defer resp.Body.Close()
 
+	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("error = %s \n", err)
+		mt.ObserveError(hmd.Host.Hostname, "fetch")
+		return src, fmt.Errorf("Can't read data from device: %v: %v", hmd.Host.Hostname, err)
+	}
+	mt.ObserveRequest(hmd.Host.Hostname, mt.BackendNXAPI, "fetch", Start, len(data))
+
+	if resp.StatusCode != 200 {
+		mt.ObserveError(hmd.Host.Hostname, "http-status")
+		return src, fmt.Errorf("Can't get data from device: %v, status: %v", hmd.Host.Hostname, resp.Status)
 	}
 
 	err = json.Unmarshal(data, &src)
 	if err != nil {
-		panic(err)
+		mt.ObserveError(hmd.Host.Hostname, "decode")
+		return src, fmt.Errorf("Can't parse data from device: %v: %v", hmd.Host.Hostname, err)
 	}
 
 	return src, nil
 
 }
 
+func NXAPIPost(hmd cu.HostMetaData, DMEPath string, Payload interface{}) (map[string]interface{}, error) {
+	dst := make(map[string]interface{})
+
+	client := NXAPIClient()
+
+	token, err := NXAPILogin(client, hmd)
+	if err != nil {
+		return dst, err
+	}
+
+	requestBody, err := json.Marshal(Payload)
+	if err != nil {
+		return dst, err
+	}
+
+	url := hmd.Host.URL + "/api/mo/" + DMEPath + ".json"
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return dst, err
+	}
+	req.Header.Set("Cookie", token)
+	req.Header.Set("Content-Type", "application/json")
+
+	Start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		mt.ObserveError(hmd.Host.Hostname, "unreachable")
+		return dst, fmt.Errorf("Can't post data to device: %v", hmd.Host.Hostname)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		mt.ObserveError(hmd.Host.Hostname, "post")
+		return dst, err
+	}
+	mt.ObserveRequest(hmd.Host.Hostname, mt.BackendNXAPI, "post", Start, len(data))
+
+	err = json.Unmarshal(data, &dst)
+	if err != nil {
+		mt.ObserveError(hmd.Host.Hostname, "decode")
+		return dst, fmt.Errorf("Can't parse response from device: %v, status: %v", hmd.Host.Hostname, resp.Status)
+	}
+
+	return dst, nil
+}
+
+type NXAPICLIBody struct {
+	InsAPI InsAPI `json:"ins_api"`
+}
+
+type InsAPI struct {
+	Version      string `json:"version"`
+	Type         string `json:"type"`
+	Chunk        string `json:"chunk"`
+	Sid          string `json:"sid"`
+	Input        string `json:"input"`
+	OutputFormat string `json:"output_format"`
+}
+
+type NXAPICLIOutput struct {
+	Code  string      `json:"code"`
+	Msg   string      `json:"msg"`
+	Input string      `json:"input"`
+	Body  interface{} `json:"body"`
+}
+
+func NXAPICLICall(hmd cu.HostMetaData, CommandType string, Commands []string) ([]NXAPICLIOutput, error) {
+	Outputs := make([]NXAPICLIOutput, 0)
+
+	client := NXAPIClient()
+
+	NXAPICLIBody := &NXAPICLIBody{
+		InsAPI: InsAPI{
+			Version:      "1.0",
+			Type:         CommandType,
+			Chunk:        "0",
+			Sid:          "1",
+			Input:        strings.Join(Commands, " ;"),
+			OutputFormat: "json",
+		},
+	}
+
+	requestBody, err := json.Marshal(NXAPICLIBody)
+	if err != nil {
+		return Outputs, err
+	}
+
+	req, err := http.NewRequest("POST", hmd.Host.URL+"/ins", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return Outputs, err
+	}
+	req.SetBasicAuth(hmd.Host.Username, hmd.Host.Password)
+	req.Header.Set("Content-Type", "application/json")
+
+	Start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Println(err)
+		mt.ObserveError(hmd.Host.Hostname, "unreachable")
+		return Outputs, errors.New("Can't reach device API")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		mt.ObserveError(hmd.Host.Hostname, "http-status")
+		return Outputs, fmt.Errorf("NX-API CLI call failed on device: %v, status: %v", hmd.Host.Hostname, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		mt.ObserveError(hmd.Host.Hostname, "cli")
+		return Outputs, err
+	}
+	mt.ObserveRequest(hmd.Host.Hostname, mt.BackendNXAPI, "cli", Start, len(data))
+
+	var Response struct {
+		InsAPI struct {
+			Outputs struct {
+				Output json.RawMessage `json:"output"`
+			} `json:"outputs"`
+		} `json:"ins_api"`
+	}
+
+	err = json.Unmarshal(data, &Response)
+	if err != nil {
+		return Outputs, fmt.Errorf("Can't parse NX-API CLI response from device: %v", hmd.Host.Hostname)
+	}
+
+	if err := json.Unmarshal(Response.InsAPI.Outputs.Output, &Outputs); err != nil {
+		var Output NXAPICLIOutput
+		if err := json.Unmarshal(Response.InsAPI.Outputs.Output, &Output); err != nil {
+			return Outputs, fmt.Errorf("Can't parse NX-API CLI output from device: %v", hmd.Host.Hostname)
+		}
+		Outputs = append(Outputs, Output)
+	}
+
+	for _, Output := range Outputs {
+		if Output.Code != "200" {
+			mt.ObserveError(hmd.Host.Hostname, "cli")
+			return Outputs, fmt.Errorf("Command %q failed on device %v: %v", Output.Input, hmd.Host.Hostname, Output.Msg)
+		}
+	}
+
+	return Outputs, nil
+}
+
 type RawDataDB []RawDataDBEntry
 type RawDataDBEntry struct {
 	DeviceName  string
 	DMEChunkMap DMEChunkMap
+	Offline     bool
 }
 type DMEChunkMap map[string]DMEChunk
 type DMEChunk []map[string]interface{}
 
 type ServiceDefinition struct {
 	DMEProcessing        []cu.KeyDefinition   `json:"DMEProcessing"`
+	CLIProcessing        []CLIKeyDefinition   `json:"CLIProcessing"`
+	GNMIProcessing       []GNMIKeyDefinition  `json:"GNMIProcessing"`
+	PropInclude          string               `json:"PropInclude"`
+	NETCONFFilter        string               `json:"NETCONFFilter"`
 	ServiceName          string               `json:"ServiceName"`
 	ServiceConstructPath ServiceConstructPath `json:"ServiceConstructPath"`
 	ServiceComponents    ServiceComponents    `json:"ServiceComponents"`
+	ServiceRemoval       ServiceRemoval       `json:"ServiceRemoval"`
+	ServiceConsistency   ServiceConsistency   `json:"ServiceConsistency"`
 }
 
 type ServiceConstructPath []struct {
-	ChunkName string   `json:"ChunkName"`
-	KeySName  string   `json:"KeySName"`
-	KeySType  string   `json:"KeySType"`
-	KeyDName  string   `json:"KeyDName"`
-	KeyDType  string   `json:"KeyDType"`
-	KeyLink   string   `json:"KeyLink"`
-	MatchType string   `json:"MatchType"`
-	KeyList   []string `json:"KeyList"`
-	Options   []Option `json:"Options"`
+	ChunkName   string   `json:"ChunkName"`
+	KeySName    string   `json:"KeySName"`
+	KeySType    string   `json:"KeySType"`
+	KeyDName    string   `json:"KeyDName"`
+	KeyDType    string   `json:"KeyDType"`
+	KeyLink     string   `json:"KeyLink"`
+	KeyFormat   string   `json:"KeyFormat"`
+	MatchType   string   `json:"MatchType"`
+	KeyList     []string `json:"KeyList"`
+	OperKeyList []string `json:"OperKeyList"`
+	Options     []Option `json:"Options"`
 }
 type Option struct {
-	OptionKey   string `json:"optionKey"`
-	OptionValue string `json:"optionValue"`
+	OptionKey   string   `json:"optionKey"`
+	OptionValue string   `json:"optionValue"`
+	Match       []Option `json:"match,omitempty"`
+}
+
+// Matches checks the option and every key it is narrowed down with, e.g. the
+// address family of a route-target, against a DME row.
+func (o Option) Matches(item map[string]interface{}) bool {
+	if item[o.OptionKey] != o.OptionValue {
+		return false
+	}
+	for _, Match := range o.Match {
+		if !Match.Matches(item) {
+			return false
+		}
+	}
+	return true
+}
+
+type ServiceRemoval []RemovalStep
+type RemovalStep struct {
+	Class      string   `json:"Class"`
+	NamingKeys []string `json:"NamingKeys"`
+}
+type ServiceConsistency struct {
+	Uniform   []string   `json:"Uniform"`
+	Exclusive [][]string `json:"Exclusive"`
+	Requires  [][]string `json:"Requires"`
+	PeerPairs []PeerPair `json:"PeerPairs"`
+	PairKeys  []string   `json:"PairKeys"`
+}
+
+// PeerPair pairs the sessions of PeerKey between devices: a session belongs to
+// the device that has the peer address among its LocalKeys values, e.g. its
+// router-id or the address of its NVE source loopback.
+type PeerPair struct {
+	LocalKeys   []string          `json:"LocalKeys"`
+	PeerKey     string            `json:"PeerKey"`
+	PeerValues  map[string]string `json:"PeerValues"`
+	PeerMatches map[string]string `json:"PeerMatches"`
 }
 type ServiceComponents []ServiceComponent
 type ServiceComponent struct {
 	ComponentName string         `json:"ComponentName"`
 	ComponentKeys []ComponentKey `json:"ComponentKeys"`
+	OperKeys      []ComponentKey `json:"OperKeys"`
 }
 type ComponentKey struct {
 	Name      string `json:"Name"`
@@ -205,6 +455,33 @@ func LoadKeysMap(KeysDefinition []cu.KeyDefinition) cu.KeysMap {
 	return KeysMap
 }
 
+type CLIKeyDefinition struct {
+	Key     string `json:"Key"`
+	Command string `json:"Command"`
+	Paths   []struct {
+		Path string `json:"Path"`
+	} `json:"Paths"`
+}
+
+type CLIMap map[string]CLIChunk
+type CLIChunk struct {
+	Command string
+	Paths   cu.Paths
+}
+
+func LoadCLIMap(CLIKeysDefinition []CLIKeyDefinition) CLIMap {
+	CLIMap := make(CLIMap)
+
+	for _, v := range CLIKeysDefinition {
+		var KeyDefinition cu.KeyDefinition
+		KeyDefinition.Key = v.Key
+		KeyDefinition.Paths = v.Paths
+		CLIMap[v.Key] = CLIChunk{Command: v.Command, Paths: LoadKeysMap([]cu.KeyDefinition{KeyDefinition})[v.Key]}
+	}
+
+	return CLIMap
+}
+
 func worker(src map[string]interface{}, path cu.Path, mode int, filter cu.Filter, enrich cu.Enrich) []map[string]interface{} {
 	var pathIndex int
 	header := make(map[string]interface{})
@@ -218,36 +495,146 @@ func worker(src map[string]interface{}, path cu.Path, mode int, filter cu.Filter
 }
 
 func GetRawData(md *MetaData, hmd cu.HostMetaData, DMEPath string, ch chan<- RawDataDBEntry, wg *sync.WaitGroup) {
-	src, err := NXAPICall(hmd, DMEPath)
-	if err != nil {
-		log.Println("Can't get data from device:", hmd.Host.Hostname)
-		wg.Done()
-	} else {
+	defer wg.Done()
+
+	if IsGNMIHost(hmd) {
+		RawDataDBEntry, err := GetGNMIData(md, hmd)
+		mt.ObserveCollection(hmd.Host.Hostname, err == nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
 		log.Println("Data received from defice:", hmd.Host.Hostname)
-		Processing(md, hmd, src, ch, wg)
+		ch <- RawDataDBEntry
+		return
+	}
+
+	PropInclude := md.PropInclude
+	if PropInclude == "" {
+		PropInclude = "config-only"
+	}
+
+	var src map[string]interface{}
+	var err error
+	if IsNETCONFHost(hmd) {
+		src, err = NETCONFCall(hmd, md.NETCONFFilter)
+	} else if IsFileHost(hmd) {
+		src, err = LoadOfflineData(hmd)
+	} else {
+		src, err = NXAPIPropCall(hmd, DMEPath, PropInclude)
+	}
+	mt.ObserveCollection(hmd.Host.Hostname, err == nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	log.Println("Data received from defice:", hmd.Host.Hostname)
+
+	RawDataDBEntry := ProcessDMEData(md, hmd, src)
+	if !IsNETCONFHost(hmd) && !IsFileHost(hmd) {
+		GetCLIData(md, hmd, RawDataDBEntry.DMEChunkMap)
 	}
+	ch <- RawDataDBEntry
 }
 
-func Processing(md *MetaData, hmd cu.HostMetaData, src map[string]interface{}, ch chan<- RawDataDBEntry, wg *sync.WaitGroup) {
+func GetCLIData(md *MetaData, hmd cu.HostMetaData, DMEChunkMap DMEChunkMap) {
+	MapKeys := make([]string, 0)
+	for MapKey := range md.CLIMap {
+		MapKeys = append(MapKeys, MapKey)
+	}
+	sort.Strings(MapKeys)
+
+	for _, MapKey := range MapKeys {
+		CLIChunk := md.CLIMap[MapKey]
+		Outputs, err := NXAPICLICall(hmd, "cli_show", []string{CLIChunk.Command})
+		if err != nil || len(Outputs) == 0 {
+			log.Println("Can't get", CLIChunk.Command, "from device:", hmd.Host.Hostname, err)
+			continue
+		}
+		src, ok := Outputs[0].Body.(map[string]interface{})
+		if !ok {
+			log.Println("Empty", CLIChunk.Command, "output from device:", hmd.Host.Hostname)
+			src = make(map[string]interface{})
+		}
+		DMEChunkMap[MapKey] = ProcessChunk(md, hmd, MapKey, CLIChunk.Paths, src)
+	}
+}
+
+func ProcessChunk(md *MetaData, hmd cu.HostMetaData, MapKey string, Paths cu.Paths, src map[string]interface{}) DMEChunk {
+	DMEChunk := make([]map[string]interface{}, 0)
 
+	buf := make([]map[string]interface{}, 0)
+	for _, Path := range Paths {
+		buf = worker(src, Path, cu.Cadence, md.Filter, md.Enrich)
+		DMEChunk = append(DMEChunk, buf...)
+	}
+	mt.ObserveRows(hmd.Host.Hostname, MapKey, len(DMEChunk))
+
+	return DMEChunk
+}
+
+func Processing(md *MetaData, hmd cu.HostMetaData, src map[string]interface{}, ch chan<- RawDataDBEntry, wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	ch <- ProcessDMEData(md, hmd, src)
+}
+
+func ProcessDMEData(md *MetaData, hmd cu.HostMetaData, src map[string]interface{}) RawDataDBEntry {
 	var RawDataDBEntry RawDataDBEntry
 	RawDataDBEntry.DeviceName = hmd.Host.Hostname
 	RawDataDBEntry.DMEChunkMap = make(map[string]DMEChunk)
+	// Saved replies and running-configs carry no live state to check.
+	RawDataDBEntry.Offline = IsFileHost(hmd)
 
-	for MapKey, Paths := range md.KeysMap {
-		DMEChunk := make([]map[string]interface{}, 0)
+	MapKeys := make([]string, 0)
+	for MapKey := range md.KeysMap {
+		MapKeys = append(MapKeys, MapKey)
+	}
+	sort.Strings(MapKeys)
 
-		buf := make([]map[string]interface{}, 0)
-		for _, Path := range Paths {
-			buf = worker(src, Path, cu.Cadence, md.Filter, md.Enrich)
-			DMEChunk = append(DMEChunk, buf...)
-		}
-		RawDataDBEntry.DMEChunkMap[MapKey] = DMEChunk
+	for _, MapKey := range MapKeys {
+		RawDataDBEntry.DMEChunkMap[MapKey] = ProcessChunk(md, hmd, MapKey, md.KeysMap[MapKey], src)
 	}
 
-	ch <- RawDataDBEntry
+	return RawDataDBEntry
+}
+
+func CollectRawDataDB(md *MetaData, Inventory cu.Inventory, DMEPath string) RawDataDB {
+	ch := make(chan RawDataDBEntry, len(Inventory))
+	var wg sync.WaitGroup
+
+	for _, v := range Inventory {
+		wg.Add(1)
+		go GetRawData(md, v, DMEPath, ch, &wg)
+	}
+
+	wg.Wait()
+	close(ch)
+
+	var RawDataDB RawDataDB
+
+	for elem := range ch {
+		RawDataDB = append(RawDataDB, elem)
+	}
+
+	SortRawDataDB(RawDataDB)
+
+	return RawDataDB
+}
+
+func SortRawDataDB(RawDataDB RawDataDB) {
+	sort.SliceStable(RawDataDB, func(i, j int) bool {
+		return RawDataDB[i].DeviceName < RawDataDB[j].DeviceName
+	})
+}
+
+func SortProcessedData(ProcessedData *ProcessedData) {
+	sort.SliceStable(ProcessedData.ServiceDataDB, func(i, j int) bool {
+		return ProcessedData.ServiceDataDB[i].DeviceName < ProcessedData.ServiceDataDB[j].DeviceName
+	})
+	sort.SliceStable(ProcessedData.ServiceLayoutDB, func(i, j int) bool {
+		return ProcessedData.ServiceLayoutDB[i].DeviceName < ProcessedData.ServiceLayoutDB[j].DeviceName
+	})
 }
 
 func DeviceDataFill(DMEChunk DMEChunk, KeySName string, KeyDName string, KeyList []string, DeviceData DeviceData, Options []Option, matchType string) {
@@ -265,7 +652,7 @@ func DeviceDataFill(DMEChunk DMEChunk, KeySName string, KeyDName string, KeyList
 		} else {
 			for _, Option := range Options {
 				for _, item := range DMEChunk {
-					if (DeviceData[KeySName] == item[KeyDName] && item[Option.OptionKey] == Option.OptionValue) || (KeySName == "any" && KeyDName == "any") {
+					if (DeviceData[KeySName] == item[KeyDName] || (KeySName == "any" && KeyDName == "any")) && Option.Matches(item) {
 						for _, v := range KeyList {
 							if _, ok := item[v]; ok {
 								DeviceData[v+"."+Option.OptionValue] = item[v]
@@ -290,7 +677,7 @@ func DeviceDataFill(DMEChunk DMEChunk, KeySName string, KeyDName string, KeyList
 		} else {
 			for _, Option := range Options {
 				for _, item := range DMEChunk {
-					if (strings.Contains(item[KeyDName].(string), DeviceData[KeySName].(string)) && item[Option.OptionKey] == Option.OptionValue) || (KeySName == "any" && KeyDName == "any") {
+					if ((KeySName == "any" && KeyDName == "any") || strings.Contains(item[KeyDName].(string), DeviceData[KeySName].(string))) && Option.Matches(item) {
 						for _, v := range KeyList {
 							if _, ok := item[v]; ok {
 								DeviceData[v+"."+Option.OptionValue] = item[v]
@@ -301,6 +688,134 @@ func DeviceDataFill(DMEChunk DMEChunk, KeySName string, KeyDName string, KeyList
 			}
 		}
 	}
+	if matchType == "full-list" {
+		if len(Options) == 0 {
+			Rows := make([]map[string]interface{}, 0)
+			for _, item := range DMEChunk {
+				if DeviceData[KeySName] == item[KeyDName] || (KeySName == "any" && KeyDName == "any") {
+					Rows = append(Rows, item)
+				}
+			}
+			AppendRows(DeviceData, Rows, KeyList, "")
+		} else {
+			for _, Option := range Options {
+				Rows := make([]map[string]interface{}, 0)
+				for _, item := range DMEChunk {
+					if (DeviceData[KeySName] == item[KeyDName] || (KeySName == "any" && KeyDName == "any")) && Option.Matches(item) {
+						Rows = append(Rows, item)
+					}
+				}
+				AppendRows(DeviceData, Rows, KeyList, "."+Option.OptionValue)
+			}
+		}
+	}
+	if matchType == "vlan-list" {
+		if len(Options) == 0 {
+			for _, item := range DMEChunk {
+				if VLANListContains(item[KeyDName], DeviceData[KeySName]) {
+					for _, v := range KeyList {
+						if _, ok := item[v]; ok {
+							AppendDeviceData(DeviceData, v, item[v])
+						}
+					}
+				}
+			}
+		} else {
+			for _, Option := range Options {
+				for _, item := range DMEChunk {
+					if VLANListContains(item[KeyDName], DeviceData[KeySName]) && Option.Matches(item) {
+						for _, v := range KeyList {
+							if _, ok := item[v]; ok {
+								AppendDeviceData(DeviceData, v+"."+Option.OptionValue, item[v])
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func ParseVLANList(List interface{}) []int {
+	VLANs := make([]int, 0)
+	for _, Item := range strings.Split(fmt.Sprint(List), ",") {
+		Item = strings.TrimPrefix(strings.TrimSpace(Item), "vlan-")
+		Bounds := strings.SplitN(Item, "-", 2)
+		From, err := strconv.Atoi(Bounds[0])
+		if err != nil {
+			continue
+		}
+		To := From
+		if len(Bounds) == 2 {
+			if To, err = strconv.Atoi(Bounds[1]); err != nil || To > 4095 {
+				continue
+			}
+		}
+		for VLAN := From; VLAN <= To; VLAN++ {
+			VLANs = append(VLANs, VLAN)
+		}
+	}
+	return VLANs
+}
+
+func FormatVLANList(VLANs []int) string {
+	Sorted := append([]int{}, VLANs...)
+	sort.Ints(Sorted)
+	Ranges := make([]string, 0)
+	for i := 0; i < len(Sorted); {
+		j := i
+		for j+1 < len(Sorted) && Sorted[j+1] <= Sorted[j]+1 {
+			j++
+		}
+		if Sorted[j] == Sorted[i] {
+			Ranges = append(Ranges, strconv.Itoa(Sorted[i]))
+		} else {
+			Ranges = append(Ranges, strconv.Itoa(Sorted[i])+"-"+strconv.Itoa(Sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(Ranges, ",")
+}
+
+func VLANListContains(List interface{}, VLAN interface{}) bool {
+	VLANID, err := strconv.Atoi(strings.TrimPrefix(fmt.Sprint(VLAN), "vlan-"))
+	if err != nil {
+		return false
+	}
+	for _, v := range ParseVLANList(List) {
+		if v == VLANID {
+			return true
+		}
+	}
+	return false
+}
+
+func AppendDeviceData(DeviceData DeviceData, Key string, Value interface{}) {
+	if Values, ok := DeviceData[Key].([]interface{}); ok {
+		DeviceData[Key] = append(Values, Value)
+	} else {
+		DeviceData[Key] = []interface{}{Value}
+	}
+}
+
+// AppendRows appends one entry per row to the list of every key, nil where the
+// row lacks the attribute, so the lists stay in step row by row. A key none of
+// the rows has is left out.
+func AppendRows(DeviceData DeviceData, Rows DMEChunk, KeyList []string, Suffix string) {
+	if len(Rows) == 0 {
+		return
+	}
+	for _, v := range KeyList {
+		Values, Found := DeviceData[v+Suffix].([]interface{})
+		for _, item := range Rows {
+			Value, ok := item[v]
+			Found = Found || ok
+			Values = append(Values, Value)
+		}
+		if Found {
+			DeviceData[v+Suffix] = Values
+		}
+	}
 }
 
 func TypeConversion(srcType string, dstType string, srcVal interface{}, ConversionMap cu.ConversionMap) interface{} {
@@ -316,6 +831,8 @@ type ServiceDataDB []ServiceDataDBEntry
 type ServiceDataDBEntry struct {
 	DeviceName string     `json:"DeviceName"`
 	DeviceData DeviceData `json:"DeviceData"`
+	OperData   DeviceData `json:"OperData,omitempty"`
+	Offline    bool       `json:"Offline,omitempty"`
 }
 type DeviceData map[string]interface{}
 
@@ -323,12 +840,29 @@ func ConstructServiceDataDB(ServiceDataDB *ServiceDataDB, RawDataDB RawDataDB, s
 	for _, DBEntry := range RawDataDB {
 		var ServiceDataDBEntry ServiceDataDBEntry
 		DeviceData := make(DeviceData)
+		OperData := make(map[string]interface{})
 		for _, v := range ServiceConstructPath {
 			if v.KeyLink == "direct" {
 				DeviceData[v.KeySName] = srcVal
 				DeviceData[v.KeySName] = TypeConversion(v.KeySType, v.KeyDType, DeviceData[v.KeySName], ConversionMap)
 				DeviceDataFill(DBEntry.DMEChunkMap[v.ChunkName], v.KeySName, v.KeyDName, v.KeyList, DeviceData, v.Options, v.MatchType)
 			}
+			if v.KeyLink == "indirect" && v.KeyFormat != "" {
+				if Value, ok := DeviceData[v.KeySName]; ok {
+					Formatted := map[string]interface{}{v.KeyDName: fmt.Sprintf(v.KeyFormat, Value)}
+					DeviceDataFill(DBEntry.DMEChunkMap[v.ChunkName], v.KeyDName, v.KeyDName, v.KeyList, Formatted, v.Options, v.MatchType)
+					if len(v.OperKeyList) > 0 && !DBEntry.Offline {
+						DeviceDataFill(DBEntry.DMEChunkMap[v.ChunkName], v.KeyDName, v.KeyDName, v.OperKeyList, Formatted, v.Options, v.MatchType)
+					}
+					if len(Formatted) > 1 {
+						for Key, Value := range Formatted {
+							DeviceData[Key] = Value
+						}
+						MoveOperData(DeviceData, OperData, v.OperKeyList)
+					}
+				}
+				continue
+			}
 			if v.KeyLink == "indirect" {
 				if _, ok := DeviceData[v.KeySName]; ok {
 					DeviceData[v.KeySName] = TypeConversion(v.KeySType, v.KeyDType, DeviceData[v.KeySName], ConversionMap)
@@ -338,13 +872,32 @@ func ConstructServiceDataDB(ServiceDataDB *ServiceDataDB, RawDataDB RawDataDB, s
 			if v.KeyLink == "no-link" {
 				DeviceDataFill(DBEntry.DMEChunkMap[v.ChunkName], v.KeySName, v.KeyDName, v.KeyList, DeviceData, v.Options, v.MatchType)
 			}
+			if _, ok := DeviceData[v.KeySName]; (ok || v.KeyLink == "no-link") && len(v.OperKeyList) > 0 && !DBEntry.Offline {
+				DeviceDataFill(DBEntry.DMEChunkMap[v.ChunkName], v.KeySName, v.KeyDName, v.OperKeyList, DeviceData, v.Options, v.MatchType)
+				MoveOperData(DeviceData, OperData, v.OperKeyList)
+			}
 		}
 		ServiceDataDBEntry.DeviceName = DBEntry.DeviceName
 		ServiceDataDBEntry.DeviceData = DeviceData
+		ServiceDataDBEntry.Offline = DBEntry.Offline
+		if len(OperData) > 0 {
+			ServiceDataDBEntry.OperData = OperData
+		}
 		*ServiceDataDB = append(*ServiceDataDB, ServiceDataDBEntry)
 	}
 }
 
+func MoveOperData(DeviceData DeviceData, OperData DeviceData, OperKeyList []string) {
+	for Key, Value := range DeviceData {
+		for _, OperKey := range OperKeyList {
+			if Key == OperKey || strings.HasPrefix(Key, OperKey+".") {
+				OperData[Key] = Value
+				delete(DeviceData, Key)
+			}
+		}
+	}
+}
+
 func MarshalToJSON(src interface{}) []byte {
 	JSONData, err := json.MarshalIndent(src, "", "  ")
 	if err != nil {
@@ -374,6 +927,19 @@ type ServiceLayout []ComponentBitMap
 type ComponentBitMap struct {
 	Name  string `json:"Name"`
 	Value bool   `json:"Value"`
+	Oper  string `json:"Oper,omitempty"`
+}
+
+func ValueContains(v interface{}, Value string) bool {
+	if Values, ok := v.([]interface{}); ok {
+		for _, Item := range Values {
+			if strings.Contains(fmt.Sprint(Item), Value) {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.Contains(fmt.Sprint(v), Value)
 }
 
 func CheckComponentKeys(ComponentKeys []ComponentKey, DeviceData map[string]interface{}) bool {
@@ -394,13 +960,40 @@ func CheckComponentKeys(ComponentKeys []ComponentKey, DeviceData map[string]inte
 					flag = flag && false
 				}
 			}
+			if ComponentKey.MatchType == "contains" {
+				flag = flag && ValueContains(v, ComponentKey.Value)
+			}
+			if ComponentKey.MatchType == "not-contains" {
+				flag = flag && !ValueContains(v, ComponentKey.Value)
+			}
+			if ComponentKey.MatchType == "absent" {
+				flag = flag && false
+			}
 		} else {
-			flag = flag && false
+			flag = flag && ComponentKey.MatchType == "absent"
 		}
 	}
 	return flag
 }
 
+// CheckOperKeys evaluates the oper keys the device reported. A missing key,
+// e.g. no dynamic peers or a show command that failed, is unknown, not down.
+func CheckOperKeys(OperKeys []ComponentKey, OperData DeviceData) string {
+	Known := make([]ComponentKey, 0)
+	for _, OperKey := range OperKeys {
+		if _, ok := OperData[OperKey.Name]; ok || OperKey.MatchType == "absent" {
+			Known = append(Known, OperKey)
+		}
+	}
+	if len(Known) == 0 {
+		return "unknown"
+	}
+	if CheckComponentKeys(Known, OperData) {
+		return "up"
+	}
+	return "down"
+}
+
 func ConstructServiceLayout(ServiceComponents ServiceComponents, ServiceDataDB ServiceDataDB, ServiceLayoutDB *ServiceLayoutDB) {
 	for _, ServiceDataDBEntry := range ServiceDataDB {
 		var ServiceLayoutDBEntry ServiceLayoutDBEntry
@@ -411,6 +1004,9 @@ func ConstructServiceLayout(ServiceComponents ServiceComponents, ServiceDataDB S
 			} else {
 				ComponentBitMap.Value = false
 			}
+			if ComponentBitMap.Value && len(ServiceComponent.OperKeys) > 0 && !ServiceDataDBEntry.Offline {
+				ComponentBitMap.Oper = CheckOperKeys(ServiceComponent.OperKeys, ServiceDataDBEntry.OperData)
+			}
 			ComponentBitMap.Name = ServiceComponent.ComponentName
 			ServiceLayoutDBEntry.ServiceLayout = append(ServiceLayoutDBEntry.ServiceLayout, ComponentBitMap)
 			ServiceLayoutDBEntry.DeviceName = ServiceDataDBEntry.DeviceName
@@ -423,4 +1019,128 @@ type ProcessedData struct {
 	ServiceName     string          `json:"ServiceName"`
 	ServiceDataDB   ServiceDataDB   `json:"ServiceDataDB"`
 	ServiceLayoutDB ServiceLayoutDB `json:"ServiceLayoutDB"`
+	VPCPairs        []VPCPair       `json:"VPCPairs,omitempty"`
+}
+
+const VPCChunk = "vpcKeepalive"
+
+type VPCPair struct {
+	DomainID  string   `json:"DomainID"`
+	Devices   []string `json:"Devices"`
+	Keepalive []string `json:"Keepalive"`
+}
+
+type VPCPeer struct {
+	DeviceName string
+	DomainID   string
+	SrcIP      string
+	DestIP     string
+}
+
+var UnpairedVPCPeers = struct {
+	sync.Mutex
+	Reported map[VPCPeer]bool
+}{Reported: make(map[VPCPeer]bool)}
+
+// FirstUnpaired tells if a vPC peer without a pair is seen for the first time,
+// so every poll cycle doesn't log it again.
+func FirstUnpaired(Peer VPCPeer) bool {
+	UnpairedVPCPeers.Lock()
+	defer UnpairedVPCPeers.Unlock()
+	if UnpairedVPCPeers.Reported[Peer] {
+		return false
+	}
+	UnpairedVPCPeers.Reported[Peer] = true
+	return true
+}
+
+func DiscoverVPCPairs(RawDataDB RawDataDB) []VPCPair {
+	Peers := make([]VPCPeer, 0)
+	for _, DBEntry := range RawDataDB {
+		for _, item := range DBEntry.DMEChunkMap[VPCChunk] {
+			if item["vpcDom.id"] == nil || item["vpcKeepalive.srcIp"] == nil || item["vpcKeepalive.destIp"] == nil {
+				continue
+			}
+			Peers = append(Peers, VPCPeer{
+				DeviceName: DBEntry.DeviceName,
+				DomainID:   fmt.Sprint(item["vpcDom.id"]),
+				SrcIP:      fmt.Sprint(item["vpcKeepalive.srcIp"]),
+				DestIP:     fmt.Sprint(item["vpcKeepalive.destIp"]),
+			})
+			break
+		}
+	}
+
+	VPCPairs := make([]VPCPair, 0)
+	Paired := make(map[string]bool)
+	for i, a := range Peers {
+		if Paired[a.DeviceName] {
+			continue
+		}
+		for _, b := range Peers[i+1:] {
+			if Paired[b.DeviceName] || a.DomainID != b.DomainID || a.SrcIP != b.DestIP || a.DestIP != b.SrcIP {
+				continue
+			}
+			Paired[a.DeviceName] = true
+			Paired[b.DeviceName] = true
+			VPCPairs = append(VPCPairs, VPCPair{DomainID: a.DomainID, Devices: []string{a.DeviceName, b.DeviceName}, Keepalive: []string{a.SrcIP, b.SrcIP}})
+			break
+		}
+		if !Paired[a.DeviceName] && FirstUnpaired(a) {
+			log.Println("No vPC peer in the inventory for device:", a.DeviceName, "domain", a.DomainID, "keepalive", a.DestIP)
+		}
+	}
+	return VPCPairs
+}
+
+func (p ProcessedData) VPCPeer(DeviceName string) (string, bool) {
+	for _, VPCPair := range p.VPCPairs {
+		if VPCPair.Devices[0] == DeviceName {
+			return VPCPair.Devices[1], true
+		}
+		if VPCPair.Devices[1] == DeviceName {
+			return VPCPair.Devices[0], true
+		}
+	}
+	return "", false
+}
+
+func ConstructProcessedData(ServiceDefinition ServiceDefinition, RawDataDB RawDataDB, srcVal interface{}, ConversionMap cu.ConversionMap) ProcessedData {
+	ServiceDataDB := make(ServiceDataDB, 0)
+	ServiceLayoutDB := make(ServiceLayoutDB, 0)
+
+	ConstructServiceDataDB(&ServiceDataDB, RawDataDB, srcVal, ServiceDefinition.ServiceConstructPath, ConversionMap)
+	ConstructServiceLayout(ServiceDefinition.ServiceComponents, ServiceDataDB, &ServiceLayoutDB)
+	ObserveServiceLayout(ServiceDefinition.ServiceName, fmt.Sprint(srcVal), ServiceLayoutDB)
+
+	var ProcessedData ProcessedData
+	ProcessedData.ServiceDataDB = ServiceDataDB
+	ProcessedData.ServiceLayoutDB = ServiceLayoutDB
+	ProcessedData.ServiceName = ServiceDefinition.ServiceName
+	if VPCPairs := DiscoverVPCPairs(RawDataDB); len(VPCPairs) > 0 {
+		ProcessedData.VPCPairs = VPCPairs
+	}
+
+	return ProcessedData
+}
+
+func ObserveServiceLayout(ServiceName string, InstanceKey string, ServiceLayoutDB ServiceLayoutDB) {
+	Devices := 0
+	Components := make(map[string]int)
+	for _, v := range ServiceLayoutDB {
+		Active := false
+		for _, Component := range v.ServiceLayout {
+			if _, ok := Components[Component.Name]; !ok {
+				Components[Component.Name] = 0
+			}
+			if Component.Value {
+				Components[Component.Name]++
+				Active = true
+			}
+		}
+		if Active {
+			Devices++
+		}
+	}
+	mt.ObserveInstance(ServiceName, InstanceKey, Devices, Components)
 }
@@ -0,0 +1,82 @@
+package modeling
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDiscoverVPCPairs(t *testing.T) {
+	RawDataDB := RawDataDB{
+		{DeviceName: "leaf1", DMEChunkMap: DMEChunkMap{VPCChunk: {{"vpcDom.id": "10", "vpcKeepalive.srcIp": "10.1.1.1", "vpcKeepalive.destIp": "10.1.1.2"}}}},
+		{DeviceName: "leaf2", DMEChunkMap: DMEChunkMap{VPCChunk: {{"vpcDom.id": "10", "vpcKeepalive.srcIp": "10.1.1.2", "vpcKeepalive.destIp": "10.1.1.1"}}}},
+		{DeviceName: "leaf3", DMEChunkMap: DMEChunkMap{VPCChunk: {{"vpcDom.id": "20", "vpcKeepalive.srcIp": "10.1.2.1", "vpcKeepalive.destIp": "10.1.2.2"}}}},
+	}
+
+	var Logged bytes.Buffer
+	log.SetOutput(&Logged)
+	defer log.SetOutput(os.Stderr)
+
+	for Cycle := 0; Cycle < 3; Cycle++ {
+		VPCPairs := DiscoverVPCPairs(RawDataDB)
+		if len(VPCPairs) != 1 || VPCPairs[0].DomainID != "10" || VPCPairs[0].Devices[0] != "leaf1" || VPCPairs[0].Devices[1] != "leaf2" {
+			t.Fatalf("Unexpected vPC pairs: %+v", VPCPairs)
+		}
+	}
+	if Count := strings.Count(Logged.String(), "No vPC peer in the inventory for device: leaf3"); Count != 1 {
+		t.Errorf("Unpaired leaf3 is logged %v times, once is expected:\n%s", Count, Logged.String())
+	}
+}
+
+func TestCheckOperKeys(t *testing.T) {
+	OperKeys := []ComponentKey{
+		{Name: "l2BD.operSt", Value: "up", MatchType: "equal"},
+		{Name: "TABLE_nve_vni.vni-state", Value: "Up", MatchType: "equal"},
+		{Name: "nvoDyPeer.state", Value: "Down", MatchType: "not-contains"},
+	}
+	for _, Case := range []struct {
+		OperData DeviceData
+		Oper     string
+	}{
+		{DeviceData{"l2BD.operSt": "up", "TABLE_nve_vni.vni-state": "Up", "nvoDyPeer.state": []interface{}{"Up"}}, "up"},
+		{DeviceData{"l2BD.operSt": "up"}, "up"},
+		{DeviceData{"l2BD.operSt": "up", "nvoDyPeer.state": []interface{}{"Up", "Down"}}, "down"},
+		{DeviceData{"TABLE_nve_vni.vni-state": "Down"}, "down"},
+		{nil, "unknown"},
+	} {
+		if Oper := CheckOperKeys(OperKeys, Case.OperData); Oper != Case.Oper {
+			t.Errorf("Oper data %v is %v, expected %v", Case.OperData, Oper, Case.Oper)
+		}
+	}
+}
+
+func TestConstructServiceDataDBKeyFormatOperKeys(t *testing.T) {
+	var ServiceConstructPath ServiceConstructPath
+	err := json.Unmarshal([]byte(`[
+		{"ChunkName": "vlan", "KeySName": "vnid", "KeySType": "string", "KeyDName": "vlan.vni", "KeyDType": "string", "KeyLink": "direct", "MatchType": "full", "KeyList": ["vlan.id"]},
+		{"ChunkName": "svi", "KeySName": "vlan.id", "KeyDName": "svi.name", "KeyLink": "indirect", "KeyFormat": "Vlan%v", "MatchType": "full", "KeyList": ["svi.address"], "OperKeyList": ["svi.operSt"]}
+	]`), &ServiceConstructPath)
+	if err != nil {
+		t.Fatalf("Can't decode construct path: %v", err)
+	}
+	RawDataDB := RawDataDB{{DeviceName: "leaf1", DMEChunkMap: DMEChunkMap{
+		"vlan": {{"vlan.vni": "10100", "vlan.id": "100"}},
+		"svi":  {{"svi.name": "Vlan100", "svi.address": "10.1.0.1/24", "svi.operSt": "up"}},
+	}}}
+
+	ServiceDataDB := make(ServiceDataDB, 0)
+	ConstructServiceDataDB(&ServiceDataDB, RawDataDB, "10100", ServiceConstructPath, nil)
+	if len(ServiceDataDB) != 1 {
+		t.Fatalf("Unexpected service data: %+v", ServiceDataDB)
+	}
+	Entry := ServiceDataDB[0]
+	if Entry.DeviceData["svi.address"] != "10.1.0.1/24" || Entry.OperData["svi.operSt"] != "up" {
+		t.Errorf("Unexpected device data %v and oper data %v", Entry.DeviceData, Entry.OperData)
+	}
+	if _, ok := Entry.DeviceData["svi.operSt"]; ok {
+		t.Errorf("Oper key is left in the device data: %v", Entry.DeviceData)
+	}
+}
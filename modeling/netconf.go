@@ -0,0 +1,396 @@
+package modeling
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	mt "n9k-modeling/metrics"
+
+	cu "github.com/achelovekov/collectorutils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const NETCONFDelimiter = "]]>]]>"
+
+const NETCONFHello = `<?xml version="1.0" encoding="UTF-8"?>
+<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <capabilities>
+    <capability>urn:ietf:params:netconf:base:1.0</capability>
+  </capabilities>
+</hello>`
+
+func IsNETCONFHost(hmd cu.HostMetaData) bool {
+	return strings.HasPrefix(hmd.Host.URL, "netconf://")
+}
+
+func NETCONFAddress(hmd cu.HostMetaData) (string, error) {
+	HostURL, err := url.Parse(hmd.Host.URL)
+	if err != nil {
+		return "", err
+	}
+	if HostURL.Port() == "" {
+		return net.JoinHostPort(HostURL.Hostname(), "830"), nil
+	}
+	return HostURL.Host, nil
+}
+
+// NETCONFReadTimeout bounds the wait for the next chunk of a reply, so a
+// stalled device fails its collection instead of hanging it.
+var NETCONFReadTimeout = 60 * time.Second
+
+type NETCONFSession struct {
+	Conn   net.Conn
+	Client *ssh.Client
+	Stdin  io.WriteCloser
+	Stdout io.Reader
+	Buffer bytes.Buffer
+}
+
+// NETCONFKnownHosts is the known_hosts file the device host key is checked
+// against: ~/.ssh/known_hosts, or the file a host URL names with ?knownhosts=.
+func NETCONFKnownHosts(hmd cu.HostMetaData) (string, error) {
+	HostURL, err := url.Parse(hmd.Host.URL)
+	if err != nil {
+		return "", err
+	}
+	if File := HostURL.Query().Get("knownhosts"); File != "" {
+		return File, nil
+	}
+	Home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(Home, ".ssh", "known_hosts"), nil
+}
+
+func NETCONFDial(hmd cu.HostMetaData) (*NETCONFSession, error) {
+	Address, err := NETCONFAddress(hmd)
+	if err != nil {
+		return nil, err
+	}
+	KnownHosts, err := NETCONFKnownHosts(hmd)
+	if err != nil {
+		return nil, err
+	}
+	HostKeyCallback, err := knownhosts.New(KnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("Can't load known hosts: %v", err)
+	}
+
+	SSHConfig := &ssh.ClientConfig{
+		User:            hmd.Host.Username,
+		Auth:            []ssh.AuthMethod{ssh.Password(hmd.Host.Password)},
+		HostKeyCallback: HostKeyCallback,
+		Timeout:         30 * time.Second,
+	}
+	Conn, err := net.DialTimeout("tcp", Address, SSHConfig.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	Conn.SetDeadline(time.Now().Add(NETCONFReadTimeout))
+	ClientConn, Channels, Requests, err := ssh.NewClientConn(Conn, Address, SSHConfig)
+	if err != nil {
+		Conn.Close()
+		return nil, err
+	}
+	Conn.SetDeadline(time.Time{})
+	Client := ssh.NewClient(ClientConn, Channels, Requests)
+
+	Session, err := Client.NewSession()
+	if err != nil {
+		Client.Close()
+		return nil, err
+	}
+	Stdin, err := Session.StdinPipe()
+	if err != nil {
+		Client.Close()
+		return nil, err
+	}
+	Stdout, err := Session.StdoutPipe()
+	if err != nil {
+		Client.Close()
+		return nil, err
+	}
+	if err := Session.RequestSubsystem("netconf"); err != nil {
+		Client.Close()
+		return nil, err
+	}
+
+	NETCONFSession := &NETCONFSession{Conn: Conn, Client: Client, Stdin: Stdin, Stdout: Stdout}
+	if _, err := NETCONFSession.Receive(); err != nil {
+		Client.Close()
+		return nil, fmt.Errorf("No NETCONF hello from device: %v", err)
+	}
+	if err := NETCONFSession.Send(NETCONFHello); err != nil {
+		Client.Close()
+		return nil, err
+	}
+
+	return NETCONFSession, nil
+}
+
+func (s *NETCONFSession) Send(Message string) error {
+	_, err := io.WriteString(s.Stdin, Message+NETCONFDelimiter)
+	return err
+}
+
+func (s *NETCONFSession) Receive() ([]byte, error) {
+	Chunk := make([]byte, 32*1024)
+	for {
+		if Index := bytes.Index(s.Buffer.Bytes(), []byte(NETCONFDelimiter)); Index >= 0 {
+			Message := make([]byte, Index)
+			copy(Message, s.Buffer.Next(Index))
+			s.Buffer.Next(len(NETCONFDelimiter))
+			s.Conn.SetReadDeadline(time.Time{})
+			return Message, nil
+		}
+		Deadline := time.Now().Add(NETCONFReadTimeout)
+		s.Conn.SetReadDeadline(Deadline)
+		n, err := s.Stdout.Read(Chunk)
+		s.Buffer.Write(Chunk[:n])
+		if err != nil {
+			if !time.Now().Before(Deadline) {
+				return nil, fmt.Errorf("No NETCONF data within %v", NETCONFReadTimeout)
+			}
+			return nil, err
+		}
+	}
+}
+
+func (s *NETCONFSession) Close() {
+	s.Send(`<rpc message-id="close" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><close-session/></rpc>`)
+	s.Client.Close()
+}
+
+func NETCONFGetConfig(Filter string) string {
+	FilterElement := ""
+	if Filter != "" {
+		FilterElement = `<filter type="subtree">` + Filter + `</filter>`
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<rpc message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <get-config>
+    <source><running/></source>` + FilterElement + `
+  </get-config>
+</rpc>`
+}
+
+func NETCONFCall(hmd cu.HostMetaData, Filter string) (map[string]interface{}, error) {
+	src := make(map[string]interface{})
+
+	NETCONFSession, err := NETCONFDial(hmd)
+	if err != nil {
+		mt.ObserveError(hmd.Host.Hostname, "unreachable")
+		return src, fmt.Errorf("Can't open NETCONF session to device: %v: %v", hmd.Host.Hostname, err)
+	}
+	defer NETCONFSession.Close()
+
+	Start := time.Now()
+	if err := NETCONFSession.Send(NETCONFGetConfig(Filter)); err != nil {
+		mt.ObserveError(hmd.Host.Hostname, "fetch")
+		return src, fmt.Errorf("Can't send NETCONF request to device: %v: %v", hmd.Host.Hostname, err)
+	}
+	Reply, err := NETCONFSession.Receive()
+	if err != nil {
+		mt.ObserveError(hmd.Host.Hostname, "fetch")
+		return src, fmt.Errorf("Can't read NETCONF reply from device: %v: %v", hmd.Host.Hostname, err)
+	}
+	mt.ObserveRequest(hmd.Host.Hostname, mt.BackendNETCONF, "get-config", Start, len(Reply))
+
+	src, err = NETCONFReplyToMap(Reply)
+	if err != nil {
+		mt.ObserveError(hmd.Host.Hostname, "decode")
+		return src, fmt.Errorf("Can't parse NETCONF reply from device: %v: %v", hmd.Host.Hostname, err)
+	}
+
+	return src, nil
+}
+
+type XMLElement struct {
+	Name     string
+	Text     string
+	Children []*XMLElement
+}
+
+func ParseXML(Data []byte) (*XMLElement, error) {
+	Decoder := xml.NewDecoder(bytes.NewReader(Data))
+	Decoder.CharsetReader = Latin1Reader
+	Stack := make([]*XMLElement, 0)
+	var Root *XMLElement
+	for {
+		Token, err := Decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch Token := Token.(type) {
+		case xml.StartElement:
+			Element := &XMLElement{Name: Token.Name.Local}
+			if len(Stack) > 0 {
+				Parent := Stack[len(Stack)-1]
+				Parent.Children = append(Parent.Children, Element)
+			} else if Root == nil {
+				Root = Element
+			}
+			Stack = append(Stack, Element)
+		case xml.EndElement:
+			Stack = Stack[:len(Stack)-1]
+		case xml.CharData:
+			if len(Stack) > 0 {
+				Stack[len(Stack)-1].Text += strings.TrimSpace(string(Token))
+			}
+		}
+	}
+	if Root == nil {
+		return nil, errors.New("Empty XML document")
+	}
+	return Root, nil
+}
+
+func Latin1Reader(Charset string, Input io.Reader) (io.Reader, error) {
+	if !strings.EqualFold(Charset, "ISO-8859-1") && !strings.EqualFold(Charset, "latin1") {
+		return nil, fmt.Errorf("Unsupported charset %v", Charset)
+	}
+	Data, err := ioutil.ReadAll(Input)
+	if err != nil {
+		return nil, err
+	}
+	Runes := make([]rune, len(Data))
+	for i, b := range Data {
+		Runes[i] = rune(b)
+	}
+	return strings.NewReader(string(Runes)), nil
+}
+
+func (e *XMLElement) Child(Name string) *XMLElement {
+	for _, Child := range e.Children {
+		if Child.Name == Name {
+			return Child
+		}
+	}
+	return nil
+}
+
+func NETCONFReplyToMap(Reply []byte) (map[string]interface{}, error) {
+	Root, err := ParseXML(Reply)
+	if err != nil {
+		return nil, err
+	}
+	if Error := Root.Child("rpc-error"); Error != nil {
+		Message := Error.Child("error-message")
+		if Message != nil {
+			return nil, errors.New(Message.Text)
+		}
+		return nil, errors.New("rpc-error")
+	}
+	Data := Root.Child("data")
+	if Data == nil {
+		return nil, errors.New("NETCONF reply has no data")
+	}
+	src := XMLToDME(Data.Children)
+	NormalizeAttributes(src)
+	return src, nil
+}
+
+// XMLToDME shapes an XML tree like a DME response: every element becomes a
+// class with "attributes" and "children", so path files work the same way
+// for both backends. NX-OS __XML__PARAM__ wrappers and text-only elements
+// become attributes of their parent, empty elements become "true" flags.
+func XMLToDME(Elements []*XMLElement) map[string]interface{} {
+	Top := make(map[string]interface{})
+	for _, Element := range Elements {
+		Top[Element.Name] = XMLElementToDME(Element)
+	}
+	return Top
+}
+
+func XMLElementToDME(Element *XMLElement) map[string]interface{} {
+	Attributes := make(map[string]interface{})
+	Children := make([]interface{}, 0)
+	FillDMENode(Element, Attributes, &Children)
+
+	Node := map[string]interface{}{"attributes": Attributes}
+	if len(Children) > 0 {
+		Node["children"] = Children
+	}
+	return Node
+}
+
+func FillDMENode(Element *XMLElement, Attributes map[string]interface{}, Children *[]interface{}) {
+	for _, Child := range Element.Children {
+		switch {
+		case strings.HasPrefix(Child.Name, "__XML__PARAM__"):
+			Name := strings.TrimPrefix(Child.Name, "__XML__PARAM__")
+			if Value := Child.Child("__XML__value"); Value != nil {
+				Attributes[Name] = Value.Text
+			}
+			FillDMENode(Child, Attributes, Children)
+		case Child.Name == "__XML__value":
+		case len(Child.Children) == 0 && Child.Text != "":
+			Attributes[Child.Name] = Child.Text
+		case len(Child.Children) == 0:
+			Attributes[Child.Name] = "true"
+		default:
+			*Children = append(*Children, map[string]interface{}{Child.Name: XMLElementToDME(Child)})
+		}
+	}
+}
+
+// NormalizeAttributes gives every node of a class the same attribute set, the
+// way DME objects always carry all of their properties. Flattening reuses the
+// row header between siblings, so a flag missing on one node would otherwise
+// be inherited from the node before it.
+func NormalizeAttributes(src map[string]interface{}) {
+	Classes := make(map[string]map[string]string)
+	WalkDMENodes(src, func(Class string, Attributes map[string]interface{}) {
+		if _, ok := Classes[Class]; !ok {
+			Classes[Class] = make(map[string]string)
+		}
+		for Name, Value := range Attributes {
+			if Value == "true" {
+				Classes[Class][Name] = "false"
+			} else if _, ok := Classes[Class][Name]; !ok {
+				Classes[Class][Name] = ""
+			}
+		}
+	})
+	WalkDMENodes(src, func(Class string, Attributes map[string]interface{}) {
+		for Name, Default := range Classes[Class] {
+			if _, ok := Attributes[Name]; !ok {
+				Attributes[Name] = Default
+			}
+		}
+	})
+}
+
+func WalkDMENodes(src map[string]interface{}, Visit func(string, map[string]interface{})) {
+	for Class, v := range src {
+		Node, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if Attributes, ok := Node["attributes"].(map[string]interface{}); ok {
+			Visit(Class, Attributes)
+		}
+		if Children, ok := Node["children"].([]interface{}); ok {
+			for _, Child := range Children {
+				if Child, ok := Child.(map[string]interface{}); ok {
+					WalkDMENodes(Child, Visit)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package modeling
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cu "github.com/achelovekov/collectorutils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ReferenceReply turns the get-config filter of references/reference_1.json
+// into the XML reply an NX-OS device sends for it.
+func ReferenceReply(t *testing.T) []byte {
+	Data, err := ioutil.ReadFile("references/reference_1.json")
+	if err != nil {
+		t.Fatalf("Can't read the reference: %v", err)
+	}
+	var Reference struct {
+		Filter json.RawMessage `json:"nf:filter"`
+	}
+	if err := json.Unmarshal(Data, &Reference); err != nil {
+		t.Fatalf("Can't decode the reference: %v", err)
+	}
+
+	var Reply bytes.Buffer
+	Reply.WriteString(`<?xml version="1.0" encoding="ISO-8859-1"?>` + "\n")
+	Reply.WriteString(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data>`)
+	Decoder := json.NewDecoder(bytes.NewReader(Reference.Filter))
+	Decoder.UseNumber()
+	if err := JSONToXML(Decoder, "", &Reply); err != nil {
+		t.Fatalf("Can't convert the reference to XML: %v", err)
+	}
+	Reply.WriteString(`</data></rpc-reply>`)
+	return Reply.Bytes()
+}
+
+// JSONToXML writes the next JSON value as the content of element Name, keeping
+// the order of the keys. Arrays repeat the element, null is an empty element.
+func JSONToXML(Decoder *json.Decoder, Name string, Out *bytes.Buffer) error {
+	Token, err := Decoder.Token()
+	if err != nil {
+		return err
+	}
+	Name = Name[strings.Index(Name, ":")+1:]
+	switch Token := Token.(type) {
+	case json.Delim:
+		if Token == '[' {
+			for Decoder.More() {
+				if err := JSONToXML(Decoder, Name, Out); err != nil {
+					return err
+				}
+			}
+			_, err := Decoder.Token()
+			return err
+		}
+		if Name != "" {
+			Out.WriteString("<" + Name + ">")
+		}
+		for Decoder.More() {
+			Key, err := Decoder.Token()
+			if err != nil {
+				return err
+			}
+			if err := JSONToXML(Decoder, Key.(string), Out); err != nil {
+				return err
+			}
+		}
+		if _, err := Decoder.Token(); err != nil {
+			return err
+		}
+		if Name != "" {
+			Out.WriteString("</" + Name + ">")
+		}
+	case nil:
+		Out.WriteString("<" + Name + "/>")
+	default:
+		Out.WriteString("<" + Name + ">")
+		xml.EscapeText(Out, []byte(ToText(Token)))
+		Out.WriteString("</" + Name + ">")
+	}
+	return nil
+}
+
+func ToText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return ""
+}
+
+// StartNETCONFStandIn serves a NETCONF subsystem over SSH on a local port. It
+// answers every rpc with Reply, or never answers when Reply is nil.
+func StartNETCONFStandIn(t *testing.T, Reply []byte) (string, ssh.PublicKey) {
+	Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Can't generate a host key: %v", err)
+	}
+	Signer, err := ssh.NewSignerFromKey(Key)
+	if err != nil {
+		t.Fatalf("Can't use the host key: %v", err)
+	}
+	Config := &ssh.ServerConfig{PasswordCallback: func(Conn ssh.ConnMetadata, Password []byte) (*ssh.Permissions, error) {
+		if Conn.User() == "admin" && string(Password) == "secret" {
+			return nil, nil
+		}
+		return nil, errors.New("Permission denied")
+	}}
+	Config.AddHostKey(Signer)
+
+	Listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Can't listen: %v", err)
+	}
+	t.Cleanup(func() { Listener.Close() })
+	go func() {
+		for {
+			Conn, err := Listener.Accept()
+			if err != nil {
+				return
+			}
+			go ServeNETCONFStandIn(Conn, Config, Reply)
+		}
+	}()
+	return Listener.Addr().String(), Signer.PublicKey()
+}
+
+func ServeNETCONFStandIn(Conn net.Conn, Config *ssh.ServerConfig, Reply []byte) {
+	ServerConn, Channels, Requests, err := ssh.NewServerConn(Conn, Config)
+	if err != nil {
+		return
+	}
+	defer ServerConn.Close()
+	go ssh.DiscardRequests(Requests)
+	for NewChannel := range Channels {
+		Channel, Requests, err := NewChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for Request := range Requests {
+				Request.Reply(Request.Type == "subsystem", nil)
+				if Request.Type == "subsystem" {
+					go ServeNETCONFChannel(Channel, Reply)
+				}
+			}
+		}()
+	}
+}
+
+func ServeNETCONFChannel(Channel ssh.Channel, Reply []byte) {
+	defer Channel.Close()
+	io.WriteString(Channel, `<?xml version="1.0"?><hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities><session-id>1</session-id></hello>`+NETCONFDelimiter)
+	Session := &NETCONFSession{Stdout: Channel}
+	if _, err := ReceiveStandIn(Session); err != nil {
+		return
+	}
+	for {
+		Message, err := ReceiveStandIn(Session)
+		if err != nil || bytes.Contains(Message, []byte("close-session")) {
+			return
+		}
+		if Reply == nil {
+			continue
+		}
+		Channel.Write(Reply)
+		io.WriteString(Channel, NETCONFDelimiter)
+	}
+}
+
+func ReceiveStandIn(s *NETCONFSession) ([]byte, error) {
+	Chunk := make([]byte, 32*1024)
+	for {
+		if Index := bytes.Index(s.Buffer.Bytes(), []byte(NETCONFDelimiter)); Index >= 0 {
+			Message := append([]byte(nil), s.Buffer.Next(Index)...)
+			s.Buffer.Next(len(NETCONFDelimiter))
+			return Message, nil
+		}
+		n, err := s.Stdout.Read(Chunk)
+		s.Buffer.Write(Chunk[:n])
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func WriteKnownHosts(t *testing.T, Address string, HostKey ssh.PublicKey) string {
+	File := filepath.Join(t.TempDir(), "known_hosts")
+	if err := ioutil.WriteFile(File, []byte(knownhosts.Line([]string{knownhosts.Normalize(Address)}, HostKey)+"\n"), 0600); err != nil {
+		t.Fatalf("Can't write known hosts: %v", err)
+	}
+	return File
+}
+
+func NETCONFHost(Name string, Address string, KnownHosts string) cu.HostMetaData {
+	var hmd cu.HostMetaData
+	hmd.Host.Hostname = Name
+	hmd.Host.URL = "netconf://" + Address + "?knownhosts=" + KnownHosts
+	hmd.Host.Username = "admin"
+	hmd.Host.Password = "secret"
+	return hmd
+}
+
+// LoadTestService reads a service definition of the repository root with its
+// path files resolved from this package.
+func LoadTestService(t *testing.T, fileName string) (ServiceDefinition, *MetaData) {
+	ServiceDefinition := LoadServiceDefinition(filepath.Join("..", fileName))
+	if ServiceDefinition.ServiceName == "" {
+		t.Fatalf("Can't load service definition %v", fileName)
+	}
+	for i := range ServiceDefinition.DMEProcessing {
+		for j := range ServiceDefinition.DMEProcessing[i].Paths {
+			ServiceDefinition.DMEProcessing[i].Paths[j].Path = filepath.Join("..", ServiceDefinition.DMEProcessing[i].Paths[j].Path)
+		}
+	}
+	MetaData := &MetaData{
+		KeysMap:       LoadKeysMap(ServiceDefinition.DMEProcessing),
+		GNMIMap:       LoadGNMIMap(ServiceDefinition.GNMIProcessing),
+		PropInclude:   ServiceDefinition.PropInclude,
+		NETCONFFilter: ServiceDefinition.NETCONFFilter,
+		ConversionMap: cu.CreateConversionMap(),
+	}
+	return ServiceDefinition, MetaData
+}
+
+func LayoutOf(ProcessedData ProcessedData, DeviceName string) map[string]bool {
+	Layout := make(map[string]bool)
+	for _, v := range ProcessedData.ServiceLayoutDB {
+		if v.DeviceName != DeviceName {
+			continue
+		}
+		for _, Component := range v.ServiceLayout {
+			Layout[Component.Name] = Component.Value
+		}
+	}
+	return Layout
+}
+
+func TestNETCONFCollection(t *testing.T) {
+	Address, HostKey := StartNETCONFStandIn(t, ReferenceReply(t))
+	KnownHosts := WriteKnownHosts(t, Address, HostKey)
+	ServiceDefinition, MetaData := LoadTestService(t, "VNI-NETCONF.service")
+
+	RawDataDB := CollectRawDataDB(MetaData, cu.Inventory{NETCONFHost("leaf1", Address, KnownHosts)}, "sys")
+	if len(RawDataDB) != 1 {
+		t.Fatalf("Device is not collected over NETCONF")
+	}
+	ProcessedData := ConstructProcessedData(ServiceDefinition, RawDataDB, "2032515", MetaData.ConversionMap)
+	if len(ProcessedData.ServiceDataDB) != 1 {
+		t.Fatalf("Unexpected service data: %+v", ProcessedData.ServiceDataDB)
+	}
+	DeviceData := ProcessedData.ServiceDataDB[0].DeviceData
+	for Key, Value := range map[string]string{
+		"interface.interface":       "Vlan2515",
+		"address.ip-prefix":         "10.115.129.250/23",
+		"member.vrf-name":           "iMZ",
+		"mcast-group.maddr1":        "225.1.0.3",
+		"import.ext-comm-rt-aa2nn4": "64998:2032515",
+		"export.ext-comm-rt-aa2nn4": "64998:2032515",
+	} {
+		if fmt.Sprint(DeviceData[Key]) != Value {
+			t.Errorf("Device data %v is %v, expected %v", Key, DeviceData[Key], Value)
+		}
+	}
+	Layout := LayoutOf(ProcessedData, "leaf1")
+	for Component, Value := range map[string]bool{"L2VNI": true, "AGW": true, "PIM": true, "IR": false, "ARP-Suppress": false} {
+		if Layout[Component] != Value {
+			t.Errorf("Component %v is %v, expected %v", Component, Layout[Component], Value)
+		}
+	}
+}
+
+func TestNETCONFUnknownHostKey(t *testing.T) {
+	Address, _ := StartNETCONFStandIn(t, ReferenceReply(t))
+	_, OtherKey := StartNETCONFStandIn(t, nil)
+	KnownHosts := WriteKnownHosts(t, Address, OtherKey)
+
+	if _, err := NETCONFCall(NETCONFHost("leaf1", Address, KnownHosts), ""); err == nil {
+		t.Errorf("Device with an unknown host key is collected")
+	}
+}
+
+func TestNETCONFReadTimeout(t *testing.T) {
+	Address, HostKey := StartNETCONFStandIn(t, nil)
+	KnownHosts := WriteKnownHosts(t, Address, HostKey)
+
+	Timeout := NETCONFReadTimeout
+	NETCONFReadTimeout = 200 * time.Millisecond
+	defer func() { NETCONFReadTimeout = Timeout }()
+
+	Done := make(chan error, 1)
+	go func() {
+		_, err := NETCONFCall(NETCONFHost("leaf1", Address, KnownHosts), "")
+		Done <- err
+	}()
+	select {
+	case err := <-Done:
+		if err == nil || !strings.Contains(err.Error(), "No NETCONF data within") {
+			t.Errorf("Unexpected error from a stalled device: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Collection hangs on a stalled device")
+	}
+}
@@ -0,0 +1,73 @@
+package modeling
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+func IsFileHost(hmd cu.HostMetaData) bool {
+	return strings.HasPrefix(hmd.Host.URL, "file://")
+}
+
+// LoadOfflineData reads a saved /api/mo/sys.json?rsp-subtree=full reply or a
+// "show running-config" text file given as a file:// inventory URL.
+func LoadOfflineData(hmd cu.HostMetaData) (map[string]interface{}, error) {
+	FileName := strings.TrimPrefix(hmd.Host.URL, "file://")
+	Data, err := ioutil.ReadFile(FileName)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read offline data for device: %v: %v", hmd.Host.Hostname, err)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(Data), []byte("{")) {
+		src := make(map[string]interface{})
+		if err := json.Unmarshal(Data, &src); err != nil {
+			return nil, fmt.Errorf("Can't decode DME data for device: %v: %v", hmd.Host.Hostname, err)
+		}
+		return src, nil
+	}
+
+	return RunningConfigToDME(string(Data)), nil
+}
+
+// LoadOfflineInventory turns every file of a directory into an inventory entry
+// named after the file, e.g. leaf1.json or leaf1.cfg becomes device leaf1.
+// Two files of one device, like leaf1.json and leaf1.cfg, are an error.
+func LoadOfflineInventory(dirName string) (cu.Inventory, error) {
+	Files, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		return nil, err
+	}
+	AbsDir, err := filepath.Abs(dirName)
+	if err != nil {
+		return nil, err
+	}
+
+	Inventory := make(cu.Inventory, 0)
+	FileNames := make(map[string]string)
+	for _, File := range Files {
+		if File.IsDir() || strings.HasPrefix(File.Name(), ".") {
+			continue
+		}
+		var hmd cu.HostMetaData
+		hmd.Host.Hostname = strings.TrimSuffix(File.Name(), filepath.Ext(File.Name()))
+		if Other, ok := FileNames[hmd.Host.Hostname]; ok {
+			return nil, fmt.Errorf("Device %v has two files in %v: %v and %v", hmd.Host.Hostname, dirName, Other, File.Name())
+		}
+		FileNames[hmd.Host.Hostname] = File.Name()
+		hmd.Host.URL = "file://" + filepath.Join(AbsDir, File.Name())
+		Inventory = append(Inventory, hmd)
+	}
+	if len(Inventory) == 0 {
+		return nil, fmt.Errorf("No device files in %v", dirName)
+	}
+	sort.Slice(Inventory, func(i, j int) bool { return Inventory[i].Host.Hostname < Inventory[j].Host.Hostname })
+
+	return Inventory, nil
+}
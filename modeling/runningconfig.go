@@ -0,0 +1,390 @@
+package modeling
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type ConfigLine struct {
+	Text     string
+	Children []*ConfigLine
+}
+
+func ParseConfigLines(Text string) []*ConfigLine {
+	type Level struct {
+		Indent int
+		Line   *ConfigLine
+	}
+	Root := &ConfigLine{}
+	Stack := []Level{{Indent: -1, Line: Root}}
+
+	for _, Raw := range strings.Split(strings.Replace(Text, "\r", "", -1), "\n") {
+		Trimmed := strings.TrimSpace(Raw)
+		if Trimmed == "" || strings.HasPrefix(Trimmed, "!") {
+			continue
+		}
+		Indent := len(Raw) - len(strings.TrimLeft(Raw, " \t"))
+		for Stack[len(Stack)-1].Indent >= Indent {
+			Stack = Stack[:len(Stack)-1]
+		}
+		Line := &ConfigLine{Text: Trimmed}
+		Parent := Stack[len(Stack)-1].Line
+		Parent.Children = append(Parent.Children, Line)
+		Stack = append(Stack, Level{Indent: Indent, Line: Line})
+	}
+
+	return Root.Children
+}
+
+func (l *ConfigLine) Fields() []string {
+	return strings.Fields(l.Text)
+}
+
+func (l *ConfigLine) HasPrefix(Prefix string) bool {
+	return l.Text == Prefix || strings.HasPrefix(l.Text, Prefix+" ")
+}
+
+func (l *ConfigLine) Arg(Prefix string) string {
+	return strings.TrimSpace(strings.TrimPrefix(l.Text, Prefix))
+}
+
+type DMEObject struct {
+	Class      string
+	Attributes map[string]interface{}
+	Children   []*DMEObject
+}
+
+// Entry returns the child of the given class whose attributes match Keys and
+// creates it when there is none, so repeated config blocks for the same object
+// update one DME node.
+func (o *DMEObject) Entry(Class string, Keys map[string]interface{}) (*DMEObject, bool) {
+	for _, Child := range o.Children {
+		if Child.Class != Class {
+			continue
+		}
+		Match := true
+		for Name, Value := range Keys {
+			if Child.Attributes[Name] != Value {
+				Match = false
+				break
+			}
+		}
+		if Match {
+			return Child, false
+		}
+	}
+	Child := &DMEObject{Class: Class, Attributes: make(map[string]interface{})}
+	for Name, Value := range Keys {
+		Child.Attributes[Name] = Value
+	}
+	o.Children = append(o.Children, Child)
+	return Child, true
+}
+
+func (o *DMEObject) Container(Classes ...string) *DMEObject {
+	Current := o
+	for _, Class := range Classes {
+		Current, _ = Current.Entry(Class, nil)
+	}
+	return Current
+}
+
+func (o *DMEObject) ToDME() map[string]interface{} {
+	Node := map[string]interface{}{"attributes": o.Attributes}
+	if len(o.Children) > 0 {
+		Children := make([]interface{}, 0)
+		for _, Child := range o.Children {
+			Children = append(Children, Child.ToDME())
+		}
+		Node["children"] = Children
+	}
+	return map[string]interface{}{o.Class: Node}
+}
+
+// RunningConfigToDME builds the part of the DME tree the VNI service reads
+// from "show running-config" text: VLANs with their vn-segment, SVIs, the nve
+// interface and its members, EVPN VNIs, multisite, vPC keepalive and the BGP
+// instance. The result has the same shape as a saved /api/mo/sys.json reply,
+// so the regular path files flatten it into the same rows.
+func RunningConfigToDME(Text string) map[string]interface{} {
+	System := &DMEObject{Class: "topSystem", Attributes: make(map[string]interface{})}
+
+	for _, Line := range ParseConfigLines(Text) {
+		Fields := Line.Fields()
+		switch {
+		case Line.HasPrefix("hostname") && len(Fields) > 1:
+			System.Attributes["name"] = Fields[1]
+		case Line.HasPrefix("vlan") && len(Fields) == 2:
+			for _, ID := range ExpandRange(Fields[1]) {
+				ConfigVLAN(System, ID, Line)
+			}
+		case Line.HasPrefix("interface") && len(Fields) == 2:
+			ConfigInterface(System, Fields[1], Line)
+		case Line.HasPrefix("evpn multisite border-gateway") && len(Fields) == 4:
+			ConfigMultisite(System, Fields[3], Line)
+		case Line.Text == "evpn":
+			ConfigEVPN(System, Line)
+		case Line.HasPrefix("router bgp") && len(Fields) == 3:
+			Inst := System.Container("bgpEntity", "bgpInst")
+			Inst.Attributes["asn"] = Fields[2]
+		case Line.HasPrefix("vpc domain") && len(Fields) == 3:
+			ConfigVPCDomain(System, Fields[2], Line)
+		}
+	}
+
+	return map[string]interface{}{"imdata": []interface{}{System.ToDME()}, "totalCount": "1"}
+}
+
+func ConfigVLAN(System *DMEObject, ID string, Line *ConfigLine) {
+	VLAN, Created := System.Container("bdEntity").Entry("l2BD", map[string]interface{}{"id": ID})
+	if Created {
+		Number, _ := strconv.Atoi(ID)
+		VLAN.Attributes["name"] = fmt.Sprintf("VLAN%04d", Number)
+		VLAN.Attributes["accEncap"] = "unknown"
+		VLAN.Attributes["fabEncap"] = "vlan-" + ID
+	}
+	for _, Child := range Line.Children {
+		switch {
+		case Child.HasPrefix("name"):
+			VLAN.Attributes["name"] = Child.Arg("name")
+		case Child.HasPrefix("vn-segment"):
+			VLAN.Attributes["accEncap"] = "vxlan-" + Child.Arg("vn-segment")
+		}
+	}
+}
+
+func ConfigInterface(System *DMEObject, Name string, Line *ConfigLine) {
+	ID := ToDMEInterfaceName(Name)
+	switch {
+	case strings.HasPrefix(ID, "vlan"):
+		ConfigSVI(System, ID, Line)
+	case strings.HasPrefix(ID, "nve"):
+		ConfigNVE(System, ID, Line)
+	case strings.HasPrefix(ID, "eth"):
+		for _, Child := range Line.Children {
+			if Child.HasPrefix("evpn multisite") {
+				PhysIf, _ := System.Container("interfaceEntity").Entry("l1PhysIf", map[string]interface{}{"id": ID})
+				Tracking, _ := PhysIf.Entry("nvoEvpnMultisiteIfTracking", nil)
+				Tracking.Attributes["tracking"] = Child.Arg("evpn multisite")
+			}
+		}
+	}
+}
+
+func ConfigSVI(System *DMEObject, ID string, Line *ConfigLine) {
+	SVI, _ := System.Container("interfaceEntity").Entry("sviIf", map[string]interface{}{"id": ID})
+	SVI.Attributes["vlanId"] = strings.TrimPrefix(ID, "vlan")
+	SVI.Attributes["adminSt"] = "down"
+
+	VRF := "default"
+	Addresses := make([][]string, 0)
+	for _, Child := range Line.Children {
+		Fields := Child.Fields()
+		switch {
+		case Child.Text == "no shutdown":
+			SVI.Attributes["adminSt"] = "up"
+		case Child.HasPrefix("vrf member") && len(Fields) == 3:
+			VRF = Fields[2]
+		case Child.HasPrefix("ip address") && len(Fields) >= 3:
+			Addresses = append(Addresses, Fields[2:])
+		case Child.Text == "fabric forwarding mode anycast-gateway":
+			FwdIf, _ := System.Container("hmmEntity", "hmmFwdInst").Entry("hmmFwdIf", map[string]interface{}{"id": ID})
+			FwdIf.Attributes["mode"] = "anycastGW"
+		}
+	}
+
+	VrfMbr, _ := SVI.Entry("nwRtVrfMbr", nil)
+	VrfMbr.Attributes["tDn"] = "sys/inst-" + VRF
+
+	for _, Address := range Addresses {
+		Dom, _ := System.Container("ipv4Entity", "ipv4Inst").Entry("ipv4Dom", map[string]interface{}{"name": VRF})
+		If, _ := Dom.Entry("ipv4If", map[string]interface{}{"id": ID})
+		Addr, _ := If.Entry("ipv4Addr", map[string]interface{}{"addr": Address[0]})
+		Addr.Attributes["type"] = "primary"
+		Addr.Attributes["tag"] = "0"
+		for i := 1; i < len(Address)-1; i++ {
+			switch Address[i] {
+			case "tag":
+				Addr.Attributes["tag"] = Address[i+1]
+			}
+		}
+		if len(Address) > 1 && Address[1] == "secondary" {
+			Addr.Attributes["type"] = "secondary"
+		}
+	}
+}
+
+func ConfigNVE(System *DMEObject, ID string, Line *ConfigLine) {
+	Ep, _ := System.Container("nvoEps").Entry("nvoEp", map[string]interface{}{"epId": strings.TrimPrefix(ID, "nve")})
+	Ep.Attributes["adminSt"] = "disabled"
+	Ep.Attributes["sourceInterface"] = "unspecified"
+	Ep.Attributes["hostReach"] = "Flood_and_learn"
+	Ep.Attributes["multisiteBordergwInterface"] = "unspecified"
+	Ep.Attributes["advertiseVmac"] = "no"
+
+	for _, Child := range Line.Children {
+		Fields := Child.Fields()
+		switch {
+		case Child.Text == "no shutdown":
+			Ep.Attributes["adminSt"] = "enabled"
+		case Child.HasPrefix("source-interface") && len(Fields) == 2:
+			Ep.Attributes["sourceInterface"] = ToDMEInterfaceName(Fields[1])
+		case Child.Text == "host-reachability protocol bgp":
+			Ep.Attributes["hostReach"] = "bgp"
+		case Child.HasPrefix("multisite border-gateway interface") && len(Fields) == 4:
+			Ep.Attributes["multisiteBordergwInterface"] = ToDMEInterfaceName(Fields[3])
+		case Child.Text == "advertise virtual-rmac":
+			Ep.Attributes["advertiseVmac"] = "yes"
+		case Child.HasPrefix("member vni") && len(Fields) >= 3:
+			for _, VNI := range ExpandRange(Fields[2]) {
+				ConfigNVEMember(Ep, VNI, Child, len(Fields) > 3 && Fields[3] == "associate-vrf")
+			}
+		}
+	}
+}
+
+func ConfigNVEMember(Ep *DMEObject, VNI string, Line *ConfigLine, AssociateVRF bool) {
+	Nw, _ := Ep.Container("nvoNws").Entry("nvoNw", map[string]interface{}{"vni": VNI})
+	Nw.Attributes["associateVrfFlag"] = "no"
+	if AssociateVRF {
+		Nw.Attributes["associateVrfFlag"] = "yes"
+	}
+	Nw.Attributes["mcastGroup"] = "0.0.0.0"
+	Nw.Attributes["suppressARP"] = "off"
+	Nw.Attributes["multisiteIngRepl"] = "disable"
+
+	for _, Child := range Line.Children {
+		Fields := Child.Fields()
+		switch {
+		case Child.HasPrefix("mcast-group") && len(Fields) >= 2:
+			Nw.Attributes["mcastGroup"] = Fields[1]
+		case Child.Text == "suppress-arp":
+			Nw.Attributes["suppressARP"] = "enabled"
+		case Child.Text == "multisite ingress-replication":
+			Nw.Attributes["multisiteIngRepl"] = "enable"
+		case Child.HasPrefix("ingress-replication protocol") && len(Fields) == 3:
+			IngRepl, _ := Nw.Entry("nvoIngRepl", nil)
+			IngRepl.Attributes["proto"] = Fields[2]
+			IngRepl.Attributes["rn"] = "IngRepl"
+		}
+	}
+}
+
+func ConfigEVPN(System *DMEObject, Line *ConfigLine) {
+	for _, Child := range Line.Children {
+		Fields := Child.Fields()
+		if !Child.HasPrefix("vni") || len(Fields) != 3 || Fields[2] != "l2" {
+			continue
+		}
+		BDEvi, _ := System.Container("rtctrlL2Evpn").Entry("rtctrlBDEvi", map[string]interface{}{"encap": "vxlan-" + Fields[1]})
+		for _, Entry := range Child.Children {
+			Fields := Entry.Fields()
+			switch {
+			case Entry.HasPrefix("rd") && len(Fields) == 2:
+				BDEvi.Attributes["rd"] = ToDMERouteDistinguisher(Fields[1])
+			case Entry.HasPrefix("route-target") && len(Fields) == 3:
+				Types := []string{Fields[1]}
+				if Fields[1] == "both" {
+					Types = []string{"import", "export"}
+				}
+				for _, Type := range Types {
+					RttP, _ := BDEvi.Entry("rtctrlRttP", map[string]interface{}{"type": Type})
+					RttP.Entry("rtctrlRttEntry", map[string]interface{}{"rtt": ToDMERouteTarget(Fields[2])})
+				}
+			}
+		}
+	}
+}
+
+func ConfigMultisite(System *DMEObject, SiteID string, Line *ConfigLine) {
+	BorderGW, _ := System.Container("nvoEps").Entry("nvoEvpnMultisiteBordergw", nil)
+	BorderGW.Attributes["siteId"] = SiteID
+	BorderGW.Attributes["delayRestoreTime"] = "300"
+	for _, Child := range Line.Children {
+		Fields := Child.Fields()
+		if Child.HasPrefix("delay-restore time") && len(Fields) == 3 {
+			BorderGW.Attributes["delayRestoreTime"] = Fields[2]
+		}
+	}
+}
+
+func ConfigVPCDomain(System *DMEObject, ID string, Line *ConfigLine) {
+	Dom, _ := System.Container("vpcEntity", "vpcInst").Entry("vpcDom", map[string]interface{}{"id": ID})
+	for _, Child := range Line.Children {
+		Fields := Child.Fields()
+		if !Child.HasPrefix("peer-keepalive destination") || len(Fields) < 3 {
+			continue
+		}
+		Keepalive, _ := Dom.Entry("vpcKeepalive", nil)
+		Keepalive.Attributes["destIp"] = Fields[2]
+		for i := 3; i < len(Fields)-1; i++ {
+			if Fields[i] == "source" {
+				Keepalive.Attributes["srcIp"] = Fields[i+1]
+			}
+		}
+	}
+}
+
+func ExpandRange(Range string) []string {
+	Values := make([]string, 0)
+	for _, Part := range strings.Split(Range, ",") {
+		Bounds := strings.SplitN(Part, "-", 2)
+		if len(Bounds) == 1 {
+			Values = append(Values, Part)
+			continue
+		}
+		From, err1 := strconv.Atoi(Bounds[0])
+		To, err2 := strconv.Atoi(Bounds[1])
+		if err1 != nil || err2 != nil {
+			Values = append(Values, Part)
+			continue
+		}
+		for i := From; i <= To; i++ {
+			Values = append(Values, strconv.Itoa(i))
+		}
+	}
+	return Values
+}
+
+func ToDMEInterfaceName(Name string) string {
+	Lower := strings.ToLower(Name)
+	for _, Prefix := range [][2]string{{"ethernet", "eth"}, {"port-channel", "po"}, {"loopback", "lo"}, {"vlan", "vlan"}, {"nve", "nve"}, {"mgmt", "mgmt"}} {
+		if strings.HasPrefix(Lower, Prefix[0]) {
+			return Prefix[1] + Lower[len(Prefix[0]):]
+		}
+	}
+	return Name
+}
+
+func ToDMERouteTarget(Value string) string {
+	if Value == "auto" {
+		return "route-target:unknown:0:0"
+	}
+	return "route-target:" + ToDMEExtCommunity(Value)
+}
+
+func ToDMERouteDistinguisher(Value string) string {
+	if Value == "auto" {
+		return "rd:unknown:0:0"
+	}
+	return "rd:" + ToDMEExtCommunity(Value)
+}
+
+func ToDMEExtCommunity(Value string) string {
+	Index := strings.LastIndex(Value, ":")
+	if Index < 0 {
+		return Value
+	}
+	Admin := Value[:Index]
+	if strings.Contains(Admin, ".") {
+		return "ipv4-nn2:" + Value
+	}
+	if ASN, err := strconv.ParseUint(Admin, 10, 32); err == nil && ASN > 65535 {
+		return "as4-nn2:" + Value
+	}
+	if NN, err := strconv.ParseUint(Value[Index+1:], 10, 32); err == nil && NN > 65535 {
+		return "as2-nn4:" + Value
+	}
+	return "as2-nn2:" + Value
+}
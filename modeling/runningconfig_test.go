@@ -0,0 +1,108 @@
+package modeling
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+func TestToDMEExtCommunity(t *testing.T) {
+	for Value, Expected := range map[string]string{
+		"65001:10200":     "as2-nn2:65001:10200",
+		"65001:3001001":   "as2-nn4:65001:3001001",
+		"4200000001:200":  "as4-nn2:4200000001:200",
+		"10.0.0.11:200":   "ipv4-nn2:10.0.0.11:200",
+		"not-a-community": "not-a-community",
+	} {
+		if DME := ToDMEExtCommunity(Value); DME != Expected {
+			t.Errorf("%v is %v, expected %v", Value, DME, Expected)
+		}
+	}
+}
+
+func TestRunningConfigCollection(t *testing.T) {
+	ServiceDefinition, MetaData := LoadTestService(t, "VNI.service")
+	FileName, err := filepath.Abs("testdata/bgw1.cfg")
+	if err != nil {
+		t.Fatalf("Can't resolve the fixture: %v", err)
+	}
+	var hmd cu.HostMetaData
+	hmd.Host.Hostname = "bgw1"
+	hmd.Host.URL = "file://" + FileName
+
+	RawDataDB := CollectRawDataDB(MetaData, cu.Inventory{hmd}, "sys")
+	if len(RawDataDB) != 1 {
+		t.Fatalf("Running-config is not loaded")
+	}
+	if VPCPairs := DiscoverVPCPairs(append(RawDataDB, RawDataDBEntry{DeviceName: "bgw2", DMEChunkMap: DMEChunkMap{VPCChunk: {{"vpcDom.id": "10", "vpcKeepalive.srcIp": "192.168.0.2", "vpcKeepalive.destIp": "192.168.0.1"}}}})); len(VPCPairs) != 1 {
+		t.Errorf("Unexpected vPC pairs: %+v", VPCPairs)
+	}
+
+	for _, Case := range []struct {
+		VNI        string
+		DeviceData map[string]string
+		Layout     map[string]bool
+	}{
+		{"10100", map[string]string{
+			"l2BD.name":                 "web",
+			"ipv4Addr.addr":             "10.1.0.1/24",
+			"ipv4Addr.tag":              "12345",
+			"ipv4Dom.name":              "tenant",
+			"nvoNw.mcastGroup":          "239.1.1.1",
+			"rtctrlRttEntry.rtt.import": "route-target:unknown:0:0",
+			"rtctrlRttEntry.rtt.export": "route-target:unknown:0:0",
+		}, map[string]bool{"L2VNI": true, "AGW": true, "ARP-Suppress": true, "PIM": true, "IR": false, "MS-IR": true, "BGW": true, "Leaf": false, "DCI-Tracking": true, "Fabric-Tracking": true}},
+		{"3001001", map[string]string{
+			"l2BD.name":                 "VLAN0200",
+			"nvoNw.mcastGroup":          "0.0.0.0",
+			"rtctrlRttEntry.rtt.import": "route-target:as2-nn4:65001:3001001",
+			"rtctrlRttEntry.rtt.export": "route-target:as4-nn2:4200000001:200",
+		}, map[string]bool{"L2VNI": true, "AGW": false, "ARP-Suppress": false, "PIM": false, "IR": true, "MS-IR": false, "BGW": true}},
+	} {
+		ProcessedData := ConstructProcessedData(ServiceDefinition, RawDataDB, Case.VNI, MetaData.ConversionMap)
+		if len(ProcessedData.ServiceDataDB) != 1 || len(ProcessedData.ServiceLayoutDB) != 1 {
+			t.Fatalf("Unexpected processed data for VNI %v: %+v", Case.VNI, ProcessedData)
+		}
+		Entry := ProcessedData.ServiceDataDB[0]
+		for Key, Value := range Case.DeviceData {
+			if fmt.Sprint(Entry.DeviceData[Key]) != Value {
+				t.Errorf("VNI %v: %v is %v, expected %v", Case.VNI, Key, Entry.DeviceData[Key], Value)
+			}
+		}
+		if !Entry.Offline || len(Entry.OperData) > 0 {
+			t.Errorf("VNI %v: offline data is not marked or has oper data %v", Case.VNI, Entry.OperData)
+		}
+		for _, Component := range ProcessedData.ServiceLayoutDB[0].ServiceLayout {
+			if Value, ok := Case.Layout[Component.Name]; ok && Component.Value != Value {
+				t.Errorf("VNI %v: component %v is %v, expected %v", Case.VNI, Component.Name, Component.Value, Value)
+			}
+			if Component.Oper != "" {
+				t.Errorf("VNI %v: component %v of offline data is %v", Case.VNI, Component.Name, Component.Oper)
+			}
+		}
+	}
+}
+
+func TestLoadOfflineInventory(t *testing.T) {
+	Dir := t.TempDir()
+	for _, File := range []string{"leaf1.json", "bgw1.cfg", ".hidden"} {
+		if err := ioutil.WriteFile(filepath.Join(Dir, File), []byte("{}"), 0644); err != nil {
+			t.Fatalf("Can't write %v: %v", File, err)
+		}
+	}
+	Inventory, err := LoadOfflineInventory(Dir)
+	if err != nil || len(Inventory) != 2 || Inventory[0].Host.Hostname != "bgw1" || Inventory[1].Host.Hostname != "leaf1" || !IsFileHost(Inventory[1]) {
+		t.Errorf("Unexpected inventory: %+v %v", Inventory, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(Dir, "leaf1.cfg"), []byte("hostname leaf1\n"), 0644); err != nil {
+		t.Fatalf("Can't write leaf1.cfg: %v", err)
+	}
+	if _, err := LoadOfflineInventory(Dir); err == nil || !strings.Contains(err.Error(), "leaf1.cfg and leaf1.json") {
+		t.Errorf("Device with two files is loaded: %v", err)
+	}
+}
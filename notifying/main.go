@@ -0,0 +1,278 @@
+package notifying
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	df "n9k-modeling/diffing"
+	p "n9k-modeling/polling"
+)
+
+const (
+	SeverityCritical = "critical"
+	SeverityError    = "error"
+	SeverityWarning  = "warning"
+	SeverityNotice   = "notice"
+	SeverityInfo     = "info"
+)
+
+var SeverityLevels = map[string]int{
+	SeverityCritical: 2,
+	SeverityError:    3,
+	SeverityWarning:  4,
+	SeverityNotice:   5,
+	SeverityInfo:     6,
+}
+
+var DefaultSeverities = map[string]string{
+	p.EventDeviceUnreachable: SeverityError,
+	p.EventIntendedDrift:     SeverityWarning,
+	p.EventLayoutViolation:   SeverityWarning,
+	p.EventComponentLost:     SeverityWarning,
+	p.EventValueDrift:        SeverityWarning,
+	p.EventInstanceRemoved:   SeverityNotice,
+}
+
+const (
+	TypeDiff = "diff"
+)
+
+type NotifyConfig struct {
+	Sinks []SinkConfig `json:"Sinks"`
+	Rules []Rule       `json:"Rules"`
+}
+
+type SinkConfig struct {
+	Type        string            `json:"Type"`
+	URL         string            `json:"URL"`
+	Headers     map[string]string `json:"Headers"`
+	Network     string            `json:"Network"`
+	Address     string            `json:"Address"`
+	Facility    int               `json:"Facility"`
+	Path        string            `json:"Path"`
+	Template    string            `json:"Template"`
+	MinSeverity string            `json:"MinSeverity"`
+}
+
+type Rule struct {
+	Service  string   `json:"Service"`
+	Types    []string `json:"Types"`
+	Severity string   `json:"Severity"`
+}
+
+type Notification struct {
+	Timestamp   time.Time `json:"Timestamp"`
+	Severity    string    `json:"Severity"`
+	Type        string    `json:"Type"`
+	RunID       string    `json:"RunID,omitempty"`
+	ServiceName string    `json:"ServiceName,omitempty"`
+	InstanceKey string    `json:"InstanceKey,omitempty"`
+	DeviceName  string    `json:"DeviceName,omitempty"`
+	Summary     string    `json:"Summary"`
+	Details     []string  `json:"Details,omitempty"`
+}
+
+type Sink interface {
+	Send(Note Notification) error
+}
+
+type Notifier struct {
+	Rules      []Rule
+	Sinks      []Sink
+	SinkLevels []int
+}
+
+func LoadNotifyConfig(fileName string) (NotifyConfig, error) {
+	var NotifyConfig NotifyConfig
+	NotifyConfigFileBytes, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return NotifyConfig, err
+	}
+	if err := json.Unmarshal(NotifyConfigFileBytes, &NotifyConfig); err != nil {
+		return NotifyConfig, fmt.Errorf("Can't decode notification config %v: %v", fileName, err)
+	}
+	return NotifyConfig, nil
+}
+
+func NewNotifier(NotifyConfig NotifyConfig) (*Notifier, error) {
+	Notifier := &Notifier{Rules: NotifyConfig.Rules}
+	for _, Rule := range NotifyConfig.Rules {
+		if _, ok := SeverityLevels[Rule.Severity]; !ok {
+			return nil, fmt.Errorf("Unknown severity %v in the rule for service %v", Rule.Severity, Rule.Service)
+		}
+	}
+	for _, SinkConfig := range NotifyConfig.Sinks {
+		Sink, err := NewSink(SinkConfig)
+		if err != nil {
+			return nil, err
+		}
+		MinSeverity := SinkConfig.MinSeverity
+		if MinSeverity == "" {
+			MinSeverity = SeverityInfo
+		}
+		Level, ok := SeverityLevels[MinSeverity]
+		if !ok {
+			return nil, fmt.Errorf("Unknown severity %v in the %v sink", MinSeverity, SinkConfig.Type)
+		}
+		Notifier.Sinks = append(Notifier.Sinks, Sink)
+		Notifier.SinkLevels = append(Notifier.SinkLevels, Level)
+	}
+	return Notifier, nil
+}
+
+func LoadNotifier(fileName string) *Notifier {
+	NotifyConfig, err := LoadNotifyConfig(fileName)
+	if err != nil {
+		log.Fatalf("Can't load notifications: %v", err)
+	}
+	Notifier, err := NewNotifier(NotifyConfig)
+	if err != nil {
+		log.Fatalf("Can't set up notifications: %v", err)
+	}
+	return Notifier
+}
+
+func NewSink(SinkConfig SinkConfig) (Sink, error) {
+	Template, err := ParseTemplate(SinkConfig.Type, SinkConfig.Template)
+	if err != nil {
+		return nil, err
+	}
+	switch SinkConfig.Type {
+	case "webhook":
+		if SinkConfig.URL == "" {
+			return nil, fmt.Errorf("webhook sink needs a URL")
+		}
+		return &WebhookSink{URL: SinkConfig.URL, Headers: SinkConfig.Headers, Template: Template}, nil
+	case "syslog":
+		return NewSyslogSink(SinkConfig, Template)
+	case "file":
+		if SinkConfig.Path == "" {
+			return nil, fmt.Errorf("file sink needs a path")
+		}
+		return &FileSink{Path: SinkConfig.Path, Template: Template}, nil
+	default:
+		return nil, fmt.Errorf("Unknown sink type: %v", SinkConfig.Type)
+	}
+}
+
+func ParseTemplate(Name string, Text string) (*template.Template, error) {
+	if Text == "" {
+		return nil, nil
+	}
+	return template.New(Name).Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			JSONData, err := json.Marshal(v)
+			return string(JSONData), err
+		},
+		"join": strings.Join,
+	}).Parse(Text)
+}
+
+func RenderMessage(Template *template.Template, Notification Notification, Default func(Notification) ([]byte, error)) ([]byte, error) {
+	if Template == nil {
+		return Default(Notification)
+	}
+	var Message bytes.Buffer
+	if err := Template.Execute(&Message, Notification); err != nil {
+		return nil, err
+	}
+	return Message.Bytes(), nil
+}
+
+func (n *Notifier) Severity(ServiceName string, Type string) string {
+	for _, Rule := range n.Rules {
+		if Rule.Service != "" && Rule.Service != "*" && Rule.Service != ServiceName {
+			continue
+		}
+		if len(Rule.Types) == 0 {
+			return Rule.Severity
+		}
+		for _, RuleType := range Rule.Types {
+			if RuleType == Type {
+				return Rule.Severity
+			}
+		}
+	}
+	if Severity, ok := DefaultSeverities[Type]; ok {
+		return Severity
+	}
+	return SeverityInfo
+}
+
+func (n *Notifier) Notify(Notifications ...Notification) {
+	if n == nil {
+		return
+	}
+	for _, Notification := range Notifications {
+		if Notification.Severity == "" {
+			Notification.Severity = n.Severity(Notification.ServiceName, Notification.Type)
+		}
+		if Notification.Timestamp.IsZero() {
+			Notification.Timestamp = time.Now().UTC()
+		}
+		for i, Sink := range n.Sinks {
+			if SeverityLevels[Notification.Severity] > n.SinkLevels[i] {
+				continue
+			}
+			if err := Sink.Send(Notification); err != nil {
+				log.Println("Can't send notification:", err)
+			}
+		}
+	}
+}
+
+func FromEvent(Event p.Event) Notification {
+	Summary := Event.Type
+	if len(Event.Details) > 0 {
+		Summary = Event.Type + ": " + strings.Join(Event.Details, "; ")
+	}
+	return Notification{
+		Timestamp:   Event.Timestamp,
+		Type:        Event.Type,
+		RunID:       Event.RunID,
+		ServiceName: Event.ServiceName,
+		InstanceKey: Event.InstanceKey,
+		DeviceName:  Event.DeviceName,
+		Summary:     Summary,
+		Details:     Event.Details,
+	}
+}
+
+func FromServiceDiff(ServiceDiff df.ServiceDiff, InstanceKey string) []Notification {
+	Notifications := make([]Notification, 0)
+	for _, DeviceDiff := range ServiceDiff.Devices {
+		Changes := DeviceDiff.Summary()
+		Notifications = append(Notifications, Notification{
+			Type:        TypeDiff,
+			RunID:       ServiceDiff.To,
+			ServiceName: ServiceDiff.ServiceName,
+			InstanceKey: InstanceKey,
+			DeviceName:  DeviceDiff.DeviceName,
+			Summary:     fmt.Sprintf("%v changed between %v and %v: %v", DeviceDiff.DeviceName, ServiceDiff.From, ServiceDiff.To, strings.Join(Changes, "; ")),
+			Details:     Changes,
+		})
+	}
+	return Notifications
+}
+
+func FromLayoutViolations(ServiceName string, InstanceKey string, RunID string, Violations []df.LayoutViolation) []Notification {
+	Notifications := make([]Notification, 0)
+	for _, Violation := range Violations {
+		Notifications = append(Notifications, Notification{
+			Type:        p.EventLayoutViolation,
+			RunID:       RunID,
+			ServiceName: ServiceName,
+			InstanceKey: InstanceKey,
+			DeviceName:  Violation.DeviceName,
+			Summary:     Violation.DeviceName + ": " + Violation.Message,
+			Details:     []string{Violation.Message},
+		})
+	}
+	return Notifications
+}
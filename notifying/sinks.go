@@ -0,0 +1,165 @@
+package notifying
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	AppName         = "n9k-modeling"
+	DefaultFacility = 16
+	SDID            = "n9k@32473"
+)
+
+type WebhookSink struct {
+	URL      string
+	Headers  map[string]string
+	Template *template.Template
+}
+
+func (w *WebhookSink) Send(Note Notification) error {
+	Body, err := RenderMessage(w.Template, Note, func(Note Notification) ([]byte, error) {
+		return json.Marshal(Note)
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", w.URL, bytes.NewBuffer(Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for Key, Value := range w.Headers {
+		req.Header.Set(Key, Value)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %v: %v", w.URL, err)
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %v: %v", w.URL, resp.Status)
+	}
+	return nil
+}
+
+type SyslogSink struct {
+	Network  string
+	Address  string
+	Facility int
+	Hostname string
+	Template *template.Template
+
+	Mutex sync.Mutex
+	Conn  net.Conn
+}
+
+func NewSyslogSink(SinkConfig SinkConfig, Template *template.Template) (*SyslogSink, error) {
+	Network := SinkConfig.Network
+	if Network == "" {
+		Network = "udp"
+	}
+	if Network != "udp" && Network != "tcp" {
+		return nil, fmt.Errorf("syslog sink network must be udp or tcp, got %v", Network)
+	}
+	if SinkConfig.Address == "" {
+		return nil, fmt.Errorf("syslog sink needs an address")
+	}
+	Facility := SinkConfig.Facility
+	if Facility == 0 {
+		Facility = DefaultFacility
+	}
+	Hostname, err := os.Hostname()
+	if err != nil || Hostname == "" {
+		Hostname = "-"
+	}
+	return &SyslogSink{Network: Network, Address: SinkConfig.Address, Facility: Facility, Hostname: Hostname, Template: Template}, nil
+}
+
+func SDEscape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
+
+func SyslogMessage(Notification Notification, Facility int, Hostname string, Message []byte) []byte {
+	StructuredData := fmt.Sprintf(`[%v service="%v" key="%v" device="%v" run="%v"]`, SDID,
+		SDEscape(Notification.ServiceName), SDEscape(Notification.InstanceKey), SDEscape(Notification.DeviceName), SDEscape(Notification.RunID))
+	return []byte(fmt.Sprintf("<%d>1 %v %v %v %d %v %v %s",
+		Facility*8+SeverityLevels[Notification.Severity],
+		Notification.Timestamp.UTC().Format(time.RFC3339Nano),
+		Hostname, AppName, os.Getpid(), Notification.Type, StructuredData, Message))
+}
+
+func (s *SyslogSink) Send(Note Notification) error {
+	Message, err := RenderMessage(s.Template, Note, func(Note Notification) ([]byte, error) {
+		return []byte(Note.Summary), nil
+	})
+	if err != nil {
+		return err
+	}
+	Packet := SyslogMessage(Note, s.Facility, s.Hostname, Message)
+	if s.Network == "tcp" {
+		Packet = append([]byte(fmt.Sprintf("%d ", len(Packet))), Packet...)
+	}
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	for Attempt := 0; Attempt < 2; Attempt++ {
+		if s.Conn == nil {
+			Conn, err := net.DialTimeout(s.Network, s.Address, 5*time.Second)
+			if err != nil {
+				return fmt.Errorf("syslog %v: %v", s.Address, err)
+			}
+			s.Conn = Conn
+		}
+		s.Conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err = s.Conn.Write(Packet); err == nil {
+			return nil
+		}
+		s.Conn.Close()
+		s.Conn = nil
+	}
+	return fmt.Errorf("syslog %v: %v", s.Address, err)
+}
+
+type FileSink struct {
+	Path     string
+	Template *template.Template
+
+	Mutex sync.Mutex
+}
+
+func (f *FileSink) Send(Note Notification) error {
+	Line, err := RenderMessage(f.Template, Note, func(Note Notification) ([]byte, error) {
+		return json.Marshal(Note)
+	})
+	if err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(Line, []byte("\n")) {
+		Line = append(Line, '\n')
+	}
+
+	f.Mutex.Lock()
+	defer f.Mutex.Unlock()
+	File, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer File.Close()
+	_, err = File.Write(Line)
+	return err
+}
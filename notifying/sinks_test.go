@@ -0,0 +1,108 @@
+package notifying
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	p "n9k-modeling/polling"
+)
+
+type WebhookRequest struct {
+	Header http.Header
+	Body   []byte
+}
+
+func NewWebhookListener(t *testing.T, Code int) (*httptest.Server, chan WebhookRequest) {
+	Requests := make(chan WebhookRequest, 10)
+	Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		Body, _ := ioutil.ReadAll(req.Body)
+		Requests <- WebhookRequest{Header: req.Header, Body: Body}
+		w.WriteHeader(Code)
+	}))
+	t.Cleanup(Server.Close)
+	return Server, Requests
+}
+
+func TestWebhookSink(t *testing.T) {
+	Server, Requests := NewWebhookListener(t, http.StatusOK)
+
+	Notifier, err := NewNotifier(NotifyConfig{
+		Sinks: []SinkConfig{{Type: "webhook", URL: Server.URL, Headers: map[string]string{"X-Token": "secret"}, MinSeverity: SeverityWarning}},
+		Rules: []Rule{{Service: "VNI", Types: []string{p.EventInstanceRemoved}, Severity: SeverityError}},
+	})
+	if err != nil {
+		t.Fatalf("Can't set up the notifier: %v", err)
+	}
+	Notifier.Notify(
+		Notification{Type: p.EventInstanceRemoved, ServiceName: "VNI", InstanceKey: "10100", DeviceName: "leaf1", Summary: "removed"},
+		Notification{Type: p.EventInstanceRemoved, ServiceName: "VRF", InstanceKey: "3001001", Summary: "below the sink severity"},
+	)
+
+	if len(Requests) != 1 {
+		t.Fatalf("Webhook got %v requests, 1 is expected", len(Requests))
+	}
+	Request := <-Requests
+	if Request.Header.Get("Content-Type") != "application/json" || Request.Header.Get("X-Token") != "secret" {
+		t.Errorf("Unexpected webhook headers: %v", Request.Header)
+	}
+	var Note Notification
+	if err := json.Unmarshal(Request.Body, &Note); err != nil {
+		t.Fatalf("Can't decode webhook body %s: %v", Request.Body, err)
+	}
+	if Note.Severity != SeverityError || Note.ServiceName != "VNI" || Note.DeviceName != "leaf1" || Note.Timestamp.IsZero() {
+		t.Errorf("Unexpected notification: %+v", Note)
+	}
+}
+
+func TestWebhookSinkTemplate(t *testing.T) {
+	Server, Requests := NewWebhookListener(t, http.StatusOK)
+
+	Sink, err := NewSink(SinkConfig{Type: "webhook", URL: Server.URL, Template: `{"text": {{json .Summary}}}`})
+	if err != nil {
+		t.Fatalf("Can't set up the sink: %v", err)
+	}
+	if err := Sink.Send(Notification{Timestamp: time.Now(), Summary: `drift on "leaf1"`}); err != nil {
+		t.Fatalf("Can't send: %v", err)
+	}
+	Request := <-Requests
+	if string(Request.Body) != `{"text": "drift on \"leaf1\""}` {
+		t.Errorf("Unexpected templated body: %s", Request.Body)
+	}
+}
+
+func TestWebhookSinkError(t *testing.T) {
+	Server, _ := NewWebhookListener(t, http.StatusInternalServerError)
+
+	Sink, err := NewSink(SinkConfig{Type: "webhook", URL: Server.URL})
+	if err != nil {
+		t.Fatalf("Can't set up the sink: %v", err)
+	}
+	if err := Sink.Send(Notification{Summary: "drift"}); err == nil {
+		t.Errorf("Webhook error status is not reported")
+	}
+}
+
+func TestLoadNotifyConfig(t *testing.T) {
+	Dir := t.TempDir()
+	if _, err := LoadNotifyConfig(filepath.Join(Dir, "missing.json")); err == nil {
+		t.Errorf("Missing notification config is not reported")
+	}
+
+	BadFile := filepath.Join(Dir, "bad.json")
+	ioutil.WriteFile(BadFile, []byte(`{"Sinks": [`), 0644)
+	if _, err := LoadNotifyConfig(BadFile); err == nil {
+		t.Errorf("Unparsable notification config is not reported")
+	}
+
+	GoodFile := filepath.Join(Dir, "notify.json")
+	ioutil.WriteFile(GoodFile, []byte(`{"Sinks": [{"Type": "file", "Path": "events.log"}]}`), 0644)
+	NotifyConfig, err := LoadNotifyConfig(GoodFile)
+	if err != nil || len(NotifyConfig.Sinks) != 1 || NotifyConfig.Sinks[0].Type != "file" {
+		t.Errorf("Unexpected notification config: %+v %v", NotifyConfig, err)
+	}
+}
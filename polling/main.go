@@ -0,0 +1,540 @@
+package polling
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	d "n9k-modeling/deploying"
+	df "n9k-modeling/diffing"
+	mt "n9k-modeling/metrics"
+	m "n9k-modeling/modeling"
+	s "n9k-modeling/storing"
+	t "n9k-modeling/templating"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+const MaxEvents = 1000
+
+const (
+	EventInstanceAdded     = "instance-added"
+	EventInstanceRemoved   = "instance-removed"
+	EventComponentAdded    = "component-added"
+	EventComponentLost     = "component-lost"
+	EventValueDrift        = "value-drift"
+	EventIntendedDrift     = "intended-drift"
+	EventIntendedInSync    = "intended-in-sync"
+	EventLayoutViolation   = "layout-violation"
+	EventLayoutConsistent  = "layout-consistent"
+	EventDeviceUnreachable = "device-unreachable"
+	EventDeviceRecovered   = "device-recovered"
+)
+
+type PollerConfig struct {
+	Interval   string           `json:"Interval"`
+	MaxBackoff string           `json:"MaxBackoff"`
+	Inventory  string           `json:"Inventory"`
+	Instances  []InstanceConfig `json:"Instances"`
+}
+
+type InstanceConfig struct {
+	Service  string `json:"Service"`
+	Key      string `json:"Key"`
+	Intended string `json:"Intended"`
+}
+
+type Event struct {
+	Timestamp   time.Time `json:"Timestamp"`
+	Type        string    `json:"Type"`
+	RunID       string    `json:"RunID,omitempty"`
+	ServiceName string    `json:"ServiceName,omitempty"`
+	InstanceKey string    `json:"InstanceKey,omitempty"`
+	DeviceName  string    `json:"DeviceName"`
+	Details     []string  `json:"Details,omitempty"`
+}
+
+type DeviceState struct {
+	DeviceName  string    `json:"DeviceName"`
+	Failures    int       `json:"Failures"`
+	LastAttempt time.Time `json:"LastAttempt"`
+	LastSuccess time.Time `json:"LastSuccess"`
+	NextAttempt time.Time `json:"NextAttempt"`
+}
+
+type PolledInstance struct {
+	ServiceDefinition m.ServiceDefinition
+	Key               string
+	Intended          string
+}
+
+type Poller struct {
+	Interval        time.Duration
+	MaxBackoff      time.Duration
+	InventoryFile   string
+	Inventory       cu.Inventory
+	Instances       []PolledInstance
+	MetaData        *m.MetaData
+	Store           s.Store
+	StateRepository *s.StateRepository
+	OnRun           func(Run s.RunMetaData, ProcessedData m.ProcessedData)
+	EventHandlers   []func(Event)
+	Queue           chan Event
+
+	Mutex    sync.Mutex
+	RawData  map[string]m.RawDataDBEntry
+	Devices  map[string]*DeviceState
+	Previous map[string]m.ProcessedData
+	Drift    map[string]string
+	Events   []Event
+}
+
+func LoadPollerConfig(fileName string) PollerConfig {
+	var PollerConfig PollerConfig
+	PollerConfigFile, err := os.Open(fileName)
+	if err != nil {
+		log.Println(err)
+	}
+	defer PollerConfigFile.Close()
+
+	PollerConfigFileBytes, _ := ioutil.ReadAll(PollerConfigFile)
+
+	err = json.Unmarshal(PollerConfigFileBytes, &PollerConfig)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return PollerConfig
+}
+
+func ParseDuration(v string, Default time.Duration) time.Duration {
+	if v == "" {
+		return Default
+	}
+	Duration, err := time.ParseDuration(v)
+	if err != nil || Duration <= 0 {
+		log.Println("Can't parse duration", v, "using", Default)
+		return Default
+	}
+	return Duration
+}
+
+func NewPoller(PollerConfig PollerConfig, MetaData *m.MetaData) *Poller {
+	Poller := &Poller{
+		Interval:      ParseDuration(PollerConfig.Interval, 5*time.Minute),
+		InventoryFile: PollerConfig.Inventory,
+		Inventory:     cu.LoadInventory(PollerConfig.Inventory),
+		RawData:       make(map[string]m.RawDataDBEntry),
+		Devices:       make(map[string]*DeviceState),
+		Previous:      make(map[string]m.ProcessedData),
+		Drift:         make(map[string]string),
+		Events:        make([]Event, 0),
+		Queue:         make(chan Event, MaxEvents),
+	}
+	Poller.MaxBackoff = ParseDuration(PollerConfig.MaxBackoff, 12*Poller.Interval)
+
+	PollerMetaData := *MetaData
+	PollerMetaData.KeysMap = make(cu.KeysMap)
+	PollerMetaData.CLIMap = make(m.CLIMap)
+	PollerMetaData.GNMIMap = make(m.GNMIMap)
+	for _, InstanceConfig := range PollerConfig.Instances {
+		ServiceDefinition := m.LoadServiceDefinition(InstanceConfig.Service)
+		for MapKey, Paths := range m.LoadKeysMap(ServiceDefinition.DMEProcessing) {
+			PollerMetaData.KeysMap[MapKey] = Paths
+		}
+		for MapKey, CLIChunk := range m.LoadCLIMap(ServiceDefinition.CLIProcessing) {
+			PollerMetaData.CLIMap[MapKey] = CLIChunk
+		}
+		for MapKey, GNMIKeyDefinitions := range m.LoadGNMIMap(ServiceDefinition.GNMIProcessing) {
+			PollerMetaData.GNMIMap[MapKey] = GNMIKeyDefinitions
+		}
+		if ServiceDefinition.PropInclude == "all" {
+			PollerMetaData.PropInclude = "all"
+		}
+		Poller.Instances = append(Poller.Instances, PolledInstance{ServiceDefinition: ServiceDefinition, Key: InstanceConfig.Key, Intended: InstanceConfig.Intended})
+	}
+	Poller.MetaData = &PollerMetaData
+
+	return Poller
+}
+
+func InstanceID(ServiceName string, InstanceKey string) string {
+	return ServiceName + "/" + InstanceKey
+}
+
+func (p *Poller) LoadBaseline() {
+	if p.Store == nil {
+		return
+	}
+	for _, Instance := range p.Instances {
+		Runs, err := p.Store.ListRuns(s.Query{ServiceName: Instance.ServiceDefinition.ServiceName, InstanceKey: Instance.Key})
+		if err != nil || len(Runs) == 0 {
+			continue
+		}
+		ProcessedData, err := s.LoadProcessedData(p.Store, s.Query{RunID: Runs[len(Runs)-1].RunID})
+		if err != nil {
+			log.Println("Can't load the baseline run:", err)
+			continue
+		}
+		p.Previous[InstanceID(Instance.ServiceDefinition.ServiceName, Instance.Key)] = ProcessedData
+		log.Println("Baseline loaded:", Runs[len(Runs)-1].RunID, Instance.ServiceDefinition.ServiceName, Instance.Key)
+	}
+}
+
+func (p *Poller) Run(Stop <-chan struct{}) {
+	go p.Dispatch(Stop)
+	p.LoadBaseline()
+	Ticker := time.NewTicker(p.Interval)
+	defer Ticker.Stop()
+	for {
+		p.Poll()
+		select {
+		case <-Stop:
+			return
+		case <-Ticker.C:
+		}
+	}
+}
+
+func (p *Poller) DueInventory(Now time.Time) cu.Inventory {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+	Due := make(cu.Inventory, 0)
+	for _, v := range p.Inventory {
+		State, ok := p.Devices[v.Host.Hostname]
+		if !ok {
+			State = &DeviceState{DeviceName: v.Host.Hostname}
+			p.Devices[v.Host.Hostname] = State
+		}
+		if !State.NextAttempt.After(Now.Add(p.Interval / 2)) {
+			Due = append(Due, v)
+		}
+	}
+	return Due
+}
+
+func (p *Poller) Backoff(Failures int) time.Duration {
+	Backoff := p.Interval
+	for i := 1; i < Failures && Backoff < p.MaxBackoff; i++ {
+		Backoff *= 2
+	}
+	if Backoff > p.MaxBackoff {
+		Backoff = p.MaxBackoff
+	}
+	return Backoff
+}
+
+func (p *Poller) RecordCollection(Now time.Time, Due cu.Inventory, RawDataDB m.RawDataDB) []Event {
+	Events := make([]Event, 0)
+	Collected := make(map[string]bool)
+
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+	for _, v := range RawDataDB {
+		p.RawData[v.DeviceName] = v
+		Collected[v.DeviceName] = true
+	}
+	for _, v := range Due {
+		DeviceState := p.Devices[v.Host.Hostname]
+		DeviceState.LastAttempt = Now
+		if Collected[v.Host.Hostname] {
+			if DeviceState.Failures > 0 {
+				Events = append(Events, Event{Timestamp: Now, Type: EventDeviceRecovered, DeviceName: v.Host.Hostname, Details: []string{fmt.Sprintf("collected after %v failures", DeviceState.Failures)}})
+			}
+			DeviceState.Failures = 0
+			DeviceState.LastSuccess = Now
+			DeviceState.NextAttempt = Now
+			continue
+		}
+		DeviceState.Failures++
+		Backoff := p.Backoff(DeviceState.Failures)
+		DeviceState.NextAttempt = Now.Add(Backoff)
+		if DeviceState.Failures == 1 {
+			Events = append(Events, Event{Timestamp: Now, Type: EventDeviceUnreachable, DeviceName: v.Host.Hostname, Details: []string{"collection failed, last known data is kept"}})
+		}
+		log.Println("Collection failed on device:", v.Host.Hostname, "failures:", DeviceState.Failures, "next attempt in", Backoff)
+	}
+	return Events
+}
+
+func (p *Poller) CachedRawDataDB() m.RawDataDB {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+	RawDataDB := make(m.RawDataDB, 0)
+	for _, v := range p.Inventory {
+		if DBEntry, ok := p.RawData[v.Host.Hostname]; ok {
+			RawDataDB = append(RawDataDB, DBEntry)
+		}
+	}
+	return RawDataDB
+}
+
+func (p *Poller) Poll() {
+	Now := time.Now().UTC()
+	Due := p.DueInventory(Now)
+	RawDataDB := make(m.RawDataDB, 0)
+	if len(Due) > 0 {
+		RawDataDB = m.CollectRawDataDB(p.MetaData, Due, "sys")
+	}
+	p.Emit(p.RecordCollection(Now, Due, RawDataDB)...)
+
+	Cached := p.CachedRawDataDB()
+	for _, Instance := range p.Instances {
+		ServiceName := Instance.ServiceDefinition.ServiceName
+		ProcessedData := m.ConstructProcessedData(Instance.ServiceDefinition, Cached, Instance.Key, p.MetaData.ConversionMap)
+		Run := s.NewRun(fmt.Sprintf("%v-%v-%v", m.NewRunID(), ServiceName, Instance.Key), p.InventoryFile, ServiceName, Instance.Key)
+
+		p.Mutex.Lock()
+		Previous, HasPrevious := p.Previous[InstanceID(ServiceName, Instance.Key)]
+		p.Previous[InstanceID(ServiceName, Instance.Key)] = ProcessedData
+		p.Mutex.Unlock()
+
+		Events := make([]Event, 0)
+		if HasPrevious {
+			Events = append(Events, DetectChanges(Run, Previous, ProcessedData)...)
+		} else {
+			log.Println("Baseline established:", ServiceName, Instance.Key)
+		}
+		if Intended, ok := p.LoadIntended(Instance); ok {
+			Events = append(Events, p.CheckIntended(Run, Intended, ProcessedData)...)
+		}
+		Events = append(Events, p.CheckLayout(Run, Instance.ServiceDefinition.ServiceConsistency, ProcessedData)...)
+
+		if len(Events) > 0 || !HasPrevious {
+			p.SaveRun(Run, RawDataDB, ProcessedData)
+		}
+		if p.OnRun != nil {
+			p.OnRun(Run, ProcessedData)
+		}
+		p.Emit(Events...)
+	}
+}
+
+func (p *Poller) SaveRun(Run s.RunMetaData, RawDataDB m.RawDataDB, ProcessedData m.ProcessedData) {
+	if p.Store != nil {
+		if err := s.SaveProcessedData(p.Store, Run, ProcessedData); err != nil {
+			log.Println("Can't store processed data:", err)
+		}
+		if err := s.SaveRawDataDB(p.Store, Run, RawDataDB); err != nil {
+			log.Println("Can't store raw data:", err)
+		}
+	}
+	if p.StateRepository != nil {
+		if err := p.StateRepository.CommitProcessedData(Run, ProcessedData); err != nil {
+			log.Println("Can't commit processed data to the state repository:", err)
+		}
+	}
+}
+
+func ActiveComponents(ServiceLayout m.ServiceLayout) int {
+	Active := 0
+	for _, Component := range ServiceLayout {
+		if Component.Value {
+			Active++
+		}
+	}
+	return Active
+}
+
+func DetectChanges(Run s.RunMetaData, Previous m.ProcessedData, Current m.ProcessedData) []Event {
+	Events := make([]Event, 0)
+	_, PreviousLayout := df.IndexProcessedData(Previous)
+	_, CurrentLayout := df.IndexProcessedData(Current)
+
+	NewEvent := func(Type string, DeviceName string, Details []string) Event {
+		return Event{Timestamp: Run.Timestamp, Type: Type, RunID: Run.RunID, ServiceName: Run.ServiceName, InstanceKey: Run.InstanceKey, DeviceName: DeviceName, Details: Details}
+	}
+
+	ServiceDiff := df.DiffProcessedData(Previous, Current, "", Run.RunID)
+	for _, DeviceDiff := range ServiceDiff.Devices {
+		WasActive := ActiveComponents(PreviousLayout[DeviceDiff.DeviceName]) > 0
+		IsActive := ActiveComponents(CurrentLayout[DeviceDiff.DeviceName]) > 0
+		switch {
+		case !WasActive && IsActive:
+			Events = append(Events, NewEvent(EventInstanceAdded, DeviceDiff.DeviceName, DeviceDiff.ComponentsAdded))
+		case WasActive && !IsActive:
+			Events = append(Events, NewEvent(EventInstanceRemoved, DeviceDiff.DeviceName, DeviceDiff.ComponentsRemoved))
+		default:
+			if len(DeviceDiff.ComponentsAdded) > 0 {
+				Events = append(Events, NewEvent(EventComponentAdded, DeviceDiff.DeviceName, DeviceDiff.ComponentsAdded))
+			}
+			if len(DeviceDiff.ComponentsRemoved) > 0 {
+				Events = append(Events, NewEvent(EventComponentLost, DeviceDiff.DeviceName, DeviceDiff.ComponentsRemoved))
+			}
+			if len(DeviceDiff.ValueChanges) > 0 {
+				ValueDiff := df.DeviceDiff{DeviceName: DeviceDiff.DeviceName, ValueChanges: DeviceDiff.ValueChanges}
+				Events = append(Events, NewEvent(EventValueDrift, DeviceDiff.DeviceName, ValueDiff.Summary()))
+			}
+		}
+	}
+	return Events
+}
+
+func LatestTemplatedData(Store s.Store, ServiceName string, InstanceKey string) (m.ProcessedData, bool) {
+	Runs, err := Store.ListRuns(s.Query{ServiceName: ServiceName, InstanceKey: InstanceKey})
+	if err != nil {
+		log.Println("Can't list runs:", err)
+		return m.ProcessedData{}, false
+	}
+	for i := len(Runs) - 1; i >= 0; i-- {
+		TemplatedData, err := s.LoadTemplatedData(Store, s.Query{RunID: Runs[i].RunID})
+		if err == nil && len(TemplatedData.ServiceDataDB) > 0 {
+			return TemplatedData, true
+		}
+	}
+	return m.ProcessedData{}, false
+}
+
+func (p *Poller) LoadIntended(Instance PolledInstance) (m.ProcessedData, bool) {
+	if Instance.Intended != "" {
+		return t.LoadProcessedData(Instance.Intended), true
+	}
+	if p.Store != nil {
+		return LatestTemplatedData(p.Store, Instance.ServiceDefinition.ServiceName, Instance.Key)
+	}
+	return m.ProcessedData{}, false
+}
+
+func (p *Poller) CheckIntended(Run s.RunMetaData, Intended m.ProcessedData, Current m.ProcessedData) []Event {
+	Events := make([]Event, 0)
+	IntendedData, IntendedLayout := df.IndexProcessedData(Intended)
+	CurrentData, CurrentLayout := df.IndexProcessedData(Current)
+
+	DeviceNames := make([]string, 0)
+	for DeviceName := range IntendedData {
+		DeviceNames = append(DeviceNames, DeviceName)
+	}
+	sort.Strings(DeviceNames)
+
+	DriftDevices := 0
+	defer func() {
+		mt.ObserveIntendedDrift(Run.ServiceName, Run.InstanceKey, DriftDevices)
+	}()
+
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+	for _, DeviceName := range DeviceNames {
+		if _, ok := CurrentData[DeviceName]; !ok {
+			continue
+		}
+		Mismatches := d.CompareDeviceData(IntendedData[DeviceName], CurrentData[DeviceName])
+		Mismatches = append(Mismatches, d.CompareServiceLayout(IntendedLayout[DeviceName], CurrentLayout[DeviceName])...)
+		if len(Mismatches) > 0 {
+			DriftDevices++
+		}
+
+		DriftID := InstanceID(Run.ServiceName, Run.InstanceKey) + "/" + DeviceName
+		Signature := strings.Join(Mismatches, "\n")
+		if Signature == p.Drift[DriftID] {
+			continue
+		}
+		p.Drift[DriftID] = Signature
+
+		Event := Event{Timestamp: Run.Timestamp, RunID: Run.RunID, ServiceName: Run.ServiceName, InstanceKey: Run.InstanceKey, DeviceName: DeviceName, Details: Mismatches}
+		if len(Mismatches) > 0 {
+			Event.Type = EventIntendedDrift
+		} else {
+			Event.Type = EventIntendedInSync
+		}
+		Events = append(Events, Event)
+	}
+	return Events
+}
+
+func (p *Poller) CheckLayout(Run s.RunMetaData, ServiceConsistency m.ServiceConsistency, Current m.ProcessedData) []Event {
+	Events := make([]Event, 0)
+	DeviceViolations := make(map[string][]string)
+	for _, Violation := range df.CheckLayoutConsistency(Current, ServiceConsistency) {
+		DeviceViolations[Violation.DeviceName] = append(DeviceViolations[Violation.DeviceName], Violation.Message)
+	}
+
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+	for _, v := range Current.ServiceLayoutDB {
+		LayoutID := "layout/" + InstanceID(Run.ServiceName, Run.InstanceKey) + "/" + v.DeviceName
+		Signature := strings.Join(DeviceViolations[v.DeviceName], "\n")
+		if Signature == p.Drift[LayoutID] {
+			continue
+		}
+		p.Drift[LayoutID] = Signature
+
+		Event := Event{Timestamp: Run.Timestamp, RunID: Run.RunID, ServiceName: Run.ServiceName, InstanceKey: Run.InstanceKey, DeviceName: v.DeviceName, Details: DeviceViolations[v.DeviceName]}
+		if len(DeviceViolations[v.DeviceName]) > 0 {
+			Event.Type = EventLayoutViolation
+		} else {
+			Event.Type = EventLayoutConsistent
+		}
+		Events = append(Events, Event)
+	}
+	return Events
+}
+
+func (p *Poller) Emit(Events ...Event) {
+	if len(Events) == 0 {
+		return
+	}
+	p.Mutex.Lock()
+	p.Events = append(p.Events, Events...)
+	if len(p.Events) > MaxEvents {
+		p.Events = p.Events[len(p.Events)-MaxEvents:]
+	}
+	p.Mutex.Unlock()
+
+	for _, Event := range Events {
+		log.Println("Event:", Event.Type, Event.ServiceName, Event.InstanceKey, Event.DeviceName, strings.Join(Event.Details, "; "))
+		mt.ObserveEvent(Event.ServiceName, Event.Type)
+		if len(p.EventHandlers) == 0 {
+			continue
+		}
+		select {
+		case p.Queue <- Event:
+		default:
+			log.Println("Event queue is full, handlers skip event:", Event.Type, Event.ServiceName, Event.InstanceKey, Event.DeviceName)
+		}
+	}
+}
+
+// Dispatch hands the queued events to the handlers, so slow notification sinks
+// don't hold up the poll cycle.
+func (p *Poller) Dispatch(Stop <-chan struct{}) {
+	for {
+		select {
+		case <-Stop:
+			return
+		case Event := <-p.Queue:
+			for _, EventHandler := range p.EventHandlers {
+				EventHandler(Event)
+			}
+		}
+	}
+}
+
+func (p *Poller) EventsSince(Since time.Time) []Event {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+	Events := make([]Event, 0)
+	for _, Event := range p.Events {
+		if Event.Timestamp.After(Since) {
+			Events = append(Events, Event)
+		}
+	}
+	return Events
+}
+
+func (p *Poller) DeviceStates() []DeviceState {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+	DeviceStates := make([]DeviceState, 0)
+	for _, v := range p.Inventory {
+		if DeviceState, ok := p.Devices[v.Host.Hostname]; ok {
+			DeviceStates = append(DeviceStates, *DeviceState)
+		}
+	}
+	return DeviceStates
+}
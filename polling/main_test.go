@@ -0,0 +1,45 @@
+package polling
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEmitDoesNotWaitForHandlers(t *testing.T) {
+	Poller := &Poller{Queue: make(chan Event, MaxEvents)}
+	Release := make(chan struct{})
+	Handled := make(chan Event, 2)
+	Poller.EventHandlers = append(Poller.EventHandlers, func(Event Event) {
+		<-Release
+		Handled <- Event
+	})
+	Stop := make(chan struct{})
+	defer close(Stop)
+	go Poller.Dispatch(Stop)
+
+	Emitted := make(chan struct{})
+	go func() {
+		Poller.Emit(Event{Type: EventDeviceUnreachable, DeviceName: "leaf1"}, Event{Type: EventDeviceUnreachable, DeviceName: "leaf2"})
+		close(Emitted)
+	}()
+	select {
+	case <-Emitted:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Emit waits for a blocked event handler")
+	}
+	if len(Poller.Events) != 2 {
+		t.Errorf("Poller keeps %v events, 2 are expected", len(Poller.Events))
+	}
+
+	close(Release)
+	for _, DeviceName := range []string{"leaf1", "leaf2"} {
+		select {
+		case Event := <-Handled:
+			if Event.DeviceName != DeviceName {
+				t.Errorf("Event for %v is handled, %v is expected", Event.DeviceName, DeviceName)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Event for %v is not handled", DeviceName)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	mt "n9k-modeling/metrics"
+	m "n9k-modeling/modeling"
+	n "n9k-modeling/notifying"
+	p "n9k-modeling/polling"
+	s "n9k-modeling/storing"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+func main() {
+	PollerConfigFile := flag.String("config", "polling.json", "poller config with the interval, inventory and service instances to watch")
+	Listen := flag.String("listen", "", "address to serve the Prometheus /metrics endpoint on, empty disables it")
+	NotifyConfigFile := flag.String("notify", "", "notification sinks and severity rules to send the events to")
+	flag.Parse()
+
+	Config, Filter, Enrich := cu.Initialize("config.json")
+	ConversionMap := cu.CreateConversionMap()
+	MetaData := &m.MetaData{Config: Config, Filter: Filter, Enrich: Enrich, ConversionMap: ConversionMap}
+
+	Poller := p.NewPoller(p.LoadPollerConfig(*PollerConfigFile), MetaData)
+	Poller.Store = s.OpenConfigured("config.json")
+	if Poller.Store != nil {
+		defer Poller.Store.Close()
+	}
+	Poller.StateRepository = s.OpenConfiguredStateRepository("config.json")
+	if *NotifyConfigFile != "" {
+		Notifier := n.LoadNotifier(*NotifyConfigFile)
+		Poller.EventHandlers = append(Poller.EventHandlers, func(Event p.Event) {
+			Notifier.Notify(n.FromEvent(Event))
+		})
+	}
+
+	if *Listen != "" {
+		Mux := http.NewServeMux()
+		Mux.Handle("/metrics", mt.Handler())
+		go func() {
+			log.Fatal(http.ListenAndServe(*Listen, Mux))
+		}()
+	}
+
+	Stop := make(chan struct{})
+	Signals := make(chan os.Signal, 1)
+	signal.Notify(Signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-Signals
+		close(Stop)
+	}()
+
+	Poller.Run(Stop)
+}
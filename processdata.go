@@ -2,9 +2,14 @@ package main
 
 import (
 	"flag"
-	"sync"
+	"log"
 
+	df "n9k-modeling/diffing"
+	e "n9k-modeling/exporting"
+	mt "n9k-modeling/metrics"
 	m "n9k-modeling/modeling"
+	n "n9k-modeling/notifying"
+	s "n9k-modeling/storing"
 
 	cu "github.com/achelovekov/collectorutils"
 )
@@ -15,44 +20,73 @@ func main() {
 	ServiceDefinitionFile := flag.String("service", "00000", "service definition")
 	OutputFile := flag.String("out", "00000", "output file for result storage and template processing")
 	InventoryFile := flag.String("i", "00000", "inventory file to proceess")
+	ImportDir := flag.String("import", "", "directory with one saved sys.json or show running-config file per device to model instead of the inventory")
+	Export := flag.Bool("export", false, "export DME chunks, service data and layout to Elasticsearch from config.json")
+	MetricsFile := flag.String("metrics", "", "file to write Prometheus metrics of the run in for the node exporter textfile collector")
+	NotifyConfigFile := flag.String("notify", "", "notification sinks to send layout consistency violations to")
 	flag.Parse()
 
 	Config, Filter, Enrich := cu.Initialize("config.json")
-	Inventory := cu.LoadInventory(*InventoryFile)
+	var Inventory cu.Inventory
+	if *ImportDir != "" {
+		var err error
+		Inventory, err = m.LoadOfflineInventory(*ImportDir)
+		if err != nil {
+			log.Fatalf("Can't import device files: %v", err)
+		}
+		*InventoryFile = *ImportDir
+	} else {
+		Inventory = cu.LoadInventory(*InventoryFile)
+	}
 	ServiceDefinition := m.LoadServiceDefinition(*ServiceDefinitionFile)
 	KeysMap := m.LoadKeysMap(ServiceDefinition.DMEProcessing)
 	ConversionMap := cu.CreateConversionMap()
-	MetaData := &m.MetaData{Config: Config, Filter: Filter, Enrich: Enrich, KeysMap: KeysMap, ConversionMap: ConversionMap}
-
-	ch := make(chan m.RawDataDBEntry, len(Inventory))
-	var wg sync.WaitGroup
-
-	for _, v := range Inventory {
-		wg.Add(1)
-		go m.GetRawData(MetaData, v, "sys", ch, &wg)
+	MetaData := &m.MetaData{Config: Config, Filter: Filter, Enrich: Enrich, KeysMap: KeysMap, CLIMap: m.LoadCLIMap(ServiceDefinition.CLIProcessing), GNMIMap: m.LoadGNMIMap(ServiceDefinition.GNMIProcessing), PropInclude: ServiceDefinition.PropInclude, NETCONFFilter: ServiceDefinition.NETCONFFilter, ConversionMap: ConversionMap}
+
+	RawDataDB := m.CollectRawDataDB(MetaData, Inventory, "sys")
+	ProcessedData := m.ConstructProcessedData(ServiceDefinition, RawDataDB, *srcVal, MetaData.ConversionMap)
+
+	Run := s.NewRun(m.NewRunID(), *InventoryFile, ServiceDefinition.ServiceName, *srcVal)
+
+	if Store := s.OpenConfigured("config.json"); Store != nil {
+		defer Store.Close()
+		if err := s.SaveProcessedData(Store, Run, ProcessedData); err != nil {
+			log.Println("Can't store processed data:", err)
+		}
+		if err := s.SaveRawDataDB(Store, Run, RawDataDB); err != nil {
+			log.Println("Can't store raw data:", err)
+		}
+		log.Println("Run stored:", Run.RunID)
 	}
 
-	wg.Wait()
-	close(ch)
-
-	var RawDataDB m.RawDataDB
-
-	for elem := range ch {
-		RawDataDB = append(RawDataDB, elem)
+	if StateRepository := s.OpenConfiguredStateRepository("config.json"); StateRepository != nil {
+		if err := StateRepository.CommitProcessedData(Run, ProcessedData); err != nil {
+			log.Println("Can't commit processed data to the state repository:", err)
+		}
 	}
 
-	ServiceDataDB := make(m.ServiceDataDB, 0)
-	ServiceLayoutDB := make(m.ServiceLayoutDB, 0)
-
-	m.ConstructServiceDataDB(&ServiceDataDB, RawDataDB, *srcVal, ServiceDefinition.ServiceConstructPath, MetaData.ConversionMap)
-	m.ConstructServiceLayout(ServiceDefinition.ServiceComponents, ServiceDataDB, &ServiceLayoutDB)
+	if *Export {
+		esClient, err := cu.ESConnect(Config.ESHost, Config.ESPort)
+		if err == nil {
+			err = e.ExportRun(esClient, Config.ESIndex, Run, RawDataDB, ProcessedData)
+		}
+		if err != nil {
+			log.Println("Can't export run to Elasticsearch:", err)
+		}
+	}
 
-	var ProcessedData m.ProcessedData
-	ProcessedData.ServiceDataDB = ServiceDataDB
-	ProcessedData.ServiceLayoutDB = ServiceLayoutDB
-	ProcessedData.ServiceName = ServiceDefinition.ServiceName
+	if *NotifyConfigFile != "" {
+		Violations := df.CheckLayoutConsistency(ProcessedData, ServiceDefinition.ServiceConsistency)
+		n.LoadNotifier(*NotifyConfigFile).Notify(n.FromLayoutViolations(Run.ServiceName, Run.InstanceKey, Run.RunID, Violations)...)
+	}
 
 	MarshalledProcessedData := m.MarshalToJSON(ProcessedData)
 
 	m.WriteDataToFile(*OutputFile, MarshalledProcessedData)
+
+	if *MetricsFile != "" {
+		if err := mt.WriteTextfile(*MetricsFile); err != nil {
+			log.Println("Can't write metrics:", err)
+		}
+	}
 }
@@ -0,0 +1,305 @@
+package rendering
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	m "n9k-modeling/modeling"
+)
+
+type CLITemplatesDB map[string]CLITemplatesDBEntry
+type CLITemplatesDBEntry map[string]string
+
+func LoadCLITemplatesMap() CLITemplatesDB {
+	CLITemplatesDB := make(CLITemplatesDB)
+
+	VNITemplates := make(CLITemplatesDBEntry)
+	VNITemplates["L2VNI"] = `vlan {{key "l2BD.id"}}
+  name {{key "l2BD.name"}}
+  vn-segment {{key "vnid"}}
+evpn
+  vni {{key "vnid"}} l2
+    rd auto
+    route-target import {{rt "rtctrlRttEntry.rtt.import"}}
+    route-target export {{rt "rtctrlRttEntry.rtt.export"}}
+`
+	VNITemplates["AGW"] = `interface {{ifname "sviIf.id"}}
+  no shutdown
+  vrf member {{key "ipv4Dom.name"}}
+  ip address {{key "ipv4Addr.addr"}} tag {{key "ipv4Addr.tag"}}
+  fabric forwarding mode anycast-gateway
+`
+	VNITemplates["IR"] = `interface nve1
+  member vni {{key "nvoNw.vni"}}
+    ingress-replication protocol bgp
+`
+	VNITemplates["PIM"] = `interface nve1
+  member vni {{key "nvoNw.vni"}}
+    mcast-group {{key "nvoNw.mcastGroup"}}
+`
+	VNITemplates["MS-IR"] = `{{if eq (key "nvoNw.multisiteIngRepl") "enable"}}interface nve1
+  member vni {{key "nvoNw.vni"}}
+    multisite ingress-replication
+{{end}}`
+	VNITemplates["ARP-Suppress"] = `interface nve1
+  member vni {{key "nvoNw.vni"}}
+    suppress-arp
+`
+
+	VNITemplates["Leaf"] = ``
+	VNITemplates["BGW"] = `evpn multisite border-gateway {{key "nvoEvpnMultisiteBordergw.siteId"}}
+`
+	VNITemplates["DCI-Tracking"] = ``
+	VNITemplates["Fabric-Tracking"] = ``
+
+	CLITemplatesDB["VNI"] = VNITemplates
+
+	VRFTemplates := make(CLITemplatesDBEntry)
+	VRFTemplates["L3VNI"] = `vlan {{key "l2BD.id"}}
+  name {{key "l2BD.name"}}
+  vn-segment {{key "vnid"}}
+vrf context {{key "l3Inst.name"}}
+  vni {{key "vnid"}}
+  rd auto
+  address-family ipv4 unicast
+{{- if ne (key "rtctrlRttEntry.rtt.import") "route-target:unknown:0:0"}}
+    route-target import {{rt "rtctrlRttEntry.rtt.import"}} evpn
+{{- end}}
+{{- if ne (key "rtctrlRttEntry.rtt.export") "route-target:unknown:0:0"}}
+    route-target export {{rt "rtctrlRttEntry.rtt.export"}} evpn
+{{- end}}
+interface {{ifname "sviIf.id"}}
+  no shutdown
+  vrf member {{key "l3Inst.name"}}
+  ip forward
+router bgp {{key "bgpInst.asn"}}
+  vrf {{key "l3Inst.name"}}
+    address-family ipv4 unicast
+      advertise l2vpn evpn
+interface nve1
+  member vni {{key "vnid"}} associate-vrf
+`
+	VRFTemplates["RT-Auto"] = `vrf context {{key "l3Inst.name"}}
+  address-family ipv4 unicast
+    route-target both auto evpn
+`
+	VRFTemplates["Advertise-PIP"] = `router bgp {{key "bgpInst.asn"}}
+  address-family l2vpn evpn
+    advertise-pip
+interface nve1
+  advertise virtual-rmac
+`
+	VRFTemplates["BGW"] = `evpn multisite border-gateway {{key "nvoEvpnMultisiteBordergw.siteId"}}
+`
+
+	CLITemplatesDB["VRF"] = VRFTemplates
+
+	AccessPortTemplates := make(CLITemplatesDBEntry)
+	AccessPortTemplates["Access"] = `interface {{ifname "l1PhysIf.id"}}
+  switchport mode access
+  switchport access vlan {{trimprefix (key "l1PhysIf.accessVlan") "vlan-"}}
+`
+	AccessPortTemplates["Trunk"] = `interface {{ifname "l1PhysIf.id"}}
+  switchport mode trunk
+  switchport trunk allowed vlan {{key "l1PhysIf.trunkVlans"}}
+`
+	AccessPortTemplates["Port-Channel"] = `{{if has "l1PhysIf.id"}}interface {{ifname "l1PhysIf.id"}}
+  channel-group {{trimprefix (key "pcAggrIf.id") "po"}}{{if has "pcAggrIf.pcMode"}} mode {{key "pcAggrIf.pcMode"}}{{end}}
+{{end}}`
+	AccessPortTemplates["PC-Access"] = `interface {{ifname "pcAggrIf.id"}}
+  switchport mode access
+  switchport access vlan {{trimprefix (key "pcAggrIf.accessVlan") "vlan-"}}
+`
+	AccessPortTemplates["PC-Trunk"] = `interface {{ifname "pcAggrIf.id"}}
+  switchport mode trunk
+  switchport trunk allowed vlan {{key "pcAggrIf.trunkVlans"}}
+`
+	AccessPortTemplates["LACP"] = ``
+	AccessPortTemplates["vPC"] = `interface {{ifname "pcAggrIf.id"}}
+  vpc {{key "vpcIf.id"}}
+`
+
+	CLITemplatesDB["AccessPort"] = AccessPortTemplates
+
+	return CLITemplatesDB
+}
+
+func LoadCLITemplateOverrides(CLITemplatesDB CLITemplatesDB, ServiceName string, dirName string) {
+	Files, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if _, ok := CLITemplatesDB[ServiceName]; !ok {
+		CLITemplatesDB[ServiceName] = make(CLITemplatesDBEntry)
+	}
+	for _, File := range Files {
+		if File.IsDir() || filepath.Ext(File.Name()) != ".tmpl" {
+			continue
+		}
+		TemplateBytes, err := ioutil.ReadFile(filepath.Join(dirName, File.Name()))
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		CLITemplatesDB[ServiceName][strings.TrimSuffix(File.Name(), ".tmpl")] = string(TemplateBytes)
+	}
+}
+
+func ToRouteTarget(v string) string {
+	Fields := strings.Split(v, ":")
+	if len(Fields) < 2 {
+		return v
+	}
+	return strings.Join(Fields[len(Fields)-2:], ":")
+}
+
+func ToInterfaceName(v string) string {
+	if strings.HasPrefix(v, "vlan") {
+		return "Vlan" + strings.TrimPrefix(v, "vlan")
+	}
+	if strings.HasPrefix(v, "eth") {
+		return "Ethernet" + strings.TrimPrefix(v, "eth")
+	}
+	if strings.HasPrefix(v, "po") {
+		return "port-channel" + strings.TrimPrefix(v, "po")
+	}
+	return v
+}
+
+func CLIFuncMap(DeviceData m.DeviceData) template.FuncMap {
+	Value := func(Key string) (string, error) {
+		v, ok := DeviceData[Key]
+		if !ok {
+			return "", fmt.Errorf("no value for %v", Key)
+		}
+		return ToDMEValue(v), nil
+	}
+	return template.FuncMap{
+		"key": Value,
+		"has": func(Key string) bool {
+			_, ok := DeviceData[Key]
+			return ok
+		},
+		"rt": func(Key string) (string, error) {
+			v, err := Value(Key)
+			return ToRouteTarget(v), err
+		},
+		"ifname": func(Key string) (string, error) {
+			v, err := Value(Key)
+			return ToInterfaceName(v), err
+		},
+		"trimprefix": strings.TrimPrefix,
+	}
+}
+
+func RenderDeviceCLI(DeviceData m.DeviceData, ServiceLayout m.ServiceLayout, CLITemplatesDBEntry CLITemplatesDBEntry) (string, error) {
+	var CLI bytes.Buffer
+	FuncMap := CLIFuncMap(DeviceData)
+
+	for _, Component := range ServiceLayout {
+		if !Component.Value {
+			continue
+		}
+		Text, ok := CLITemplatesDBEntry[Component.Name]
+		if !ok {
+			return "", fmt.Errorf("no CLI template for component %v", Component.Name)
+		}
+		Template, err := template.New(Component.Name).Option("missingkey=error").Funcs(FuncMap).Parse(Text)
+		if err != nil {
+			return "", err
+		}
+		if err := Template.Execute(&CLI, DeviceData); err != nil {
+			return "", fmt.Errorf("component %v: %v", Component.Name, err)
+		}
+	}
+
+	return MergeCLIBlocks(CLI.String()), nil
+}
+
+// MergeCLIBlocks folds the blocks several components open for the same
+// context, e.g. "interface nve1 / member vni X" of PIM and ARP-Suppress, into
+// one block that keeps the lines in the order the components added them.
+func MergeCLIBlocks(Text string) string {
+	var CLI bytes.Buffer
+	WriteCLILines(&CLI, MergeConfigLines(m.ParseConfigLines(Text)), "")
+	return CLI.String()
+}
+
+func MergeConfigLines(Lines []*m.ConfigLine) []*m.ConfigLine {
+	Merged := make([]*m.ConfigLine, 0)
+	Seen := make(map[string]*m.ConfigLine)
+	for _, Line := range Lines {
+		if First, ok := Seen[Line.Text]; ok {
+			First.Children = append(First.Children, Line.Children...)
+			continue
+		}
+		First := &m.ConfigLine{Text: Line.Text, Children: append([]*m.ConfigLine(nil), Line.Children...)}
+		Seen[Line.Text] = First
+		Merged = append(Merged, First)
+	}
+	for _, Line := range Merged {
+		Line.Children = MergeConfigLines(Line.Children)
+	}
+	return Merged
+}
+
+func WriteCLILines(CLI *bytes.Buffer, Lines []*m.ConfigLine, Indent string) {
+	for _, Line := range Lines {
+		fmt.Fprintf(CLI, "%v%v\n", Indent, Line.Text)
+		WriteCLILines(CLI, Line.Children, Indent+"  ")
+	}
+}
+
+type CLIDataDB []CLIDataDBEntry
+type CLIDataDBEntry struct {
+	DeviceName string
+	CLI        string
+}
+
+func RenderTemplatedDataCLI(TemplatedData m.ProcessedData, CLITemplatesDB CLITemplatesDB) CLIDataDB {
+	CLIDataDB := make(CLIDataDB, 0)
+
+	ServiceLayouts := make(map[string]m.ServiceLayout)
+	for _, v := range TemplatedData.ServiceLayoutDB {
+		ServiceLayouts[v.DeviceName] = v.ServiceLayout
+	}
+
+	for _, Device := range TemplatedData.ServiceDataDB {
+		if len(Device.DeviceData) == 0 {
+			continue
+		}
+		CLI, err := RenderDeviceCLI(Device.DeviceData, ServiceLayouts[Device.DeviceName], CLITemplatesDB[TemplatedData.ServiceName])
+		if err != nil {
+			log.Println("Can't render CLI for device:", Device.DeviceName, err)
+			continue
+		}
+		CLIDataDB = append(CLIDataDB, CLIDataDBEntry{DeviceName: Device.DeviceName, CLI: CLI})
+	}
+
+	return CLIDataDB
+}
+
+func WriteCLIFiles(dirName string, CLIDataDB CLIDataDB) {
+	if err := os.MkdirAll(dirName, 0755); err != nil {
+		log.Fatalf(err.Error())
+	}
+	for _, v := range CLIDataDB {
+		m.WriteDataToFile(filepath.Join(dirName, v.DeviceName+".cfg"), []byte(v.CLI))
+	}
+}
+
+func CLIChangeDocument(ServiceName string, CLIDataDB CLIDataDB) []byte {
+	var Document bytes.Buffer
+	fmt.Fprintf(&Document, "! Service: %v\n", ServiceName)
+	for _, v := range CLIDataDB {
+		fmt.Fprintf(&Document, "!\n! Device: %v\n!\n%s", v.DeviceName, v.CLI)
+	}
+	return Document.Bytes()
+}
@@ -0,0 +1,161 @@
+package rendering
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	m "n9k-modeling/modeling"
+)
+
+func TestToRouteTarget(t *testing.T) {
+	for Value, Expected := range map[string]string{
+		"route-target:as2-nn4:65001:3001001":  "65001:3001001",
+		"route-target:ipv4-nn2:10.0.0.1:100":  "10.0.0.1:100",
+		"route-target:as4-nn2:4200000001:200": "4200000001:200",
+		"auto":                                "auto",
+	} {
+		if RT := ToRouteTarget(Value); RT != Expected {
+			t.Errorf("%v is %v, expected %v", Value, RT, Expected)
+		}
+	}
+}
+
+func TestToInterfaceName(t *testing.T) {
+	for Value, Expected := range map[string]string{
+		"vlan100":   "Vlan100",
+		"eth1/49":   "Ethernet1/49",
+		"po10":      "port-channel10",
+		"loopback1": "loopback1",
+	} {
+		if Name := ToInterfaceName(Value); Name != Expected {
+			t.Errorf("%v is %v, expected %v", Value, Name, Expected)
+		}
+	}
+}
+
+var VNIDeviceData = m.DeviceData{
+	"vnid":                      float64(2030100),
+	"l2BD.id":                   float64(100),
+	"l2BD.name":                 "web",
+	"rtctrlRttEntry.rtt.import": "route-target:as2-nn4:65001:2030100",
+	"rtctrlRttEntry.rtt.export": "route-target:as2-nn4:65001:2030100",
+	"sviIf.id":                  "vlan100",
+	"ipv4Dom.name":              "tenant",
+	"ipv4Addr.addr":             "10.1.0.1/24",
+	"ipv4Addr.tag":              float64(3901),
+	"nvoNw.vni":                 float64(2030100),
+	"nvoNw.mcastGroup":          "225.1.0.1",
+	"nvoNw.multisiteIngRepl":    "enable",
+	"nvoNw.suppressARP":         "enabled",
+}
+
+func Layout(Components ...string) m.ServiceLayout {
+	ServiceLayout := make(m.ServiceLayout, 0)
+	for _, Component := range Components {
+		ServiceLayout = append(ServiceLayout, m.ComponentBitMap{Name: Component, Value: true})
+	}
+	return append(ServiceLayout, m.ComponentBitMap{Name: "IR", Value: false})
+}
+
+func TestRenderDeviceCLI(t *testing.T) {
+	CLI, err := RenderDeviceCLI(VNIDeviceData, Layout("L2VNI", "AGW", "PIM", "MS-IR", "ARP-Suppress"), LoadCLITemplatesMap()["VNI"])
+	if err != nil {
+		t.Fatalf("Can't render CLI: %v", err)
+	}
+	Expected := `vlan 100
+  name web
+  vn-segment 2030100
+evpn
+  vni 2030100 l2
+    rd auto
+    route-target import 65001:2030100
+    route-target export 65001:2030100
+interface Vlan100
+  no shutdown
+  vrf member tenant
+  ip address 10.1.0.1/24 tag 3901
+  fabric forwarding mode anycast-gateway
+interface nve1
+  member vni 2030100
+    mcast-group 225.1.0.1
+    multisite ingress-replication
+    suppress-arp
+`
+	if CLI != Expected {
+		t.Errorf("Rendered CLI:\n%v\nExpected:\n%v", CLI, Expected)
+	}
+}
+
+func TestRenderDeviceCLIErrors(t *testing.T) {
+	DeviceData := make(m.DeviceData)
+	for Key, Value := range VNIDeviceData {
+		DeviceData[Key] = Value
+	}
+	delete(DeviceData, "l2BD.name")
+
+	for Component, Expected := range map[string]string{
+		"L2VNI":   "no value for l2BD.name",
+		"Unknown": "no CLI template for component Unknown",
+	} {
+		_, err := RenderDeviceCLI(DeviceData, Layout(Component), LoadCLITemplatesMap()["VNI"])
+		if err == nil || !strings.Contains(err.Error(), Expected) {
+			t.Errorf("Component %v: error %v, expected %v", Component, err, Expected)
+		}
+	}
+}
+
+func TestLoadCLITemplateOverrides(t *testing.T) {
+	Dir := t.TempDir()
+	for File, Text := range map[string]string{
+		"AGW.tmpl":   "interface {{ifname \"sviIf.id\"}}\n  vrf member {{key \"ipv4Dom.name\"}}\n  ip address {{key \"ipv4Addr.addr\"}}\n",
+		"PIM.txt":    "ignored\n",
+		"Extra.tmpl": "! {{key \"vnid\"}}\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(Dir, File), []byte(Text), 0644); err != nil {
+			t.Fatalf("Can't write %v: %v", File, err)
+		}
+	}
+
+	CLITemplatesDB := LoadCLITemplatesMap()
+	LoadCLITemplateOverrides(CLITemplatesDB, "VNI", Dir)
+	if _, ok := CLITemplatesDB["VNI"]["Extra"]; !ok {
+		t.Errorf("New component template is not loaded")
+	}
+	CLI, err := RenderDeviceCLI(VNIDeviceData, Layout("AGW", "PIM"), CLITemplatesDB["VNI"])
+	if err != nil {
+		t.Fatalf("Can't render CLI: %v", err)
+	}
+	Expected := `interface Vlan100
+  vrf member tenant
+  ip address 10.1.0.1/24
+interface nve1
+  member vni 2030100
+    mcast-group 225.1.0.1
+`
+	if CLI != Expected {
+		t.Errorf("Rendered CLI:\n%v\nExpected:\n%v", CLI, Expected)
+	}
+}
+
+func TestCLIChangeDocument(t *testing.T) {
+	Document := CLIChangeDocument("VNI", CLIDataDB{
+		{DeviceName: "leaf1", CLI: "interface nve1\n  member vni 2030100\n"},
+		{DeviceName: "leaf2", CLI: "vlan 100\n"},
+	})
+	Expected := `! Service: VNI
+!
+! Device: leaf1
+!
+interface nve1
+  member vni 2030100
+!
+! Device: leaf2
+!
+vlan 100
+`
+	if string(Document) != Expected {
+		t.Errorf("Change document:\n%s\nExpected:\n%v", Document, Expected)
+	}
+}
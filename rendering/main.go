@@ -0,0 +1,393 @@
+package rendering
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	m "n9k-modeling/modeling"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+type RenderSchema struct {
+	ClassChains    map[string][]string
+	KeyLinks       []KeyLink
+	OptionBaseKeys map[string]string
+	Options        map[string]m.Option
+}
+
+type KeyLink struct {
+	KeySName string
+	KeyDName string
+}
+
+func IsServiceNode(NodeName string) bool {
+	return NodeName != "imdata" && NodeName != "attributes" && NodeName != "children" && NodeName != "any"
+}
+
+func PathToClassChain(Path cu.Path) []string {
+	ClassChain := make([]string, 0)
+	for _, PathData := range Path.PathData {
+		for _, Node := range PathData.Node {
+			if IsServiceNode(Node.NodeName) {
+				ClassChain = append(ClassChain, Node.NodeName)
+			}
+		}
+	}
+	return ClassChain
+}
+
+func LoadRenderSchema(ServiceDefinition m.ServiceDefinition, KeysMap cu.KeysMap) RenderSchema {
+	var RenderSchema RenderSchema
+	RenderSchema.ClassChains = make(map[string][]string)
+	RenderSchema.OptionBaseKeys = make(map[string]string)
+	RenderSchema.Options = make(map[string]m.Option)
+
+	ChunkNames := make([]string, 0)
+	for ChunkName := range KeysMap {
+		ChunkNames = append(ChunkNames, ChunkName)
+	}
+	sort.Strings(ChunkNames)
+
+	for _, ChunkName := range ChunkNames {
+		for _, Path := range KeysMap[ChunkName] {
+			ClassChain := PathToClassChain(Path)
+			for i, Class := range ClassChain {
+				if _, ok := RenderSchema.ClassChains[Class]; !ok {
+					RenderSchema.ClassChains[Class] = ClassChain[:i+1]
+				}
+			}
+		}
+	}
+
+	for _, v := range ServiceDefinition.ServiceConstructPath {
+		if v.MatchType == "full" && v.KeyLink != "no-link" {
+			RenderSchema.KeyLinks = append(RenderSchema.KeyLinks, KeyLink{KeySName: v.KeySName, KeyDName: v.KeyDName})
+		}
+		for _, Option := range v.Options {
+			for _, Key := range v.KeyList {
+				RenderSchema.OptionBaseKeys[Key+"."+Option.OptionValue] = Key
+				RenderSchema.Options[Key+"."+Option.OptionValue] = Option
+			}
+		}
+	}
+
+	return RenderSchema
+}
+
+// OptionConditions flattens an option and the keys it is narrowed down with.
+func OptionConditions(Option m.Option) []m.Option {
+	Conditions := []m.Option{{OptionKey: Option.OptionKey, OptionValue: Option.OptionValue}}
+	for _, Match := range Option.Match {
+		Conditions = append(Conditions, OptionConditions(Match)...)
+	}
+	return Conditions
+}
+
+var NamingDefaults = map[string]map[string]string{
+	"nvoEp":        {"epId": "1"},
+	"rtctrlDomAf":  {"type": "ipv4-ucast"},
+	"rtctrlAfCtrl": {"type": "l2vpn-evpn"},
+}
+
+type DMENode struct {
+	Class      string
+	Attributes map[string]interface{}
+	Children   map[string]*DMENode
+}
+
+func NewDMENode(Class string) *DMENode {
+	Node := &DMENode{Class: Class, Attributes: make(map[string]interface{}), Children: make(map[string]*DMENode)}
+	for k, v := range NamingDefaults[Class] {
+		Node.Attributes[k] = v
+	}
+	return Node
+}
+
+func (n *DMENode) Child(Class string, Discriminator string) *DMENode {
+	NodeKey := Class + "|" + Discriminator
+	if _, ok := n.Children[NodeKey]; !ok {
+		n.Children[NodeKey] = NewDMENode(Class)
+	}
+	return n.Children[NodeKey]
+}
+
+func (n *DMENode) ToDME() map[string]interface{} {
+	Body := make(map[string]interface{})
+	if len(n.Attributes) > 0 {
+		Body["attributes"] = n.Attributes
+	}
+	if len(n.Children) > 0 {
+		NodeKeys := make([]string, 0)
+		for NodeKey := range n.Children {
+			NodeKeys = append(NodeKeys, NodeKey)
+		}
+		sort.Strings(NodeKeys)
+		Children := make([]map[string]interface{}, 0)
+		for _, NodeKey := range NodeKeys {
+			Children = append(Children, n.Children[NodeKey].ToDME())
+		}
+		Body["children"] = Children
+	}
+	return map[string]interface{}{n.Class: Body}
+}
+
+func ToDMEValue(v interface{}) string {
+	switch Value := v.(type) {
+	case string:
+		return Value
+	case float64:
+		return strconv.FormatFloat(Value, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(Value, 10)
+	case bool:
+		if Value {
+			return "yes"
+		}
+		return "no"
+	default:
+		return fmt.Sprint(Value)
+	}
+}
+
+func SplitKey(Key string) (string, string, bool) {
+	Index := strings.Index(Key, ".")
+	if Index <= 0 || Index == len(Key)-1 || strings.Contains(Key, "/") {
+		return "", "", false
+	}
+	return Key[:Index], Key[Index+1:], true
+}
+
+func LinkDeviceData(DeviceData m.DeviceData, RenderSchema RenderSchema) m.DeviceData {
+	Linked := make(m.DeviceData)
+	for k, v := range DeviceData {
+		Linked[k] = v
+	}
+	for _, KeyLink := range RenderSchema.KeyLinks {
+		if _, ok := Linked[KeyLink.KeyDName]; ok {
+			continue
+		}
+		if Class, _, ok := SplitKey(KeyLink.KeyDName); ok && !HasClassData(DeviceData, RenderSchema, Class) {
+			continue
+		}
+		if v, ok := Linked[KeyLink.KeySName]; ok {
+			Linked[KeyLink.KeyDName] = v
+		}
+	}
+	return Linked
+}
+
+func RenderDevice(DeviceData m.DeviceData, RenderSchema RenderSchema, SkipKeys []string) (map[string]interface{}, error) {
+	Skip := make(map[string]bool)
+	for _, Key := range SkipKeys {
+		Skip[Key] = true
+	}
+
+	Linked := LinkDeviceData(DeviceData, RenderSchema)
+
+	Keys := make([]string, 0)
+	for Key := range Linked {
+		Keys = append(Keys, Key)
+	}
+	sort.Strings(Keys)
+
+	Root := NewDMENode("root")
+	for _, Key := range Keys {
+		if Skip[Key] {
+			continue
+		}
+
+		var Option m.Option
+		var HasOption bool
+		AttrKey := Key
+		if BaseKey, ok := RenderSchema.OptionBaseKeys[Key]; ok {
+			Option = RenderSchema.Options[Key]
+			HasOption = true
+			AttrKey = BaseKey
+		}
+
+		Class, Attr, ok := SplitKey(AttrKey)
+		if !ok {
+			continue
+		}
+		ClassChain, ok := RenderSchema.ClassChains[Class]
+		if !ok {
+			log.Println("No path file describes class", Class, "for key", Key)
+			continue
+		}
+
+		Conditions := make(map[string]m.Option)
+		if HasOption {
+			for _, Condition := range OptionConditions(Option) {
+				ConditionClass, _, _ := SplitKey(Condition.OptionKey)
+				if ConditionClass == "" {
+					return nil, fmt.Errorf("Option key %v for %v has no class", Condition.OptionKey, Key)
+				}
+				Conditions[ConditionClass] = Condition
+			}
+		}
+
+		Discriminator := ""
+		Node := Root
+		for _, ChainClass := range ClassChain {
+			if Condition, ok := Conditions[ChainClass]; ok {
+				_, ConditionAttr, _ := SplitKey(Condition.OptionKey)
+				Discriminator = Discriminator + "/" + Condition.OptionValue
+				Node = Node.Child(ChainClass, Discriminator)
+				Node.Attributes[ConditionAttr] = Condition.OptionValue
+				continue
+			}
+			Node = Node.Child(ChainClass, Discriminator)
+		}
+		Node.Attributes[Attr] = ToDMEValue(Linked[Key])
+	}
+
+	if len(Root.Children) != 1 {
+		return nil, fmt.Errorf("Rendered payload must have exactly one root MO, got %v", len(Root.Children))
+	}
+	for _, Top := range Root.Children {
+		return Top.ToDME(), nil
+	}
+	return nil, nil
+}
+
+type RenderedDataDB []RenderedDataDBEntry
+type RenderedDataDBEntry struct {
+	DeviceName string                   `json:"DeviceName"`
+	Payload    map[string]interface{}   `json:"Payload,omitempty"`
+	Payloads   []map[string]interface{} `json:"Payloads,omitempty"`
+}
+
+type RenderedData struct {
+	ServiceName    string         `json:"ServiceName"`
+	RenderedDataDB RenderedDataDB `json:"RenderedDataDB"`
+	VPCPairs       []m.VPCPair    `json:"VPCPairs,omitempty"`
+}
+
+func RenderTemplatedData(TemplatedData m.ProcessedData, RenderSchema RenderSchema, SkipKeys []string) RenderedData {
+	var RenderedData RenderedData
+	RenderedData.ServiceName = TemplatedData.ServiceName
+	RenderedData.RenderedDataDB = make(RenderedDataDB, 0)
+	RenderedData.VPCPairs = TemplatedData.VPCPairs
+
+	for _, Device := range TemplatedData.ServiceDataDB {
+		if len(Device.DeviceData) == 0 {
+			continue
+		}
+		Payload, err := RenderDevice(Device.DeviceData, RenderSchema, SkipKeys)
+		if err != nil {
+			log.Println("Can't render payload for device:", Device.DeviceName, err)
+			continue
+		}
+		RenderedData.RenderedDataDB = append(RenderedData.RenderedDataDB, RenderedDataDBEntry{DeviceName: Device.DeviceName, Payload: Payload})
+	}
+
+	return RenderedData
+}
+
+func HasClassData(DeviceData m.DeviceData, RenderSchema RenderSchema, Class string) bool {
+	for Key := range DeviceData {
+		if BaseKey, ok := RenderSchema.OptionBaseKeys[Key]; ok {
+			Key = BaseKey
+		}
+		KeyClass, _, ok := SplitKey(Key)
+		if !ok {
+			continue
+		}
+		for _, ChainClass := range RenderSchema.ClassChains[KeyClass] {
+			if ChainClass == Class {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func RenderRemovalStep(Linked m.DeviceData, RenderSchema RenderSchema, RemovalStep m.RemovalStep) (map[string]interface{}, bool) {
+	ClassChain, ok := RenderSchema.ClassChains[RemovalStep.Class]
+	if !ok {
+		log.Println("No path file describes class", RemovalStep.Class)
+		return nil, false
+	}
+
+	Naming := make(map[string]map[string]interface{})
+	for _, Key := range RemovalStep.NamingKeys {
+		v, ok := Linked[Key]
+		if !ok {
+			return nil, false
+		}
+		Class, Attr, ok := SplitKey(Key)
+		if !ok {
+			return nil, false
+		}
+		if _, ok := Naming[Class]; !ok {
+			Naming[Class] = make(map[string]interface{})
+		}
+		Naming[Class][Attr] = ToDMEValue(v)
+	}
+
+	Root := NewDMENode("root")
+	Node := Root
+	for _, ChainClass := range ClassChain {
+		Node = Node.Child(ChainClass, "")
+		for Attr, v := range Naming[ChainClass] {
+			Node.Attributes[Attr] = v
+		}
+	}
+	Node.Attributes["status"] = "deleted"
+
+	for _, Top := range Root.Children {
+		return Top.ToDME(), true
+	}
+	return nil, false
+}
+
+func RenderRemoval(ProcessedData m.ProcessedData, RenderSchema RenderSchema, ServiceRemoval m.ServiceRemoval) RenderedData {
+	var RenderedData RenderedData
+	RenderedData.ServiceName = ProcessedData.ServiceName
+	RenderedData.VPCPairs = ProcessedData.VPCPairs
+	RenderedData.RenderedDataDB = make(RenderedDataDB, 0)
+
+	for _, Device := range ProcessedData.ServiceDataDB {
+		Linked := LinkDeviceData(Device.DeviceData, RenderSchema)
+		Payloads := make([]map[string]interface{}, 0)
+		for _, RemovalStep := range ServiceRemoval {
+			if !HasClassData(Device.DeviceData, RenderSchema, RemovalStep.Class) {
+				continue
+			}
+			if Payload, ok := RenderRemovalStep(Linked, RenderSchema, RemovalStep); ok {
+				Payloads = append(Payloads, Payload)
+			}
+		}
+		if len(Payloads) == 0 {
+			continue
+		}
+		RenderedData.RenderedDataDB = append(RenderedData.RenderedDataDB, RenderedDataDBEntry{DeviceName: Device.DeviceName, Payloads: Payloads})
+	}
+
+	return RenderedData
+}
+
+func LoadRenderedData(fileName string) RenderedData {
+	var RenderedData RenderedData
+	RenderedDataFile, err := os.Open(fileName)
+	if err != nil {
+		log.Println(err)
+	}
+	defer RenderedDataFile.Close()
+
+	RenderedDataFileBytes, _ := ioutil.ReadAll(RenderedDataFile)
+
+	err = json.Unmarshal(RenderedDataFileBytes, &RenderedData)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return RenderedData
+}
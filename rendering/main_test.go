@@ -0,0 +1,98 @@
+package rendering
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	m "n9k-modeling/modeling"
+)
+
+func TestRenderDeviceOptionMatch(t *testing.T) {
+	EVPN := []m.Option{{OptionKey: "rtctrlAfCtrl.type", OptionValue: "l2vpn-evpn"}}
+	Export := m.Option{OptionKey: "rtctrlRttP.type", OptionValue: "export", Match: EVPN}
+	AdvPip := m.Option{OptionKey: "bgpDomAf.type", OptionValue: "l2vpn-evpn", Match: []m.Option{{OptionKey: "bgpDom.name", OptionValue: "default"}}}
+	RenderSchema := RenderSchema{
+		ClassChains: map[string][]string{
+			"bgpDomAf":       {"bgpEntity", "bgpInst", "bgpDom", "bgpDomAf"},
+			"bgpDom":         {"bgpEntity", "bgpInst", "bgpDom"},
+			"rtctrlRttEntry": {"inst", "dom", "af", "rtctrlAfCtrl", "rtctrlRttP", "rtctrlRttEntry"},
+		},
+		KeyLinks: []KeyLink{{KeySName: "l3Inst.name", KeyDName: "bgpDom.name"}},
+		OptionBaseKeys: map[string]string{
+			"rtctrlRttEntry.rtt.export":  "rtctrlRttEntry.rtt",
+			"bgpDomAf.advPip.l2vpn-evpn": "bgpDomAf.advPip",
+		},
+		Options: map[string]m.Option{
+			"rtctrlRttEntry.rtt.export":  Export,
+			"bgpDomAf.advPip.l2vpn-evpn": AdvPip,
+		},
+	}
+
+	Payload, err := RenderDevice(m.DeviceData{"l3Inst.name": "TENANT", "bgpDomAf.advPip.l2vpn-evpn": "enabled"}, RenderSchema, nil)
+	if err != nil {
+		t.Fatalf("Can't render: %v", err)
+	}
+	JSONData, _ := json.Marshal(Payload)
+	for _, Expected := range []string{
+		`"bgpDom":{"attributes":{"name":"TENANT"}}`,
+		`"bgpDom":{"attributes":{"name":"default"},"children":[{"bgpDomAf":{"attributes":{"advPip":"enabled","type":"l2vpn-evpn"}}}]}`,
+	} {
+		if !strings.Contains(string(JSONData), Expected) {
+			t.Errorf("Payload %s has no %s", JSONData, Expected)
+		}
+	}
+
+	Payload, err = RenderDevice(m.DeviceData{"rtctrlRttEntry.rtt.export": "route-target:as2-nn4:65001:3001001"}, RenderSchema, nil)
+	if err != nil {
+		t.Fatalf("Can't render: %v", err)
+	}
+	JSONData, _ = json.Marshal(Payload)
+	Expected := `"rtctrlAfCtrl":{"attributes":{"type":"l2vpn-evpn"},"children":[{"rtctrlRttP":{"attributes":{"type":"export"},"children":[{"rtctrlRttEntry":{"attributes":{"rtt":"route-target:as2-nn4:65001:3001001"}}}]}}]}`
+	if !strings.Contains(string(JSONData), Expected) {
+		t.Errorf("Payload %s has no %s", JSONData, Expected)
+	}
+}
+
+func LoadTestSchema(t *testing.T, fileName string) (m.ServiceDefinition, RenderSchema) {
+	ServiceDefinition := m.LoadServiceDefinition(filepath.Join("..", fileName))
+	if ServiceDefinition.ServiceName == "" {
+		t.Fatalf("Can't load service definition %v", fileName)
+	}
+	for i := range ServiceDefinition.DMEProcessing {
+		for j := range ServiceDefinition.DMEProcessing[i].Paths {
+			ServiceDefinition.DMEProcessing[i].Paths[j].Path = filepath.Join("..", ServiceDefinition.DMEProcessing[i].Paths[j].Path)
+		}
+	}
+	return ServiceDefinition, LoadRenderSchema(ServiceDefinition, m.LoadKeysMap(ServiceDefinition.DMEProcessing))
+}
+
+func TestRenderRemoval(t *testing.T) {
+	ServiceDefinition, RenderSchema := LoadTestSchema(t, "VNI.service")
+	ProcessedData := m.ProcessedData{ServiceName: "VNI", ServiceDataDB: m.ServiceDataDB{{DeviceName: "leaf1", DeviceData: m.DeviceData{
+		"vnid":              float64(10100),
+		"l2BD.id":           float64(100),
+		"l2BD.fabEncap":     "vlan-100",
+		"l2BD.accEncap":     "vxlan-10100",
+		"l2BD.name":         "web",
+		"sviIf.id":          "vlan100",
+		"hmmFwdIf.mode":     "anycastGW",
+		"nvoNw.vni":         float64(10100),
+		"nvoNw.suppressARP": "enabled",
+	}}}, VPCPairs: []m.VPCPair{{DomainID: "10", Devices: []string{"leaf1", "leaf2"}}}}
+
+	RenderedData := RenderRemoval(ProcessedData, RenderSchema, ServiceDefinition.ServiceRemoval)
+	if len(RenderedData.RenderedDataDB) != 1 || len(RenderedData.VPCPairs) != 1 {
+		t.Fatalf("Unexpected removal: %+v", RenderedData)
+	}
+	Expected := `{"topSystem":{"children":[{"bdEntity":{"children":[{"l2BD":{"attributes":{"fabEncap":"vlan-100","status":"deleted"}}}]}}]}}`
+	Found := false
+	for _, Payload := range RenderedData.RenderedDataDB[0].Payloads {
+		JSONData, _ := json.Marshal(Payload)
+		Found = Found || string(JSONData) == Expected
+	}
+	if !Found {
+		t.Errorf("Removal payloads %+v have no %s", RenderedData.RenderedDataDB[0].Payloads, Expected)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"log"
+	m "n9k-modeling/modeling"
+	r "n9k-modeling/rendering"
+	s "n9k-modeling/storing"
+	t "n9k-modeling/templating"
+)
+
+func main() {
+	ServiceDefinitionFile := flag.String("service", "00000", "service definition with path files to use as the DME schema")
+	varsFile := flag.String("varsFile", "00000", "file contains the service variables, AddOptions keys are not rendered; a stored run keeps its own")
+	InputFile := flag.String("in", "00000", "file contains templated data, or processed data with -remove")
+	Remove := flag.Bool("remove", false, "render ordered delete payloads for everything modeled in the processed data")
+	OutputFile := flag.String("out", "00000", "file to write the per-device DME payloads in")
+	RunID := flag.String("run", "", "stored run to read the data from instead of the input file")
+	flag.Parse()
+
+	ServiceDefinition := m.LoadServiceDefinition(*ServiceDefinitionFile)
+	KeysMap := m.LoadKeysMap(ServiceDefinition.DMEProcessing)
+	RenderSchema := r.LoadRenderSchema(ServiceDefinition, KeysMap)
+
+	var InputData m.ProcessedData
+	var AddOptions []string
+	if *RunID != "" {
+		Store := s.OpenConfiguredReadOnly("config.json")
+		if Store == nil {
+			log.Fatalf("No store is configured to read run %v from", *RunID)
+		}
+		defer Store.Close()
+		var err error
+		if *Remove {
+			InputData, err = s.LoadProcessedData(Store, s.Query{RunID: *RunID})
+		} else {
+			InputData, err = s.LoadTemplatedData(Store, s.Query{RunID: *RunID})
+		}
+		if err != nil {
+			log.Fatalf("Can't load run %v: %v", *RunID, err)
+		}
+		Run, _ := s.FindRun(Store, *RunID)
+		AddOptions = Run.AddOptions
+	} else {
+		InputData = t.LoadProcessedData(*InputFile)
+		if !*Remove {
+			AddOptions = t.LoadTemplateData(*varsFile).AddOptions
+		}
+	}
+
+	var RenderedData r.RenderedData
+	if *Remove {
+		RenderedData = r.RenderRemoval(InputData, RenderSchema, ServiceDefinition.ServiceRemoval)
+	} else {
+		RenderedData = r.RenderTemplatedData(InputData, RenderSchema, AddOptions)
+	}
+
+	MarshalledRenderedData := m.MarshalToJSON(RenderedData)
+	m.WriteDataToFile(*OutputFile, MarshalledRenderedData)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+	d "n9k-modeling/deploying"
+	"strings"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+func main() {
+	RunID := flag.String("run", "00000", "deployment run to roll back")
+	Devices := flag.String("devices", "", "comma separated devices to roll back, all devices changed in the run by default")
+	InventoryFile := flag.String("i", "00000", "inventory file with the devices to roll back")
+	LogFile := flag.String("log", "deployments.json", "deployment log file with the run and its checkpoints")
+	flag.Parse()
+
+	Inventory := cu.LoadInventory(*InventoryFile)
+	DeploymentLog := d.LoadDeploymentLog(*LogFile)
+
+	DeployReport, ok := DeploymentLog.FindRun(*RunID)
+	if !ok {
+		log.Fatalf("Run %v is not in the deployment log %v", *RunID, *LogFile)
+	}
+
+	var DeviceList []string
+	if *Devices != "" {
+		DeviceList = strings.Split(*Devices, ",")
+	}
+
+	d.RollbackDevices(&DeployReport, Inventory, DeviceList)
+	d.WriteDeploymentLog(*LogFile, DeployReport)
+}
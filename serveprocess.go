@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	m "n9k-modeling/modeling"
+	n "n9k-modeling/notifying"
+	p "n9k-modeling/polling"
+	sv "n9k-modeling/serving"
+	s "n9k-modeling/storing"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+func IsLoopback(Listen string) bool {
+	Host, _, err := net.SplitHostPort(Listen)
+	if err != nil {
+		return false
+	}
+	if Host == "localhost" {
+		return true
+	}
+	IP := net.ParseIP(Host)
+	return IP != nil && IP.IsLoopback()
+}
+
+func main() {
+	Listen := flag.String("listen", "127.0.0.1:8080", "address to serve the REST API on")
+	TokenFile := flag.String("token", "", "file with the bearer token the REST API requires, needed to listen beyond localhost")
+	ServiceDefinitionFiles := flag.String("services", "VNI.service", "comma separated service definitions to serve")
+	InventoryDir := flag.String("inventories", ".", "directory with the inventory files requests can select")
+	LogFile := flag.String("log", "deployments.json", "deployment log file to record the deploy jobs and their checkpoints in")
+	PollerConfigFile := flag.String("poll", "", "poller config to keep re-modeling the instances in the background")
+	NotifyConfigFile := flag.String("notify", "", "notification sinks and severity rules to send the poller events to")
+	flag.Parse()
+
+	Config, Filter, Enrich := cu.Initialize("config.json")
+	ConversionMap := cu.CreateConversionMap()
+	MetaData := &m.MetaData{Config: Config, Filter: Filter, Enrich: Enrich, ConversionMap: ConversionMap}
+
+	Server := sv.NewServer(MetaData, strings.Split(*ServiceDefinitionFiles, ","), *InventoryDir, *LogFile)
+	if *TokenFile != "" {
+		Token, err := ioutil.ReadFile(*TokenFile)
+		if err != nil || len(bytes.TrimSpace(Token)) == 0 {
+			log.Fatalf("Can't read the API token from %v: %v", *TokenFile, err)
+		}
+		Server.Token = string(bytes.TrimSpace(Token))
+	} else if !IsLoopback(*Listen) {
+		log.Fatalf("Refusing to serve the REST API on %v without a -token", *Listen)
+	}
+	Server.Store = s.OpenConfigured("config.json")
+	if Server.Store != nil {
+		defer Server.Store.Close()
+	}
+	Server.StateRepository = s.OpenConfiguredStateRepository("config.json")
+
+	if *PollerConfigFile != "" {
+		Poller := p.NewPoller(p.LoadPollerConfig(*PollerConfigFile), MetaData)
+		Poller.Store = Server.Store
+		Poller.StateRepository = Server.StateRepository
+		Poller.OnRun = func(Run s.RunMetaData, ProcessedData m.ProcessedData) {
+			Server.SetInstance(Run, ProcessedData)
+		}
+		if *NotifyConfigFile != "" {
+			Notifier := n.LoadNotifier(*NotifyConfigFile)
+			Poller.EventHandlers = append(Poller.EventHandlers, func(Event p.Event) {
+				Notifier.Notify(n.FromEvent(Event))
+			})
+		}
+		Server.Poller = Poller
+		go Poller.Run(make(chan struct{}))
+	}
+
+	log.Println("Serving the REST API on", *Listen)
+	log.Fatal(http.ListenAndServe(*Listen, Server.Handler()))
+}
@@ -0,0 +1,236 @@
+package serving
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	d "n9k-modeling/deploying"
+	m "n9k-modeling/modeling"
+	r "n9k-modeling/rendering"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+
+	MaxFinishedJobs = 100
+)
+
+type DeployRequest struct {
+	Service    string   `json:"Service"`
+	Key        string   `json:"Key"`
+	Inventory  string   `json:"Inventory"`
+	Devices    []string `json:"Devices"`
+	DryRun     bool     `json:"DryRun"`
+	BatchSize  int      `json:"BatchSize"`
+	Checkpoint *bool    `json:"Checkpoint"`
+	Rollback   string   `json:"Rollback"`
+	Remove     bool     `json:"Remove"`
+}
+
+type Job struct {
+	ID       string          `json:"ID"`
+	Request  DeployRequest   `json:"Request"`
+	Status   string          `json:"Status"`
+	Error    string          `json:"Error,omitempty"`
+	Created  time.Time       `json:"Created"`
+	Finished *time.Time      `json:"Finished,omitempty"`
+	Report   *d.DeployReport `json:"Report,omitempty"`
+}
+
+func (srv *Server) HandleDeploy(w http.ResponseWriter, req *http.Request) {
+	if !CheckMethod(w, req, http.MethodPost) {
+		return
+	}
+	DeployRequest := DeployRequest{Rollback: d.RollbackDevice}
+	if !DecodeRequest(w, req, &DeployRequest) {
+		return
+	}
+	if _, ok := srv.Services[DeployRequest.Service]; !ok {
+		WriteError(w, http.StatusNotFound, fmt.Errorf("Unknown service: %v", DeployRequest.Service))
+		return
+	}
+	switch DeployRequest.Rollback {
+	case d.RollbackNone, d.RollbackDevice, d.RollbackFabric:
+	default:
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("Unknown rollback policy: %v", DeployRequest.Rollback))
+		return
+	}
+	Instance, err := srv.FindInstance(DeployRequest.Service, DeployRequest.Key, "")
+	if err != nil {
+		WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if !DeployRequest.Remove && Instance.TemplatedData == nil {
+		WriteError(w, http.StatusConflict, fmt.Errorf("Instance %v of service %v is not templated", DeployRequest.Key, DeployRequest.Service))
+		return
+	}
+	if DeployRequest.Inventory == "" {
+		DeployRequest.Inventory = Instance.Inventory
+	}
+	Inventory, err := srv.LoadInventory(DeployRequest.Inventory, DeployRequest.Devices)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	srv.Mutex.Lock()
+	for _, Job := range srv.Jobs {
+		if (Job.Status == JobQueued || Job.Status == JobRunning) && Job.Request.Service == DeployRequest.Service && Job.Request.Key == DeployRequest.Key {
+			srv.Mutex.Unlock()
+			WriteError(w, http.StatusConflict, fmt.Errorf("Job %v is already deploying instance %v of service %v", Job.ID, DeployRequest.Key, DeployRequest.Service))
+			return
+		}
+	}
+	srv.PruneJobs()
+	srv.JobCount++
+	Job := &Job{ID: fmt.Sprintf("%v-%v", m.NewRunID(), srv.JobCount), Request: DeployRequest, Status: JobQueued, Created: time.Now().UTC()}
+	srv.Jobs[Job.ID] = Job
+	Snapshot := *Job
+	srv.Mutex.Unlock()
+
+	RunJob := srv.RunDeployJob
+	if srv.RunJob != nil {
+		RunJob = srv.RunJob
+	}
+	go RunJob(Job, Instance, Inventory)
+
+	w.Header().Set("Location", "/jobs/"+Snapshot.ID)
+	WriteJSON(w, http.StatusAccepted, Snapshot)
+}
+
+// PruneJobs drops the oldest finished jobs beyond MaxFinishedJobs, the caller
+// holds srv.Mutex.
+func (srv *Server) PruneJobs() {
+	Finished := make([]*Job, 0)
+	for _, Job := range srv.Jobs {
+		if Job.Finished != nil {
+			Finished = append(Finished, Job)
+		}
+	}
+	if len(Finished) <= MaxFinishedJobs {
+		return
+	}
+	sort.Slice(Finished, func(i, j int) bool { return Finished[i].Finished.Before(*Finished[j].Finished) })
+	for _, Job := range Finished[:len(Finished)-MaxFinishedJobs] {
+		delete(srv.Jobs, Job.ID)
+	}
+}
+
+func (srv *Server) SetJobStatus(Job *Job, Status string, err error, Report *d.DeployReport) {
+	srv.Mutex.Lock()
+	defer srv.Mutex.Unlock()
+	Job.Status = Status
+	if err != nil {
+		Job.Error = err.Error()
+	}
+	if Report != nil {
+		Job.Report = Report
+	}
+	if Status == JobDone || Status == JobFailed {
+		Finished := time.Now().UTC()
+		Job.Finished = &Finished
+	}
+}
+
+func (srv *Server) RunDeployJob(Job *Job, Instance *Instance, Inventory cu.Inventory) {
+	srv.SetJobStatus(Job, JobRunning, nil, nil)
+	Request := Job.Request
+
+	ServiceDefinition := srv.Services[Request.Service]
+	MetaData := srv.MetaDataFor(Request.Service)
+	RenderSchema := r.LoadRenderSchema(ServiceDefinition, MetaData.KeysMap)
+
+	var RenderedData r.RenderedData
+	if Request.Remove {
+		RenderedData = r.RenderRemoval(Instance.ProcessedData, RenderSchema, ServiceDefinition.ServiceRemoval)
+	} else {
+		RenderedData = r.RenderTemplatedData(*Instance.TemplatedData, RenderSchema, Instance.AddOptions)
+	}
+	if len(RenderedData.RenderedDataDB) == 0 {
+		srv.SetJobStatus(Job, JobFailed, errors.New("Nothing to deploy"), nil)
+		return
+	}
+
+	Checkpoint := true
+	if Request.Checkpoint != nil {
+		Checkpoint = *Request.Checkpoint
+	}
+	DeployOptions := d.DeployOptions{DryRun: Request.DryRun, BatchSize: Request.BatchSize, Checkpoint: Checkpoint, RunID: m.NewRunID()}
+	DeployOptions.Record = func(DeployReport d.DeployReport) {
+		srv.LogMutex.Lock()
+		d.WriteDeploymentLog(srv.LogFile, DeployReport)
+		srv.LogMutex.Unlock()
+	}
+	DeployReport := d.Deploy(RenderedData, Inventory, DeployOptions)
+
+	if !Request.DryRun {
+		if Request.Remove {
+			d.VerifyRemoval(MetaData, ServiceDefinition, Request.Key, RenderSchema, Inventory, &DeployReport)
+		} else {
+			d.VerifyDeployment(MetaData, ServiceDefinition, Request.Key, *Instance.TemplatedData, Inventory, &DeployReport)
+		}
+		d.Rollback(&DeployReport, Inventory, Request.Rollback)
+		srv.LogMutex.Lock()
+		d.WriteDeploymentLog(srv.LogFile, DeployReport)
+		srv.LogMutex.Unlock()
+	}
+
+	Failed := make([]string, 0)
+	for _, Entry := range DeployReport.Entries {
+		if Entry.Status == d.StatusFailed || (!Request.DryRun && Entry.Status == d.StatusDeployed && !Entry.Verified) {
+			Failed = append(Failed, Entry.DeviceName)
+		}
+	}
+	if len(Failed) > 0 {
+		srv.SetJobStatus(Job, JobFailed, fmt.Errorf("Deployment failed on %v", strings.Join(Failed, ", ")), &DeployReport)
+		log.Println("Deploy job failed:", Job.ID, Failed)
+	} else {
+		srv.SetJobStatus(Job, JobDone, nil, &DeployReport)
+		log.Println("Deploy job done:", Job.ID)
+	}
+}
+
+func (srv *Server) HandleJobs(w http.ResponseWriter, req *http.Request) {
+	if !CheckMethod(w, req, http.MethodGet) {
+		return
+	}
+	srv.Mutex.Lock()
+	Jobs := make([]Job, 0)
+	for _, Job := range srv.Jobs {
+		Jobs = append(Jobs, *Job)
+	}
+	srv.Mutex.Unlock()
+	sort.Slice(Jobs, func(i, j int) bool {
+		return Jobs[i].Created.Before(Jobs[j].Created) || (Jobs[i].Created.Equal(Jobs[j].Created) && Jobs[i].ID < Jobs[j].ID)
+	})
+	WriteJSON(w, http.StatusOK, Jobs)
+}
+
+func (srv *Server) HandleJob(w http.ResponseWriter, req *http.Request) {
+	if !CheckMethod(w, req, http.MethodGet) {
+		return
+	}
+	ID := strings.Trim(strings.TrimPrefix(req.URL.Path, "/jobs/"), "/")
+	srv.Mutex.Lock()
+	Current, ok := srv.Jobs[ID]
+	var Snapshot Job
+	if ok {
+		Snapshot = *Current
+	}
+	srv.Mutex.Unlock()
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Errorf("Unknown job: %v", ID))
+		return
+	}
+	WriteJSON(w, http.StatusOK, Snapshot)
+}
@@ -0,0 +1,127 @@
+package serving
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	d "n9k-modeling/deploying"
+	s "n9k-modeling/storing"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+func WaitForJob(t *testing.T, Handler http.Handler, ID string, Status string) Job {
+	var Job Job
+	for Deadline := time.Now().Add(5 * time.Second); time.Now().Before(Deadline); time.Sleep(10 * time.Millisecond) {
+		if w := Request(t, Handler, http.MethodGet, "/jobs/"+ID, "", "", &Job); w.Code != http.StatusOK {
+			t.Fatalf("GET of job %v is %v", ID, w.Code)
+		}
+		if Job.Status == Status {
+			return Job
+		}
+	}
+	t.Fatalf("Job %v is %v, expected %v", ID, Job.Status, Status)
+	return Job
+}
+
+func TestDeployJobLifecycle(t *testing.T) {
+	Server := NewTestServer(t)
+	Release := make(chan error)
+	Inventories := make(chan cu.Inventory, 2)
+	Server.RunJob = func(Job *Job, Instance *Instance, Inventory cu.Inventory) {
+		Inventories <- Inventory
+		Server.SetJobStatus(Job, JobRunning, nil, nil)
+		if err := <-Release; err != nil {
+			Server.SetJobStatus(Job, JobFailed, err, nil)
+			return
+		}
+		Server.SetJobStatus(Job, JobDone, nil, &d.DeployReport{RunID: "deploy-1", ServiceName: Instance.Run.ServiceName})
+	}
+	Handler := Server.Handler()
+	Body := `{"Service": "VNI", "Key": "10100", "Devices": ["leaf2"]}`
+
+	Server.SetInstance(s.NewRun("run-1", "inventory.json", "VNI", "10100"), VNIData(100, "L2VNI"))
+	if w := Request(t, Handler, http.MethodPost, "/deploy", Body, "", nil); w.Code != http.StatusConflict {
+		t.Errorf("Deploy of an untemplated instance is %v, expected %v", w.Code, http.StatusConflict)
+	}
+	TemplatedData := VNIData(100, "L2VNI")
+	Server.Instances[InstanceID("VNI", "10100")].TemplatedData = &TemplatedData
+
+	for _, Invalid := range []string{
+		`{"Service": "VRF", "Key": "10100"}`,
+		`{"Service": "VNI", "Key": "10100", "Rollback": "everything"}`,
+		`{"Service": "VNI", "Key": "10100", "Devices": ["leaf3"]}`,
+		`{"Service": "VNI", "Key": "10100", "Unknown": true}`,
+	} {
+		if w := Request(t, Handler, http.MethodPost, "/deploy", Invalid, "", nil); w.Code == http.StatusAccepted {
+			t.Errorf("Invalid deploy request %v is accepted", Invalid)
+		}
+	}
+
+	var Queued Job
+	w := Request(t, Handler, http.MethodPost, "/deploy", Body, "", &Queued)
+	if w.Code != http.StatusAccepted || Queued.Status != JobQueued || w.Header().Get("Location") != "/jobs/"+Queued.ID {
+		t.Fatalf("Deploy is %v with job %+v at %v", w.Code, Queued, w.Header().Get("Location"))
+	}
+	if Inventory := <-Inventories; len(Inventory) != 1 || Inventory[0].Host.Hostname != "leaf2" {
+		t.Errorf("Job deploys to %+v, expected leaf2 of the collected inventory", Inventory)
+	}
+	Running := WaitForJob(t, Handler, Queued.ID, JobRunning)
+	if Running.Finished != nil || Running.Request.Inventory != "inventory.json" || Running.Request.Rollback != d.RollbackDevice {
+		t.Errorf("Unexpected running job: %+v", Running)
+	}
+	if w := Request(t, Handler, http.MethodPost, "/deploy", Body, "", nil); w.Code != http.StatusConflict {
+		t.Errorf("Second deploy of a deploying instance is %v, expected %v", w.Code, http.StatusConflict)
+	}
+
+	Release <- nil
+	Done := WaitForJob(t, Handler, Queued.ID, JobDone)
+	if Done.Finished == nil || Done.Report == nil || Done.Report.RunID != "deploy-1" || Done.Error != "" {
+		t.Errorf("Unexpected finished job: %+v", Done)
+	}
+
+	var Next Job
+	if w := Request(t, Handler, http.MethodPost, "/deploy", Body, "", &Next); w.Code != http.StatusAccepted {
+		t.Fatalf("Deploy after a finished job is %v", w.Code)
+	}
+	<-Inventories
+	Release <- errors.New("Deployment failed on leaf2")
+	if Failed := WaitForJob(t, Handler, Next.ID, JobFailed); Failed.Error != "Deployment failed on leaf2" || Failed.Finished == nil {
+		t.Errorf("Unexpected failed job: %+v", Failed)
+	}
+
+	var Jobs []Job
+	if w := Request(t, Handler, http.MethodGet, "/jobs", "", "", &Jobs); w.Code != http.StatusOK || len(Jobs) != 2 || Jobs[0].ID != Queued.ID || Jobs[1].ID != Next.ID {
+		t.Errorf("Unexpected jobs: %+v", Jobs)
+	}
+	if w := Request(t, Handler, http.MethodGet, "/jobs/unknown", "", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET of an unknown job is %v", w.Code)
+	}
+}
+
+func TestPruneJobs(t *testing.T) {
+	Server := NewTestServer(t)
+	Start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < MaxFinishedJobs+5; i++ {
+		Finished := Start.Add(time.Duration(i) * time.Minute)
+		ID := fmt.Sprintf("job-%v", i)
+		Server.Jobs[ID] = &Job{ID: ID, Status: JobDone, Created: Finished, Finished: &Finished}
+	}
+	Server.Jobs["running"] = &Job{ID: "running", Status: JobRunning, Created: Start}
+
+	Server.PruneJobs()
+	if len(Server.Jobs) != MaxFinishedJobs+1 {
+		t.Fatalf("%v jobs are kept, expected %v", len(Server.Jobs), MaxFinishedJobs+1)
+	}
+	for i := 0; i < MaxFinishedJobs+5; i++ {
+		if _, ok := Server.Jobs[fmt.Sprintf("job-%v", i)]; ok != (i >= 5) {
+			t.Errorf("Job %v is kept: %v", i, ok)
+		}
+	}
+	if _, ok := Server.Jobs["running"]; !ok {
+		t.Errorf("Running job is pruned")
+	}
+}
@@ -0,0 +1,445 @@
+package serving
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	df "n9k-modeling/diffing"
+	mt "n9k-modeling/metrics"
+	m "n9k-modeling/modeling"
+	p "n9k-modeling/polling"
+	s "n9k-modeling/storing"
+	t "n9k-modeling/templating"
+
+	cu "github.com/achelovekov/collectorutils"
+)
+
+type Server struct {
+	MetaData        *m.MetaData
+	Services        map[string]m.ServiceDefinition
+	KeysMaps        map[string]cu.KeysMap
+	CLIMaps         map[string]m.CLIMap
+	GNMIMaps        map[string]m.GNMIMap
+	InventoryDir    string
+	LogFile         string
+	Store           s.Store
+	StateRepository *s.StateRepository
+	Poller          *p.Poller
+	Token           string
+	RunJob          func(Job *Job, Instance *Instance, Inventory cu.Inventory)
+
+	Mutex     sync.Mutex
+	LogMutex  sync.Mutex
+	Instances map[string]*Instance
+	Jobs      map[string]*Job
+	JobCount  int
+}
+
+type Instance struct {
+	Run           s.RunMetaData    `json:"Run"`
+	Inventory     string           `json:"Inventory"`
+	ProcessedData m.ProcessedData  `json:"ProcessedData"`
+	TemplatedData *m.ProcessedData `json:"TemplatedData,omitempty"`
+	AddOptions    []string         `json:"AddOptions,omitempty"`
+}
+
+type CollectRequest struct {
+	Service   string   `json:"Service"`
+	Key       string   `json:"Key"`
+	Inventory string   `json:"Inventory"`
+	Devices   []string `json:"Devices"`
+}
+
+type TemplateRequest struct {
+	Service   string        `json:"Service"`
+	Key       string        `json:"Key"`
+	Variables t.VariablesDB `json:"Variables"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"Error"`
+}
+
+func NewServer(MetaData *m.MetaData, ServiceDefinitionFiles []string, InventoryDir string, LogFile string) *Server {
+	Server := &Server{
+		MetaData:     MetaData,
+		Services:     make(map[string]m.ServiceDefinition),
+		KeysMaps:     make(map[string]cu.KeysMap),
+		CLIMaps:      make(map[string]m.CLIMap),
+		GNMIMaps:     make(map[string]m.GNMIMap),
+		InventoryDir: InventoryDir,
+		LogFile:      LogFile,
+		Instances:    make(map[string]*Instance),
+		Jobs:         make(map[string]*Job),
+	}
+	for _, fileName := range ServiceDefinitionFiles {
+		ServiceDefinition := m.LoadServiceDefinition(fileName)
+		if ServiceDefinition.ServiceName == "" {
+			log.Println("Service definition without a service name is skipped:", fileName)
+			continue
+		}
+		Server.Services[ServiceDefinition.ServiceName] = ServiceDefinition
+		Server.KeysMaps[ServiceDefinition.ServiceName] = m.LoadKeysMap(ServiceDefinition.DMEProcessing)
+		Server.CLIMaps[ServiceDefinition.ServiceName] = m.LoadCLIMap(ServiceDefinition.CLIProcessing)
+		Server.GNMIMaps[ServiceDefinition.ServiceName] = m.LoadGNMIMap(ServiceDefinition.GNMIProcessing)
+		log.Println("Service loaded:", ServiceDefinition.ServiceName)
+	}
+	return Server
+}
+
+func (srv *Server) Handler() http.Handler {
+	Mux := http.NewServeMux()
+	Mux.HandleFunc("/collect", srv.HandleCollect)
+	Mux.HandleFunc("/services/", srv.HandleInstance)
+	Mux.HandleFunc("/template", srv.HandleTemplate)
+	Mux.HandleFunc("/diff", srv.HandleDiff)
+	Mux.HandleFunc("/deploy", srv.HandleDeploy)
+	Mux.HandleFunc("/jobs", srv.HandleJobs)
+	Mux.HandleFunc("/jobs/", srv.HandleJob)
+	Mux.HandleFunc("/events", srv.HandleEvents)
+	Mux.HandleFunc("/devices", srv.HandleDevices)
+	Mux.Handle("/metrics", mt.Handler())
+	return srv.Authorize(Mux)
+}
+
+// Authorize requires the server token as a bearer token on every endpoint but
+// /metrics, when a token is configured.
+func (srv *Server) Authorize(Next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if srv.Token != "" && req.URL.Path != "/metrics" {
+			Token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(Token), []byte(srv.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				WriteError(w, http.StatusUnauthorized, errors.New("A valid bearer token is required"))
+				return
+			}
+		}
+		Next.ServeHTTP(w, req)
+	})
+}
+
+func WriteJSON(w http.ResponseWriter, Code int, src interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(Code)
+	w.Write(m.MarshalToJSON(src))
+}
+
+func WriteError(w http.ResponseWriter, Code int, err error) {
+	WriteJSON(w, Code, ErrorResponse{Error: err.Error()})
+}
+
+func CheckMethod(w http.ResponseWriter, req *http.Request, Method string) bool {
+	if req.Method != Method {
+		w.Header().Set("Allow", Method)
+		WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("%v is not allowed, use %v", req.Method, Method))
+		return false
+	}
+	return true
+}
+
+func DecodeRequest(w http.ResponseWriter, req *http.Request, dst interface{}) bool {
+	Decoder := json.NewDecoder(req.Body)
+	Decoder.DisallowUnknownFields()
+	if err := Decoder.Decode(dst); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("Can't decode request: %v", err))
+		return false
+	}
+	return true
+}
+
+func InstanceID(ServiceName string, InstanceKey string) string {
+	return ServiceName + "/" + InstanceKey
+}
+
+func (srv *Server) MetaDataFor(ServiceName string) *m.MetaData {
+	MetaData := *srv.MetaData
+	MetaData.KeysMap = srv.KeysMaps[ServiceName]
+	MetaData.CLIMap = srv.CLIMaps[ServiceName]
+	MetaData.GNMIMap = srv.GNMIMaps[ServiceName]
+	MetaData.PropInclude = srv.Services[ServiceName].PropInclude
+	MetaData.NETCONFFilter = srv.Services[ServiceName].NETCONFFilter
+	return &MetaData
+}
+
+func (srv *Server) LoadInventory(fileName string, Devices []string) (cu.Inventory, error) {
+	if fileName == "" {
+		return nil, errors.New("Inventory is required")
+	}
+	Inventory := cu.LoadInventory(filepath.Join(srv.InventoryDir, filepath.Base(fileName)))
+	if len(Devices) == 0 {
+		return Inventory, nil
+	}
+
+	Selected := make(cu.Inventory, 0)
+	InventoryMap := make(map[string]cu.HostMetaData)
+	for _, v := range Inventory {
+		InventoryMap[v.Host.Hostname] = v
+	}
+	for _, DeviceName := range Devices {
+		v, ok := InventoryMap[DeviceName]
+		if !ok {
+			return nil, fmt.Errorf("Device %v is not in inventory %v", DeviceName, fileName)
+		}
+		Selected = append(Selected, v)
+	}
+	return Selected, nil
+}
+
+func (srv *Server) HandleCollect(w http.ResponseWriter, req *http.Request) {
+	if !CheckMethod(w, req, http.MethodPost) {
+		return
+	}
+	var CollectRequest CollectRequest
+	if !DecodeRequest(w, req, &CollectRequest) {
+		return
+	}
+	ServiceDefinition, ok := srv.Services[CollectRequest.Service]
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Errorf("Unknown service: %v", CollectRequest.Service))
+		return
+	}
+	if CollectRequest.Key == "" {
+		WriteError(w, http.StatusBadRequest, errors.New("Key is required"))
+		return
+	}
+	Inventory, err := srv.LoadInventory(CollectRequest.Inventory, CollectRequest.Devices)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	MetaData := srv.MetaDataFor(CollectRequest.Service)
+	RawDataDB := m.CollectRawDataDB(MetaData, Inventory, "sys")
+	ProcessedData := m.ConstructProcessedData(ServiceDefinition, RawDataDB, CollectRequest.Key, MetaData.ConversionMap)
+	Run := s.NewRun(m.NewRunID(), CollectRequest.Inventory, ServiceDefinition.ServiceName, CollectRequest.Key)
+
+	if srv.Store != nil {
+		if err := s.SaveProcessedData(srv.Store, Run, ProcessedData); err != nil {
+			log.Println("Can't store processed data:", err)
+		}
+		if err := s.SaveRawDataDB(srv.Store, Run, RawDataDB); err != nil {
+			log.Println("Can't store raw data:", err)
+		}
+	}
+	if srv.StateRepository != nil {
+		if err := srv.StateRepository.CommitProcessedData(Run, ProcessedData); err != nil {
+			log.Println("Can't commit processed data to the state repository:", err)
+		}
+	}
+
+	Instance := srv.SetInstance(Run, ProcessedData)
+
+	log.Println("Run collected:", Run.RunID, Run.ServiceName, Run.InstanceKey, len(RawDataDB), "of", len(Inventory), "devices")
+	WriteJSON(w, http.StatusOK, Instance)
+}
+
+// SetInstance keeps the templated data of the instance only as long as the
+// processed data it was templated from stays the same.
+func (srv *Server) SetInstance(Run s.RunMetaData, ProcessedData m.ProcessedData) *Instance {
+	Instance := &Instance{Run: Run, Inventory: Run.Inventory, ProcessedData: ProcessedData}
+	srv.Mutex.Lock()
+	defer srv.Mutex.Unlock()
+	if Previous, ok := srv.Instances[InstanceID(Run.ServiceName, Run.InstanceKey)]; ok && bytes.Equal(m.MarshalToJSON(Previous.ProcessedData), m.MarshalToJSON(ProcessedData)) {
+		Instance.TemplatedData = Previous.TemplatedData
+		Instance.AddOptions = Previous.AddOptions
+	}
+	srv.Instances[InstanceID(Run.ServiceName, Run.InstanceKey)] = Instance
+	return Instance
+}
+
+func (srv *Server) FindInstance(ServiceName string, InstanceKey string, RunID string) (*Instance, error) {
+	if RunID == "" {
+		srv.Mutex.Lock()
+		Instance, ok := srv.Instances[InstanceID(ServiceName, InstanceKey)]
+		srv.Mutex.Unlock()
+		if ok {
+			return Instance, nil
+		}
+	}
+	if srv.Store == nil {
+		return nil, fmt.Errorf("Instance %v of service %v is not collected", InstanceKey, ServiceName)
+	}
+
+	var Run s.RunMetaData
+	if RunID != "" {
+		var err error
+		Run, err = s.FindRun(srv.Store, RunID)
+		if err != nil {
+			return nil, err
+		}
+		if Run.ServiceName != ServiceName || Run.InstanceKey != InstanceKey {
+			return nil, fmt.Errorf("Run %v is not a run of instance %v of service %v", RunID, InstanceKey, ServiceName)
+		}
+	} else {
+		Runs, err := srv.Store.ListRuns(s.Query{ServiceName: ServiceName, InstanceKey: InstanceKey})
+		if err != nil {
+			return nil, err
+		}
+		if len(Runs) == 0 {
+			return nil, fmt.Errorf("Instance %v of service %v is not collected", InstanceKey, ServiceName)
+		}
+		Run = Runs[len(Runs)-1]
+	}
+
+	ProcessedData, err := s.LoadProcessedData(srv.Store, s.Query{RunID: Run.RunID})
+	if err != nil {
+		return nil, err
+	}
+	Instance := &Instance{Run: Run, Inventory: Run.Inventory, ProcessedData: ProcessedData, AddOptions: Run.AddOptions}
+	if TemplatedData, err := s.LoadTemplatedData(srv.Store, s.Query{RunID: Run.RunID}); err == nil && len(TemplatedData.ServiceDataDB) > 0 {
+		Instance.TemplatedData = &TemplatedData
+	}
+	return Instance, nil
+}
+
+func (srv *Server) HandleInstance(w http.ResponseWriter, req *http.Request) {
+	if !CheckMethod(w, req, http.MethodGet) {
+		return
+	}
+	Fields := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/services/"), "/"), "/")
+	if len(Fields) != 3 || Fields[1] != "instances" {
+		WriteError(w, http.StatusNotFound, errors.New("Use /services/{name}/instances/{key}"))
+		return
+	}
+	if _, ok := srv.Services[Fields[0]]; !ok {
+		WriteError(w, http.StatusNotFound, fmt.Errorf("Unknown service: %v", Fields[0]))
+		return
+	}
+	Instance, err := srv.FindInstance(Fields[0], Fields[2], req.URL.Query().Get("run"))
+	if err != nil {
+		WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, Instance)
+}
+
+func (srv *Server) HandleTemplate(w http.ResponseWriter, req *http.Request) {
+	if !CheckMethod(w, req, http.MethodPost) {
+		return
+	}
+	var TemplateRequest TemplateRequest
+	if !DecodeRequest(w, req, &TemplateRequest) {
+		return
+	}
+	TemplateComponentsMap := t.LoadTemplateComponentsMap()
+	if _, ok := TemplateComponentsMap[TemplateRequest.Service]; !ok {
+		WriteError(w, http.StatusNotFound, fmt.Errorf("No templates for service: %v", TemplateRequest.Service))
+		return
+	}
+	Instance, err := srv.FindInstance(TemplateRequest.Service, TemplateRequest.Key, "")
+	if err != nil {
+		WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if TemplateRequest.Variables.ServiceName == "" {
+		TemplateRequest.Variables.ServiceName = TemplateRequest.Service
+	}
+
+	var TemplatedData m.ProcessedData
+	TemplatedData.ServiceName = Instance.ProcessedData.ServiceName
+	TemplatedData.ServiceLayoutDB = Instance.ProcessedData.ServiceLayoutDB
+	TemplatedData.ServiceDataDB = make([]m.ServiceDataDBEntry, 0)
+	AddOptions := t.LoadAddOptions(Instance.ProcessedData, t.OptionKeys(TemplateRequest.Variables))
+	t.TemplateConstruct(Instance.ProcessedData, &TemplatedData, AddOptions, t.LoadTemplateDataMap(TemplateRequest.Variables), TemplateComponentsMap)
+	if TemplateRequest.Variables.PairWise {
+		if err := t.CheckPairWise(&TemplatedData, Instance.ProcessedData.VPCPairs); err != nil {
+			WriteError(w, http.StatusConflict, err)
+			return
+		}
+	}
+
+	if srv.Store != nil {
+		if err := s.SaveTemplatedData(srv.Store, Instance.Run, TemplatedData, TemplateRequest.Variables.AddOptions); err != nil {
+			log.Println("Can't store templated data:", err)
+		}
+	}
+	if srv.StateRepository != nil {
+		if err := srv.StateRepository.CommitTemplatedData(Instance.Run, TemplatedData); err != nil {
+			log.Println("Can't commit templated data to the state repository:", err)
+		}
+	}
+
+	srv.Mutex.Lock()
+	Templated := *Instance
+	Templated.TemplatedData = &TemplatedData
+	Templated.AddOptions = TemplateRequest.Variables.AddOptions
+	srv.Instances[InstanceID(Instance.Run.ServiceName, Instance.Run.InstanceKey)] = &Templated
+	srv.Mutex.Unlock()
+
+	WriteJSON(w, http.StatusOK, TemplatedData)
+}
+
+func (srv *Server) HandleDiff(w http.ResponseWriter, req *http.Request) {
+	if !CheckMethod(w, req, http.MethodGet) {
+		return
+	}
+	if srv.Store == nil {
+		WriteError(w, http.StatusNotImplemented, errors.New("No store is configured to diff runs from"))
+		return
+	}
+	Values := req.URL.Query()
+	RunA, RunB := Values.Get("a"), Values.Get("b")
+	if RunA == "" || RunB == "" {
+		if Values.Get("service") == "" || Values.Get("key") == "" {
+			WriteError(w, http.StatusBadRequest, errors.New("Use a and b runs, or service and key to diff the last two runs"))
+			return
+		}
+		Runs, err := srv.Store.ListRuns(s.Query{ServiceName: Values.Get("service"), InstanceKey: Values.Get("key")})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if len(Runs) < 2 {
+			WriteError(w, http.StatusNotFound, fmt.Errorf("Instance %v of service %v has %v runs, two are needed to diff", Values.Get("key"), Values.Get("service"), len(Runs)))
+			return
+		}
+		RunA, RunB = Runs[len(Runs)-2].RunID, Runs[len(Runs)-1].RunID
+	}
+
+	ServiceDiff, err := df.DiffRuns(srv.Store, RunA, RunB, Values.Get("device"))
+	if err != nil {
+		WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, ServiceDiff)
+}
+
+func (srv *Server) HandleEvents(w http.ResponseWriter, req *http.Request) {
+	if !CheckMethod(w, req, http.MethodGet) {
+		return
+	}
+	if srv.Poller == nil {
+		WriteError(w, http.StatusNotImplemented, errors.New("Polling is not enabled"))
+		return
+	}
+	var Since time.Time
+	if v := req.URL.Query().Get("since"); v != "" {
+		var err error
+		Since, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, fmt.Errorf("Can't parse since, use RFC3339: %v", err))
+			return
+		}
+	}
+	WriteJSON(w, http.StatusOK, srv.Poller.EventsSince(Since))
+}
+
+func (srv *Server) HandleDevices(w http.ResponseWriter, req *http.Request) {
+	if !CheckMethod(w, req, http.MethodGet) {
+		return
+	}
+	if srv.Poller == nil {
+		WriteError(w, http.StatusNotImplemented, errors.New("Polling is not enabled"))
+		return
+	}
+	WriteJSON(w, http.StatusOK, srv.Poller.DeviceStates())
+}
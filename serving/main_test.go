@@ -0,0 +1,169 @@
+package serving
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	m "n9k-modeling/modeling"
+	s "n9k-modeling/storing"
+)
+
+// NewTestServer serves the VNI service from an inventory with leaf1 and leaf2.
+func NewTestServer(t *testing.T) *Server {
+	InventoryDir := t.TempDir()
+	Inventory := `[{"host": {"url": "https://192.0.2.1", "hostname": "leaf1", "username": "admin", "password": "secret"}},
+{"host": {"url": "https://192.0.2.2", "hostname": "leaf2", "username": "admin", "password": "secret"}}]`
+	if err := ioutil.WriteFile(filepath.Join(InventoryDir, "inventory.json"), []byte(Inventory), 0644); err != nil {
+		t.Fatalf("Can't write the inventory: %v", err)
+	}
+	return &Server{
+		MetaData:     &m.MetaData{},
+		Services:     map[string]m.ServiceDefinition{"VNI": {ServiceName: "VNI"}},
+		InventoryDir: InventoryDir,
+		LogFile:      filepath.Join(t.TempDir(), "deployments.json"),
+		Instances:    make(map[string]*Instance),
+		Jobs:         make(map[string]*Job),
+	}
+}
+
+func VNIData(VLAN float64, Components ...string) m.ProcessedData {
+	ProcessedData := m.ProcessedData{ServiceName: "VNI"}
+	for _, DeviceName := range []string{"leaf1", "leaf2"} {
+		ProcessedData.ServiceDataDB = append(ProcessedData.ServiceDataDB, m.ServiceDataDBEntry{DeviceName: DeviceName, DeviceData: m.DeviceData{"vnid": float64(10100), "l2BD.id": VLAN}})
+		ServiceLayout := make(m.ServiceLayout, 0)
+		for _, Component := range Components {
+			ServiceLayout = append(ServiceLayout, m.ComponentBitMap{Name: Component, Value: true})
+		}
+		ProcessedData.ServiceLayoutDB = append(ProcessedData.ServiceLayoutDB, m.ServiceLayoutDBEntry{DeviceName: DeviceName, ServiceLayout: ServiceLayout})
+	}
+	return ProcessedData
+}
+
+func Request(t *testing.T, Handler http.Handler, Method string, Path string, Body string, Token string, dst interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(Method, Path, strings.NewReader(Body))
+	if Token != "" {
+		req.Header.Set("Authorization", "Bearer "+Token)
+	}
+	w := httptest.NewRecorder()
+	Handler.ServeHTTP(w, req)
+	if dst != nil && w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), dst); err != nil {
+			t.Fatalf("Can't decode the response of %v %v: %v", Method, Path, err)
+		}
+	}
+	return w
+}
+
+func TestAuthorize(t *testing.T) {
+	Server := NewTestServer(t)
+	Server.Token = "secret"
+	Handler := Server.Handler()
+
+	for _, Test := range []struct {
+		Path  string
+		Token string
+		Code  int
+	}{
+		{"/jobs", "", http.StatusUnauthorized},
+		{"/jobs", "wrong", http.StatusUnauthorized},
+		{"/services/VNI/instances/10100", "secret-and-more", http.StatusUnauthorized},
+		{"/jobs", "secret", http.StatusOK},
+		{"/metrics", "", http.StatusOK},
+	} {
+		w := Request(t, Handler, http.MethodGet, Test.Path, "", Test.Token, nil)
+		if w.Code != Test.Code {
+			t.Errorf("GET %v with token %q is %v, expected %v", Test.Path, Test.Token, w.Code, Test.Code)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("GET %v with token %q doesn't ask for a bearer token", Test.Path, Test.Token)
+		}
+	}
+
+	Server.Token = ""
+	if w := Request(t, Handler, http.MethodGet, "/jobs", "", "", nil); w.Code != http.StatusOK {
+		t.Errorf("GET /jobs without a configured token is %v", w.Code)
+	}
+}
+
+func TestInstanceLookup(t *testing.T) {
+	Server := NewTestServer(t)
+	Store, err := s.OpenBoltStore(s.StoreConfig{Type: "bolt", Path: filepath.Join(t.TempDir(), "runs.db")})
+	if err != nil {
+		t.Fatalf("Can't open the store: %v", err)
+	}
+	defer Store.Close()
+	Server.Store = Store
+
+	Start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, Run := range []s.RunMetaData{
+		s.NewRun("run-1", "inventory.json", "VNI", "10100"),
+		s.NewRun("run-2", "inventory.json", "VNI", "10100"),
+		s.NewRun("run-3", "inventory.json", "VNI", "10200"),
+	} {
+		Run.Timestamp = Start.Add(time.Duration(i) * time.Hour)
+		if err := s.SaveProcessedData(Store, Run, VNIData(float64(100+i), "L2VNI")); err != nil {
+			t.Fatalf("Can't save %v: %v", Run.RunID, err)
+		}
+	}
+	Handler := Server.Handler()
+
+	for _, Test := range []struct {
+		Path  string
+		Code  int
+		RunID string
+	}{
+		{"/services/VNI/instances/10100", http.StatusOK, "run-2"},
+		{"/services/VNI/instances/10100?run=run-1", http.StatusOK, "run-1"},
+		{"/services/VNI/instances/10100?run=run-3", http.StatusNotFound, ""},
+		{"/services/VNI/instances/10300", http.StatusNotFound, ""},
+		{"/services/VRF/instances/10100", http.StatusNotFound, ""},
+		{"/services/VNI/10100", http.StatusNotFound, ""},
+	} {
+		var Instance Instance
+		w := Request(t, Handler, http.MethodGet, Test.Path, "", "", &Instance)
+		if w.Code != Test.Code || Instance.Run.RunID != Test.RunID {
+			t.Errorf("GET %v is %v with run %q, expected %v with run %q", Test.Path, w.Code, Instance.Run.RunID, Test.Code, Test.RunID)
+		}
+		if Test.RunID == "run-1" && (len(Instance.ProcessedData.ServiceDataDB) != 2 || Instance.ProcessedData.ServiceDataDB[0].DeviceData["l2BD.id"] != float64(100)) {
+			t.Errorf("Unexpected processed data of run-1: %+v", Instance.ProcessedData)
+		}
+	}
+
+	// A collected instance is served from memory ahead of the store.
+	Server.SetInstance(s.NewRun("run-4", "inventory.json", "VNI", "10100"), VNIData(104, "L2VNI"))
+	var Instance Instance
+	if w := Request(t, Handler, http.MethodGet, "/services/VNI/instances/10100", "", "", &Instance); w.Code != http.StatusOK || Instance.Run.RunID != "run-4" {
+		t.Errorf("GET of a collected instance is %v with run %v, expected run-4", w.Code, Instance.Run.RunID)
+	}
+	if w := Request(t, Handler, http.MethodPost, "/services/VNI/instances/10100", "", "", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST of an instance is %v", w.Code)
+	}
+}
+
+func TestSetInstanceClearsTemplatedData(t *testing.T) {
+	Server := NewTestServer(t)
+	TemplatedData := VNIData(100, "L2VNI", "AGW")
+
+	Server.SetInstance(s.NewRun("run-1", "inventory.json", "VNI", "10100"), VNIData(100, "L2VNI"))
+	Server.Instances[InstanceID("VNI", "10100")].TemplatedData = &TemplatedData
+	Server.Instances[InstanceID("VNI", "10100")].AddOptions = []string{"AGW"}
+
+	Instance := Server.SetInstance(s.NewRun("run-2", "inventory.json", "VNI", "10100"), VNIData(100, "L2VNI"))
+	if Instance.TemplatedData != &TemplatedData || len(Instance.AddOptions) != 1 {
+		t.Errorf("Templated data is dropped although the processed data is the same")
+	}
+
+	Instance = Server.SetInstance(s.NewRun("run-3", "inventory.json", "VNI", "10100"), VNIData(200, "L2VNI"))
+	if Instance.TemplatedData != nil || Instance.AddOptions != nil {
+		t.Errorf("Templated data of the old processed data is kept: %+v", Instance)
+	}
+	if Server.Instances[InstanceID("VNI", "10100")] != Instance {
+		t.Errorf("Instance is not replaced")
+	}
+}
@@ -0,0 +1,218 @@
+package storing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStore opens the database file for every operation only. Bolt locks the
+// file for as long as it is open, so keeping it open in serve or poll would
+// lock out every other command on the same host.
+type BoltStore struct {
+	Path     string
+	ReadOnly bool
+}
+
+func OpenBoltStore(StoreConfig StoreConfig) (*BoltStore, error) {
+	BoltStore := &BoltStore{Path: StoreConfig.Path, ReadOnly: StoreConfig.ReadOnly}
+	if BoltStore.ReadOnly {
+		if _, err := os.Stat(BoltStore.Path); err != nil {
+			return nil, err
+		}
+		return BoltStore, nil
+	}
+
+	err := BoltStore.Update(func(tx *bolt.Tx) error {
+		for _, Collection := range []string{RawDataCollection, ServiceDataCollection, ServiceLayoutCollection, TemplatedDataCollection, OperDataCollection, RunsCollection} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(Collection)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return BoltStore, nil
+}
+
+func (s *BoltStore) Update(Fn func(*bolt.Tx) error) error {
+	if s.ReadOnly {
+		return errors.New("Store is opened read-only")
+	}
+	DB, err := bolt.Open(s.Path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return err
+	}
+	defer DB.Close()
+	return DB.Update(Fn)
+}
+
+func (s *BoltStore) View(Fn func(*bolt.Tx) error) error {
+	DB, err := bolt.Open(s.Path, 0600, &bolt.Options{Timeout: 10 * time.Second, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer DB.Close()
+	return DB.View(Fn)
+}
+
+func MatchQuery(Query Query, RunID string, Timestamp time.Time, ServiceName string, InstanceKey string, DeviceName string) bool {
+	if Query.RunID != "" && Query.RunID != RunID {
+		return false
+	}
+	if Query.ServiceName != "" && Query.ServiceName != ServiceName {
+		return false
+	}
+	if Query.InstanceKey != "" && Query.InstanceKey != InstanceKey {
+		return false
+	}
+	if Query.DeviceName != "" && Query.DeviceName != DeviceName {
+		return false
+	}
+	if !Query.From.IsZero() && Timestamp.Before(Query.From) {
+		return false
+	}
+	if !Query.To.IsZero() && Timestamp.After(Query.To) {
+		return false
+	}
+	return true
+}
+
+func (s *BoltStore) SaveRun(Run RunMetaData) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		Data, err := json.Marshal(Run)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(RunsCollection)).Put([]byte(Run.RunID), Data)
+	})
+}
+
+func (s *BoltStore) SaveRecords(Collection string, Records []Record) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		Bucket := tx.Bucket([]byte(Collection))
+		if Bucket == nil {
+			return fmt.Errorf("Unknown collection: %v", Collection)
+		}
+		return PutRecords(Bucket, Records)
+	})
+}
+
+func (s *BoltStore) ReplaceRecords(Collection string, RunID string, Records []Record) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		Bucket := tx.Bucket([]byte(Collection))
+		if Bucket == nil {
+			return fmt.Errorf("Unknown collection: %v", Collection)
+		}
+		Prefix := []byte(RunID + "/")
+		Keys := make([][]byte, 0)
+		Cursor := Bucket.Cursor()
+		for k, _ := Cursor.Seek(Prefix); k != nil && bytes.HasPrefix(k, Prefix); k, _ = Cursor.Next() {
+			Keys = append(Keys, append([]byte{}, k...))
+		}
+		for _, Key := range Keys {
+			if err := Bucket.Delete(Key); err != nil {
+				return err
+			}
+		}
+		return PutRecords(Bucket, Records)
+	})
+}
+
+func PutRecords(Bucket *bolt.Bucket, Records []Record) error {
+	for _, Record := range Records {
+		Sequence, err := Bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		Data, err := json.Marshal(Record)
+		if err != nil {
+			return err
+		}
+		Key := fmt.Sprintf("%v/%v/%020d", Record.RunID, Record.DeviceName, Sequence)
+		if err := Bucket.Put([]byte(Key), Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BoltStore) FindRecords(Collection string, Query Query) ([]Record, error) {
+	Records := make([]Record, 0)
+	err := s.View(func(tx *bolt.Tx) error {
+		Bucket := tx.Bucket([]byte(Collection))
+		if Bucket == nil {
+			return fmt.Errorf("Unknown collection: %v", Collection)
+		}
+		Prefix := []byte{}
+		if Query.RunID != "" {
+			Prefix = []byte(Query.RunID + "/")
+		}
+		Cursor := Bucket.Cursor()
+		for k, v := Cursor.Seek(Prefix); k != nil && bytes.HasPrefix(k, Prefix); k, v = Cursor.Next() {
+			var Record Record
+			if err := json.Unmarshal(v, &Record); err != nil {
+				return err
+			}
+			if MatchQuery(Query, Record.RunID, Record.Timestamp, Record.ServiceName, Record.InstanceKey, Record.DeviceName) {
+				Records = append(Records, Record)
+			}
+		}
+		return nil
+	})
+
+	sort.SliceStable(Records, func(i, j int) bool {
+		if !Records[i].Timestamp.Equal(Records[j].Timestamp) {
+			return Records[i].Timestamp.Before(Records[j].Timestamp)
+		}
+		return Records[i].DeviceName < Records[j].DeviceName
+	})
+	return Records, err
+}
+
+func (s *BoltStore) ListRuns(Query Query) ([]RunMetaData, error) {
+	Runs := make([]RunMetaData, 0)
+
+	RunIDs := make(map[string]bool)
+	if Query.DeviceName != "" {
+		Records, err := s.FindRecords(ServiceDataCollection, Query)
+		if err != nil {
+			return Runs, err
+		}
+		for _, Record := range Records {
+			RunIDs[Record.RunID] = true
+		}
+	}
+
+	err := s.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(RunsCollection)).ForEach(func(k, v []byte) error {
+			var Run RunMetaData
+			if err := json.Unmarshal(v, &Run); err != nil {
+				return err
+			}
+			if Query.DeviceName != "" && !RunIDs[Run.RunID] {
+				return nil
+			}
+			if MatchQuery(Query, Run.RunID, Run.Timestamp, Run.ServiceName, Run.InstanceKey, Query.DeviceName) {
+				Runs = append(Runs, Run)
+			}
+			return nil
+		})
+	})
+
+	sort.SliceStable(Runs, func(i, j int) bool { return Runs[i].Timestamp.Before(Runs[j].Timestamp) })
+	return Runs, err
+}
+
+func (s *BoltStore) Close() error {
+	return nil
+}
@@ -0,0 +1,168 @@
+package storing
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	m "n9k-modeling/modeling"
+)
+
+func OpenTestStore(t *testing.T) *BoltStore {
+	Store, err := OpenBoltStore(StoreConfig{Type: "bolt", Path: filepath.Join(t.TempDir(), "runs.db")})
+	if err != nil {
+		t.Fatalf("Can't open the store: %v", err)
+	}
+	return Store
+}
+
+func TestBoltStoreRoundTrip(t *testing.T) {
+	Store := OpenTestStore(t)
+	defer Store.Close()
+
+	Run := NewRun("run-1", "inventory.json", "VNI", "10100")
+	ProcessedData := m.ProcessedData{
+		ServiceName: "VNI",
+		ServiceDataDB: m.ServiceDataDB{
+			{DeviceName: "leaf1", DeviceData: m.DeviceData{"l2BD.id": "100"}},
+			{DeviceName: "leaf2", DeviceData: m.DeviceData{"l2BD.id": "100"}},
+		},
+		ServiceLayoutDB: m.ServiceLayoutDB{
+			{DeviceName: "leaf1", ServiceLayout: m.ServiceLayout{{Name: "L2VNI", Value: true}}},
+			{DeviceName: "leaf2", ServiceLayout: m.ServiceLayout{{Name: "L2VNI", Value: true}}},
+		},
+	}
+	if err := SaveProcessedData(Store, Run, ProcessedData); err != nil {
+		t.Fatalf("Can't save processed data: %v", err)
+	}
+
+	Loaded, err := LoadProcessedData(Store, Query{RunID: "run-1"})
+	if err != nil {
+		t.Fatalf("Can't load processed data: %v", err)
+	}
+	if Loaded.ServiceName != "VNI" || len(Loaded.ServiceDataDB) != 2 || len(Loaded.ServiceLayoutDB) != 2 {
+		t.Fatalf("Unexpected processed data: %+v", Loaded)
+	}
+	if Loaded.ServiceDataDB[0].DeviceName != "leaf1" || Loaded.ServiceDataDB[0].DeviceData["l2BD.id"] != "100" {
+		t.Errorf("Unexpected device data: %+v", Loaded.ServiceDataDB[0])
+	}
+
+	Runs, err := Store.ListRuns(Query{DeviceName: "leaf2"})
+	if err != nil || len(Runs) != 1 || Runs[0].RunID != "run-1" {
+		t.Errorf("Unexpected runs for leaf2: %+v %v", Runs, err)
+	}
+	if _, err := FindRun(Store, "run-2"); err == nil {
+		t.Errorf("Unknown run is found")
+	}
+}
+
+func TestSaveTemplatedDataReplacesRun(t *testing.T) {
+	Store := OpenTestStore(t)
+	defer Store.Close()
+
+	Run := NewRun("run-1", "inventory.json", "VNI", "10100")
+	if err := Store.SaveRun(Run); err != nil {
+		t.Fatalf("Can't save run: %v", err)
+	}
+	TemplatedData := m.ProcessedData{
+		ServiceName: "VNI",
+		ServiceDataDB: m.ServiceDataDB{
+			{DeviceName: "leaf1", DeviceData: m.DeviceData{"l2BD.name": "old"}},
+			{DeviceName: "leaf2", DeviceData: m.DeviceData{"l2BD.name": "old"}},
+		},
+	}
+	if err := SaveTemplatedData(Store, Run, TemplatedData, []string{"bgpInst.asn"}); err != nil {
+		t.Fatalf("Can't save templated data: %v", err)
+	}
+	TemplatedData.ServiceDataDB = m.ServiceDataDB{{DeviceName: "leaf1", DeviceData: m.DeviceData{"l2BD.name": "new"}}}
+	if err := SaveTemplatedData(Store, Run, TemplatedData, []string{"bgpInst.asn"}); err != nil {
+		t.Fatalf("Can't save templated data again: %v", err)
+	}
+
+	Loaded, err := LoadTemplatedData(Store, Query{RunID: "run-1"})
+	if err != nil {
+		t.Fatalf("Can't load templated data: %v", err)
+	}
+	if len(Loaded.ServiceDataDB) != 1 || Loaded.ServiceDataDB[0].DeviceData["l2BD.name"] != "new" {
+		t.Errorf("Templated data is not replaced: %+v", Loaded.ServiceDataDB)
+	}
+	if Run, err := FindRun(Store, "run-1"); err != nil || len(Run.AddOptions) != 1 || Run.AddOptions[0] != "bgpInst.asn" {
+		t.Errorf("AddOptions are not kept with the run: %+v %v", Run, err)
+	}
+}
+
+func TestProcessedDataStateRoundTrip(t *testing.T) {
+	Store := OpenTestStore(t)
+	defer Store.Close()
+
+	Run := NewRun("run-1", "inventory.json", "VNI", "10100")
+	VPCPairs := []m.VPCPair{{DomainID: "10", Devices: []string{"leaf1", "leaf2"}, Keepalive: []string{"10.1.1.1", "10.1.1.2"}}}
+	ProcessedData := m.ProcessedData{
+		ServiceName: "VNI",
+		ServiceDataDB: m.ServiceDataDB{
+			{DeviceName: "leaf1", DeviceData: m.DeviceData{"l2BD.id": "100"}, OperData: m.DeviceData{"TABLE_nve_vni.vni-state": "Up"}},
+			{DeviceName: "leaf2", DeviceData: m.DeviceData{"l2BD.id": "100"}, OperData: m.DeviceData{"TABLE_nve_vni.vni-state": "Down"}},
+			{DeviceName: "leaf3", DeviceData: m.DeviceData{"l2BD.id": "100"}, Offline: true},
+		},
+		ServiceLayoutDB: m.ServiceLayoutDB{
+			{DeviceName: "leaf1", ServiceLayout: m.ServiceLayout{{Name: "L2VNI", Value: true, Oper: "up"}}},
+			{DeviceName: "leaf2", ServiceLayout: m.ServiceLayout{{Name: "L2VNI", Value: true, Oper: "down"}}},
+			{DeviceName: "leaf3", ServiceLayout: m.ServiceLayout{{Name: "L2VNI", Value: true}}},
+		},
+		VPCPairs: VPCPairs,
+	}
+	if err := SaveProcessedData(Store, Run, ProcessedData); err != nil {
+		t.Fatalf("Can't save processed data: %v", err)
+	}
+
+	Loaded, err := LoadProcessedData(Store, Query{RunID: "run-1"})
+	if err != nil {
+		t.Fatalf("Can't load processed data: %v", err)
+	}
+	if !reflect.DeepEqual(Loaded, ProcessedData) {
+		t.Errorf("Processed data is loaded as %+v, expected %+v", Loaded, ProcessedData)
+	}
+	Loaded, err = LoadProcessedData(Store, Query{RunID: "run-1", DeviceName: "leaf2"})
+	if err != nil || len(Loaded.ServiceDataDB) != 1 || Loaded.ServiceDataDB[0].OperData["TABLE_nve_vni.vni-state"] != "Down" || !reflect.DeepEqual(Loaded.VPCPairs, VPCPairs) {
+		t.Errorf("Unexpected processed data of leaf2: %+v %v", Loaded, err)
+	}
+
+	// The run passed in is the caller's copy without the vPC pairs, templating
+	// keeps the stored ones.
+	TemplatedData := m.ProcessedData{ServiceName: "VNI", ServiceDataDB: m.ServiceDataDB{{DeviceName: "leaf1", DeviceData: m.DeviceData{"l2BD.id": "100"}}}}
+	if err := SaveTemplatedData(Store, Run, TemplatedData, nil); err != nil {
+		t.Fatalf("Can't save templated data: %v", err)
+	}
+	Loaded, err = LoadTemplatedData(Store, Query{RunID: "run-1"})
+	if err != nil || !reflect.DeepEqual(Loaded.VPCPairs, VPCPairs) || Loaded.ServiceDataDB[0].OperData != nil {
+		t.Errorf("Unexpected templated data: %+v %v", Loaded, err)
+	}
+	if Run, err := FindRun(Store, "run-1"); err != nil || !reflect.DeepEqual(Run.VPCPairs, VPCPairs) {
+		t.Errorf("vPC pairs are not kept with the run: %+v %v", Run, err)
+	}
+}
+
+func TestBoltStoreSharedBetweenProcesses(t *testing.T) {
+	Path := filepath.Join(t.TempDir(), "runs.db")
+	Writer, err := OpenBoltStore(StoreConfig{Type: "bolt", Path: Path})
+	if err != nil {
+		t.Fatalf("Can't open the store: %v", err)
+	}
+	defer Writer.Close()
+
+	Reader, err := OpenBoltStore(StoreConfig{Type: "bolt", Path: Path, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Can't open the store read-only while it is open for writing: %v", err)
+	}
+	defer Reader.Close()
+
+	if err := Writer.SaveRun(NewRun("run-1", "", "VNI", "10100")); err != nil {
+		t.Fatalf("Can't save run: %v", err)
+	}
+	if _, err := FindRun(Reader, "run-1"); err != nil {
+		t.Errorf("Reader doesn't see the run: %v", err)
+	}
+	if err := Reader.SaveRun(NewRun("run-2", "", "VNI", "10100")); err == nil {
+		t.Errorf("Read-only store accepts writes")
+	}
+}
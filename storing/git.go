@@ -0,0 +1,188 @@
+package storing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	m "n9k-modeling/modeling"
+)
+
+const (
+	ProcessedStateDir = "processed"
+	TemplatedStateDir = "templated"
+)
+
+type StateRepositoryConfig struct {
+	Path        string `json:"Path"`
+	AuthorName  string `json:"AuthorName"`
+	AuthorEmail string `json:"AuthorEmail"`
+}
+
+// StateRepository is shared by the poller and the HTTP handlers of one
+// process, so Mutex serializes writing, staging and committing.
+type StateRepository struct {
+	Config StateRepositoryConfig
+	Mutex  sync.Mutex
+}
+
+type DeviceState struct {
+	DeviceName    string          `json:"DeviceName"`
+	DeviceData    m.DeviceData    `json:"DeviceData"`
+	ServiceLayout m.ServiceLayout `json:"ServiceLayout"`
+}
+
+func LoadStateRepositoryConfig(fileName string) StateRepositoryConfig {
+	var Config struct {
+		StateRepository StateRepositoryConfig `json:"StateRepository"`
+	}
+	ConfigFile, err := os.Open(fileName)
+	if err != nil {
+		log.Println(err)
+	}
+	defer ConfigFile.Close()
+
+	ConfigFileBytes, _ := ioutil.ReadAll(ConfigFile)
+
+	err = json.Unmarshal(ConfigFileBytes, &Config)
+	if err != nil {
+		log.Println(err)
+	}
+
+	if Config.StateRepository.AuthorName == "" {
+		Config.StateRepository.AuthorName = "n9k-modeling"
+	}
+	if Config.StateRepository.AuthorEmail == "" {
+		Config.StateRepository.AuthorEmail = "n9k-modeling@localhost"
+	}
+
+	return Config.StateRepository
+}
+
+func OpenStateRepository(Config StateRepositoryConfig) (*StateRepository, error) {
+	if Config.Path == "" {
+		return nil, nil
+	}
+	StateRepository := &StateRepository{Config: Config}
+
+	if _, err := os.Stat(filepath.Join(Config.Path, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(Config.Path, 0755); err != nil {
+			return nil, err
+		}
+		if _, err := StateRepository.Git("init"); err != nil {
+			return nil, err
+		}
+	}
+
+	return StateRepository, nil
+}
+
+func OpenConfiguredStateRepository(configFile string) *StateRepository {
+	StateRepository, err := OpenStateRepository(LoadStateRepositoryConfig(configFile))
+	if err != nil {
+		log.Fatalf("Can't open the state repository: %v", err)
+	}
+	return StateRepository
+}
+
+func (g *StateRepository) Git(Args ...string) (string, error) {
+	Args = append([]string{"-C", g.Config.Path, "-c", "user.name=" + g.Config.AuthorName, "-c", "user.email=" + g.Config.AuthorEmail}, Args...)
+	Command := exec.Command("git", Args...)
+	var Output bytes.Buffer
+	Command.Stdout = &Output
+	Command.Stderr = &Output
+	err := Command.Run()
+	if err != nil {
+		return Output.String(), fmt.Errorf("git %v: %v: %v", strings.Join(Args[6:], " "), err, strings.TrimSpace(Output.String()))
+	}
+	return Output.String(), nil
+}
+
+func CheckPathElement(Name string) error {
+	if Name == "" || Name == "." || Name == ".." || strings.ContainsAny(Name, "/\\") {
+		return fmt.Errorf("%q can't be used as a file name in the state repository", Name)
+	}
+	return nil
+}
+
+func InstanceDir(ServiceName string, InstanceKey string) string {
+	if InstanceKey == "" {
+		InstanceKey = "default"
+	}
+	return filepath.Join(ServiceName, InstanceKey)
+}
+
+func (g *StateRepository) WriteDeviceStates(Dir string, ProcessedData m.ProcessedData) error {
+	for _, v := range ProcessedData.ServiceDataDB {
+		if err := CheckPathElement(v.DeviceName); err != nil {
+			return err
+		}
+	}
+
+	AbsDir := filepath.Join(g.Config.Path, Dir)
+	if err := os.RemoveAll(AbsDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(AbsDir, 0755); err != nil {
+		return err
+	}
+
+	ServiceLayouts := make(map[string]m.ServiceLayout)
+	for _, v := range ProcessedData.ServiceLayoutDB {
+		ServiceLayouts[v.DeviceName] = v.ServiceLayout
+	}
+
+	for _, v := range ProcessedData.ServiceDataDB {
+		DeviceState := DeviceState{DeviceName: v.DeviceName, DeviceData: v.DeviceData, ServiceLayout: ServiceLayouts[v.DeviceName]}
+		if err := ioutil.WriteFile(filepath.Join(AbsDir, v.DeviceName+".json"), append(m.MarshalToJSON(DeviceState), '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func CommitMessage(Kind string, Run RunMetaData, Devices int) string {
+	return fmt.Sprintf("%v %v %v run %v\n\nRunID: %v\nTimestamp: %v\nInventory: %v\nService: %v\nInstance: %v\nDevices: %v\n",
+		Run.ServiceName, Run.InstanceKey, Kind, Run.RunID,
+		Run.RunID, Run.Timestamp.Format(time.RFC3339), Run.Inventory, Run.ServiceName, Run.InstanceKey, Devices)
+}
+
+func (g *StateRepository) Commit(Kind string, Run RunMetaData, ProcessedData m.ProcessedData) error {
+	for _, Name := range []string{Run.ServiceName, Run.InstanceKey} {
+		if err := CheckPathElement(Name); Name != "" && err != nil {
+			return err
+		}
+	}
+	Dir := filepath.Join(InstanceDir(Run.ServiceName, Run.InstanceKey), Kind)
+
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+	if err := g.WriteDeviceStates(Dir, ProcessedData); err != nil {
+		return err
+	}
+	if _, err := g.Git("add", "-A", "--", Dir); err != nil {
+		return err
+	}
+	if _, err := g.Git("diff", "--cached", "--quiet", "--", Dir); err == nil {
+		log.Println("State repository is up to date for run:", Run.RunID)
+		return nil
+	}
+	_, err := g.Git("commit", "-q", "-m", CommitMessage(Kind, Run, len(ProcessedData.ServiceDataDB)), "--", Dir)
+	return err
+}
+
+func (g *StateRepository) CommitProcessedData(Run RunMetaData, ProcessedData m.ProcessedData) error {
+	return g.Commit(ProcessedStateDir, Run, ProcessedData)
+}
+
+func (g *StateRepository) CommitTemplatedData(Run RunMetaData, TemplatedData m.ProcessedData) error {
+	return g.Commit(TemplatedStateDir, Run, TemplatedData)
+}
@@ -0,0 +1,70 @@
+package storing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	m "n9k-modeling/modeling"
+)
+
+func TestStateRepositoryConcurrentCommits(t *testing.T) {
+	StateRepository, err := OpenStateRepository(StateRepositoryConfig{Path: t.TempDir(), AuthorName: "test", AuthorEmail: "test@localhost"})
+	if err != nil {
+		t.Fatalf("Can't open the state repository: %v", err)
+	}
+
+	// A file staged by someone else stays out of the commits of the instances.
+	if err := ioutil.WriteFile(filepath.Join(StateRepository.Config.Path, "staged.txt"), []byte("staged\n"), 0644); err != nil {
+		t.Fatalf("Can't write a file: %v", err)
+	}
+	if _, err := StateRepository.Git("add", "staged.txt"); err != nil {
+		t.Fatalf("Can't stage a file: %v", err)
+	}
+
+	var WaitGroup sync.WaitGroup
+	Errors := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		WaitGroup.Add(1)
+		go func(i int) {
+			defer WaitGroup.Done()
+			InstanceKey := fmt.Sprint(10100 + i)
+			ProcessedData := m.ProcessedData{
+				ServiceName:     "VNI",
+				ServiceDataDB:   m.ServiceDataDB{{DeviceName: "leaf1", DeviceData: m.DeviceData{"vnid": InstanceKey}}},
+				ServiceLayoutDB: m.ServiceLayoutDB{{DeviceName: "leaf1", ServiceLayout: m.ServiceLayout{{Name: "L2VNI", Value: true}}}},
+			}
+			Errors <- StateRepository.CommitProcessedData(NewRun("run-"+InstanceKey, "inventory.json", "VNI", InstanceKey), ProcessedData)
+		}(i)
+	}
+	WaitGroup.Wait()
+	close(Errors)
+	for err := range Errors {
+		if err != nil {
+			t.Errorf("Can't commit processed data: %v", err)
+		}
+	}
+
+	Log, err := StateRepository.Git("log", "--format=%x00%s", "--name-only")
+	if err != nil {
+		t.Fatalf("Can't read the log: %v", err)
+	}
+	Commits := strings.Split(strings.Trim(Log, "\x00\n"), "\x00")
+	if len(Commits) != 8 {
+		t.Fatalf("Got %v commits, expected 8:\n%v", len(Commits), Log)
+	}
+	for _, Commit := range Commits {
+		Lines := strings.Fields(Commit)
+		InstanceKey := Lines[1]
+		Expected := filepath.Join("VNI", InstanceKey, ProcessedStateDir, "leaf1.json")
+		if len(Lines) != 6 || Lines[5] != Expected {
+			t.Errorf("Commit %q has files %q, expected %v", Commit, Lines[5:], Expected)
+		}
+	}
+	if Status, _ := StateRepository.Git("status", "--porcelain"); strings.TrimSpace(Status) != "A  staged.txt" {
+		t.Errorf("Unexpected status after the commits: %q", Status)
+	}
+}
@@ -0,0 +1,326 @@
+package storing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	m "n9k-modeling/modeling"
+)
+
+const (
+	RawDataCollection       = "RawData"
+	ServiceDataCollection   = "ServiceData"
+	ServiceLayoutCollection = "ServiceLayout"
+	TemplatedDataCollection = "TemplatedData"
+	OperDataCollection      = "OperData"
+	RunsCollection          = "Runs"
+)
+
+type StoreConfig struct {
+	Type     string `json:"Type"`
+	URI      string `json:"URI"`
+	Database string `json:"Database"`
+	Path     string `json:"Path"`
+	ReadOnly bool   `json:"-"`
+}
+
+type RunMetaData struct {
+	RunID       string      `json:"RunID" bson:"RunID"`
+	Timestamp   time.Time   `json:"Timestamp" bson:"Timestamp"`
+	Inventory   string      `json:"Inventory" bson:"Inventory"`
+	ServiceName string      `json:"ServiceName" bson:"ServiceName"`
+	InstanceKey string      `json:"InstanceKey" bson:"InstanceKey"`
+	AddOptions  []string    `json:"AddOptions,omitempty" bson:"AddOptions,omitempty"`
+	VPCPairs    []m.VPCPair `json:"VPCPairs,omitempty" bson:"VPCPairs,omitempty"`
+}
+
+// OperState is what a device reports next to its service data. It is kept in
+// a collection of its own, so the service data records hold the device data
+// alone and stay queryable by its keys.
+type OperState struct {
+	OperData m.DeviceData `json:"OperData,omitempty"`
+	Offline  bool         `json:"Offline,omitempty"`
+}
+
+type Record struct {
+	RunID       string    `json:"RunID" bson:"RunID"`
+	Timestamp   time.Time `json:"Timestamp" bson:"Timestamp"`
+	Inventory   string    `json:"Inventory" bson:"Inventory"`
+	ServiceName string    `json:"ServiceName" bson:"ServiceName"`
+	InstanceKey string    `json:"InstanceKey" bson:"InstanceKey"`
+	DeviceName  string    `json:"DeviceName" bson:"DeviceName"`
+	Data        string    `json:"Data" bson:"-"`
+}
+
+type Query struct {
+	RunID       string
+	ServiceName string
+	InstanceKey string
+	DeviceName  string
+	From        time.Time
+	To          time.Time
+}
+
+type Store interface {
+	SaveRun(Run RunMetaData) error
+	SaveRecords(Collection string, Records []Record) error
+	ReplaceRecords(Collection string, RunID string, Records []Record) error
+	FindRecords(Collection string, Query Query) ([]Record, error)
+	ListRuns(Query Query) ([]RunMetaData, error)
+	Close() error
+}
+
+func LoadStoreConfig(fileName string) StoreConfig {
+	var Config struct {
+		Store StoreConfig `json:"Store"`
+	}
+	ConfigFile, err := os.Open(fileName)
+	if err != nil {
+		log.Println(err)
+	}
+	defer ConfigFile.Close()
+
+	ConfigFileBytes, _ := ioutil.ReadAll(ConfigFile)
+
+	err = json.Unmarshal(ConfigFileBytes, &Config)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return Config.Store
+}
+
+func Open(StoreConfig StoreConfig) (Store, error) {
+	switch StoreConfig.Type {
+	case "mongodb":
+		MongoStore, err := OpenMongoStore(StoreConfig)
+		if err != nil {
+			return nil, err
+		}
+		return MongoStore, nil
+	case "bolt":
+		BoltStore, err := OpenBoltStore(StoreConfig)
+		if err != nil {
+			return nil, err
+		}
+		return BoltStore, nil
+	case "", "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Unknown store type: %v", StoreConfig.Type)
+	}
+}
+
+func OpenConfigured(configFile string) Store {
+	Store, err := Open(LoadStoreConfig(configFile))
+	if err != nil {
+		log.Fatalf("Can't open the store: %v", err)
+	}
+	return Store
+}
+
+func OpenConfiguredReadOnly(configFile string) Store {
+	StoreConfig := LoadStoreConfig(configFile)
+	StoreConfig.ReadOnly = true
+	Store, err := Open(StoreConfig)
+	if err != nil {
+		log.Fatalf("Can't open the store: %v", err)
+	}
+	return Store
+}
+
+func NewRun(RunID string, Inventory string, ServiceName string, InstanceKey string) RunMetaData {
+	return RunMetaData{RunID: RunID, Timestamp: time.Now().UTC(), Inventory: Inventory, ServiceName: ServiceName, InstanceKey: InstanceKey}
+}
+
+func NewRecord(Run RunMetaData, DeviceName string, src interface{}) (Record, error) {
+	Data, err := json.Marshal(src)
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{
+		RunID:       Run.RunID,
+		Timestamp:   Run.Timestamp,
+		Inventory:   Run.Inventory,
+		ServiceName: Run.ServiceName,
+		InstanceKey: Run.InstanceKey,
+		DeviceName:  DeviceName,
+		Data:        string(Data),
+	}, nil
+}
+
+func FindRun(Store Store, RunID string) (RunMetaData, error) {
+	Runs, err := Store.ListRuns(Query{RunID: RunID})
+	if err != nil {
+		return RunMetaData{}, err
+	}
+	if len(Runs) == 0 {
+		return RunMetaData{}, fmt.Errorf("Run %v is not in the store", RunID)
+	}
+	return Runs[0], nil
+}
+
+func SaveRawDataDB(Store Store, Run RunMetaData, RawDataDB m.RawDataDB) error {
+	Records := make([]Record, 0)
+	for _, v := range RawDataDB {
+		Record, err := NewRecord(Run, v.DeviceName, v.DMEChunkMap)
+		if err != nil {
+			return err
+		}
+		Records = append(Records, Record)
+	}
+	return Store.SaveRecords(RawDataCollection, Records)
+}
+
+func SaveProcessedData(Store Store, Run RunMetaData, ProcessedData m.ProcessedData) error {
+	Run.VPCPairs = ProcessedData.VPCPairs
+	if err := Store.SaveRun(Run); err != nil {
+		return err
+	}
+
+	ServiceDataRecords := make([]Record, 0)
+	OperDataRecords := make([]Record, 0)
+	for _, v := range ProcessedData.ServiceDataDB {
+		Record, err := NewRecord(Run, v.DeviceName, v.DeviceData)
+		if err != nil {
+			return err
+		}
+		ServiceDataRecords = append(ServiceDataRecords, Record)
+		if len(v.OperData) == 0 && !v.Offline {
+			continue
+		}
+		Record, err = NewRecord(Run, v.DeviceName, OperState{OperData: v.OperData, Offline: v.Offline})
+		if err != nil {
+			return err
+		}
+		OperDataRecords = append(OperDataRecords, Record)
+	}
+	if err := Store.SaveRecords(ServiceDataCollection, ServiceDataRecords); err != nil {
+		return err
+	}
+	if err := Store.SaveRecords(OperDataCollection, OperDataRecords); err != nil {
+		return err
+	}
+
+	ServiceLayoutRecords := make([]Record, 0)
+	for _, v := range ProcessedData.ServiceLayoutDB {
+		Record, err := NewRecord(Run, v.DeviceName, v.ServiceLayout)
+		if err != nil {
+			return err
+		}
+		ServiceLayoutRecords = append(ServiceLayoutRecords, Record)
+	}
+	return Store.SaveRecords(ServiceLayoutCollection, ServiceLayoutRecords)
+}
+
+// SaveTemplatedData replaces the templated data of the run and keeps the
+// AddOptions it was templated with on the run, so it renders the same later.
+func SaveTemplatedData(Store Store, Run RunMetaData, TemplatedData m.ProcessedData, AddOptions []string) error {
+	if Stored, err := FindRun(Store, Run.RunID); err == nil {
+		Run.VPCPairs = Stored.VPCPairs
+	}
+	Run.AddOptions = AddOptions
+	if err := Store.SaveRun(Run); err != nil {
+		return err
+	}
+	Records := make([]Record, 0)
+	for _, v := range TemplatedData.ServiceDataDB {
+		Record, err := NewRecord(Run, v.DeviceName, v.DeviceData)
+		if err != nil {
+			return err
+		}
+		Records = append(Records, Record)
+	}
+	return Store.ReplaceRecords(TemplatedDataCollection, Run.RunID, Records)
+}
+
+func LoadRawDataDB(Store Store, Query Query) (m.RawDataDB, error) {
+	RawDataDB := make(m.RawDataDB, 0)
+	Records, err := Store.FindRecords(RawDataCollection, Query)
+	if err != nil {
+		return RawDataDB, err
+	}
+	for _, Record := range Records {
+		var RawDataDBEntry m.RawDataDBEntry
+		RawDataDBEntry.DeviceName = Record.DeviceName
+		if err := json.Unmarshal([]byte(Record.Data), &RawDataDBEntry.DMEChunkMap); err != nil {
+			return RawDataDB, err
+		}
+		RawDataDB = append(RawDataDB, RawDataDBEntry)
+	}
+	return RawDataDB, nil
+}
+
+func LoadProcessedData(Store Store, Query Query) (m.ProcessedData, error) {
+	return loadServiceData(Store, ServiceDataCollection, Query)
+}
+
+func LoadTemplatedData(Store Store, Query Query) (m.ProcessedData, error) {
+	return loadServiceData(Store, TemplatedDataCollection, Query)
+}
+
+func loadServiceData(Store Store, Collection string, Query Query) (m.ProcessedData, error) {
+	var ProcessedData m.ProcessedData
+	ProcessedData.ServiceDataDB = make(m.ServiceDataDB, 0)
+	ProcessedData.ServiceLayoutDB = make(m.ServiceLayoutDB, 0)
+
+	if Query.RunID == "" {
+		return ProcessedData, errors.New("Run ID is required to load service data")
+	}
+	Run, err := FindRun(Store, Query.RunID)
+	if err != nil {
+		return ProcessedData, err
+	}
+	ProcessedData.ServiceName = Run.ServiceName
+	ProcessedData.VPCPairs = Run.VPCPairs
+
+	OperStates := make(map[string]OperState)
+	if Collection == ServiceDataCollection {
+		Records, err := Store.FindRecords(OperDataCollection, Query)
+		if err != nil {
+			return ProcessedData, err
+		}
+		for _, Record := range Records {
+			var OperState OperState
+			if err := json.Unmarshal([]byte(Record.Data), &OperState); err != nil {
+				return ProcessedData, err
+			}
+			OperStates[Record.DeviceName] = OperState
+		}
+	}
+
+	Records, err := Store.FindRecords(Collection, Query)
+	if err != nil {
+		return ProcessedData, err
+	}
+	for _, Record := range Records {
+		var ServiceDataDBEntry m.ServiceDataDBEntry
+		ServiceDataDBEntry.DeviceName = Record.DeviceName
+		if err := json.Unmarshal([]byte(Record.Data), &ServiceDataDBEntry.DeviceData); err != nil {
+			return ProcessedData, err
+		}
+		ServiceDataDBEntry.OperData = OperStates[Record.DeviceName].OperData
+		ServiceDataDBEntry.Offline = OperStates[Record.DeviceName].Offline
+		ProcessedData.ServiceDataDB = append(ProcessedData.ServiceDataDB, ServiceDataDBEntry)
+	}
+
+	Records, err = Store.FindRecords(ServiceLayoutCollection, Query)
+	if err != nil {
+		return ProcessedData, err
+	}
+	for _, Record := range Records {
+		var ServiceLayoutDBEntry m.ServiceLayoutDBEntry
+		ServiceLayoutDBEntry.DeviceName = Record.DeviceName
+		if err := json.Unmarshal([]byte(Record.Data), &ServiceLayoutDBEntry.ServiceLayout); err != nil {
+			return ProcessedData, err
+		}
+		ProcessedData.ServiceLayoutDB = append(ProcessedData.ServiceLayoutDB, ServiceLayoutDBEntry)
+	}
+
+	return ProcessedData, nil
+}
@@ -0,0 +1,228 @@
+package storing
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const MongoTimeout = 30 * time.Second
+
+type MongoStore struct {
+	Client   *mongo.Client
+	Database *mongo.Database
+}
+
+// MongoRecord keeps the record data as a BSON document instead of a JSON
+// string, so the device data and the layout can be queried in place.
+type MongoRecord struct {
+	Record `bson:",inline"`
+	Data   interface{} `bson:"Data"`
+}
+
+func NewMongoRecord(Record Record) (MongoRecord, error) {
+	MongoRecord := MongoRecord{Record: Record}
+	if err := json.Unmarshal([]byte(Record.Data), &MongoRecord.Data); err != nil {
+		return MongoRecord, err
+	}
+	return MongoRecord, nil
+}
+
+func (r MongoRecord) ToRecord() (Record, error) {
+	Data, err := json.Marshal(FromBSONValue(r.Data))
+	if err != nil {
+		return r.Record, err
+	}
+	r.Record.Data = string(Data)
+	return r.Record, nil
+}
+
+// FromBSONValue turns the documents and arrays the driver decodes into plain
+// maps and slices, which encode to JSON as they were saved.
+func FromBSONValue(v interface{}) interface{} {
+	switch Value := v.(type) {
+	case primitive.D:
+		Document := make(map[string]interface{})
+		for _, Element := range Value {
+			Document[Element.Key] = FromBSONValue(Element.Value)
+		}
+		return Document
+	case primitive.M:
+		Document := make(map[string]interface{})
+		for Key, Element := range Value {
+			Document[Key] = FromBSONValue(Element)
+		}
+		return Document
+	case primitive.A:
+		Array := make([]interface{}, 0)
+		for _, Element := range Value {
+			Array = append(Array, FromBSONValue(Element))
+		}
+		return Array
+	default:
+		return Value
+	}
+}
+
+func OpenMongoStore(StoreConfig StoreConfig) (*MongoStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), MongoTimeout)
+	defer cancel()
+
+	Client, err := mongo.Connect(ctx, options.Client().ApplyURI(StoreConfig.URI))
+	if err != nil {
+		return nil, err
+	}
+	if err := Client.Ping(ctx, readpref.Primary()); err != nil {
+		return nil, err
+	}
+
+	MongoStore := &MongoStore{Client: Client, Database: Client.Database(StoreConfig.Database)}
+	if err := MongoStore.CreateIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	return MongoStore, nil
+}
+
+func (s *MongoStore) CreateIndexes(ctx context.Context) error {
+	RecordIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "RunID", Value: 1}, {Key: "DeviceName", Value: 1}}},
+		{Keys: bson.D{{Key: "DeviceName", Value: 1}, {Key: "Timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "ServiceName", Value: 1}, {Key: "InstanceKey", Value: 1}, {Key: "Timestamp", Value: -1}}},
+	}
+	for _, Collection := range []string{RawDataCollection, ServiceDataCollection, ServiceLayoutCollection, TemplatedDataCollection, OperDataCollection} {
+		if _, err := s.Database.Collection(Collection).Indexes().CreateMany(ctx, RecordIndexes); err != nil {
+			return err
+		}
+	}
+
+	RunIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "RunID", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "ServiceName", Value: 1}, {Key: "InstanceKey", Value: 1}, {Key: "Timestamp", Value: -1}}},
+	}
+	_, err := s.Database.Collection(RunsCollection).Indexes().CreateMany(ctx, RunIndexes)
+	return err
+}
+
+func MongoFilter(Query Query) bson.D {
+	Filter := bson.D{}
+	if Query.RunID != "" {
+		Filter = append(Filter, bson.E{Key: "RunID", Value: Query.RunID})
+	}
+	if Query.ServiceName != "" {
+		Filter = append(Filter, bson.E{Key: "ServiceName", Value: Query.ServiceName})
+	}
+	if Query.InstanceKey != "" {
+		Filter = append(Filter, bson.E{Key: "InstanceKey", Value: Query.InstanceKey})
+	}
+	if Query.DeviceName != "" {
+		Filter = append(Filter, bson.E{Key: "DeviceName", Value: Query.DeviceName})
+	}
+	TimeRange := bson.D{}
+	if !Query.From.IsZero() {
+		TimeRange = append(TimeRange, bson.E{Key: "$gte", Value: Query.From})
+	}
+	if !Query.To.IsZero() {
+		TimeRange = append(TimeRange, bson.E{Key: "$lte", Value: Query.To})
+	}
+	if len(TimeRange) > 0 {
+		Filter = append(Filter, bson.E{Key: "Timestamp", Value: TimeRange})
+	}
+	return Filter
+}
+
+func (s *MongoStore) SaveRun(Run RunMetaData) error {
+	ctx, cancel := context.WithTimeout(context.Background(), MongoTimeout)
+	defer cancel()
+
+	_, err := s.Database.Collection(RunsCollection).ReplaceOne(ctx, bson.D{{Key: "RunID", Value: Run.RunID}}, Run, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) SaveRecords(Collection string, Records []Record) error {
+	if len(Records) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), MongoTimeout)
+	defer cancel()
+
+	Documents := make([]interface{}, 0)
+	for _, Record := range Records {
+		MongoRecord, err := NewMongoRecord(Record)
+		if err != nil {
+			return err
+		}
+		Documents = append(Documents, MongoRecord)
+	}
+	_, err := s.Database.Collection(Collection).InsertMany(ctx, Documents)
+	return err
+}
+
+func (s *MongoStore) ReplaceRecords(Collection string, RunID string, Records []Record) error {
+	ctx, cancel := context.WithTimeout(context.Background(), MongoTimeout)
+	defer cancel()
+
+	if _, err := s.Database.Collection(Collection).DeleteMany(ctx, bson.D{{Key: "RunID", Value: RunID}}); err != nil {
+		return err
+	}
+	return s.SaveRecords(Collection, Records)
+}
+
+func (s *MongoStore) FindRecords(Collection string, Query Query) ([]Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), MongoTimeout)
+	defer cancel()
+
+	Records := make([]Record, 0)
+	FindOptions := options.Find().SetSort(bson.D{{Key: "Timestamp", Value: 1}, {Key: "DeviceName", Value: 1}})
+	Cursor, err := s.Database.Collection(Collection).Find(ctx, MongoFilter(Query), FindOptions)
+	if err != nil {
+		return Records, err
+	}
+	MongoRecords := make([]MongoRecord, 0)
+	if err := Cursor.All(ctx, &MongoRecords); err != nil {
+		return Records, err
+	}
+	for _, MongoRecord := range MongoRecords {
+		Record, err := MongoRecord.ToRecord()
+		if err != nil {
+			return Records, err
+		}
+		Records = append(Records, Record)
+	}
+	return Records, nil
+}
+
+func (s *MongoStore) ListRuns(Query Query) ([]RunMetaData, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), MongoTimeout)
+	defer cancel()
+
+	Runs := make([]RunMetaData, 0)
+	Filter := MongoFilter(Query)
+	if Query.DeviceName != "" {
+		RunIDs, err := s.Database.Collection(ServiceDataCollection).Distinct(ctx, "RunID", Filter)
+		if err != nil {
+			return Runs, err
+		}
+		Filter = bson.D{{Key: "RunID", Value: bson.D{{Key: "$in", Value: RunIDs}}}}
+	}
+	FindOptions := options.Find().SetSort(bson.D{{Key: "Timestamp", Value: 1}})
+	Cursor, err := s.Database.Collection(RunsCollection).Find(ctx, Filter, FindOptions)
+	if err != nil {
+		return Runs, err
+	}
+	err = Cursor.All(ctx, &Runs)
+	return Runs, err
+}
+
+func (s *MongoStore) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), MongoTimeout)
+	defer cancel()
+
+	return s.Client.Disconnect(ctx)
+}
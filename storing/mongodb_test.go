@@ -0,0 +1,152 @@
+package storing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	m "n9k-modeling/modeling"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMongoRecordDocument(t *testing.T) {
+	Run := NewRun("run-1", "inventory.json", "VNI", "10100")
+	Record, err := NewRecord(Run, "leaf1", m.ServiceLayout{{Name: "AGW", Value: true, Oper: "up"}})
+	if err != nil {
+		t.Fatalf("Can't create a record: %v", err)
+	}
+	Converted, err := NewMongoRecord(Record)
+	if err != nil {
+		t.Fatalf("Can't convert the record: %v", err)
+	}
+	Document, err := bson.Marshal(Converted)
+	if err != nil {
+		t.Fatalf("Can't marshal the record: %v", err)
+	}
+
+	if Type := bson.Raw(Document).Lookup("Data").Type; Type != bson.TypeArray {
+		t.Errorf("Data is stored as %v, expected an array", Type)
+	}
+	if Name := bson.Raw(Document).Lookup("Data", "0", "Name").StringValue(); Name != "AGW" {
+		t.Errorf("Layout component is stored as %v, expected AGW", Name)
+	}
+
+	var Decoded MongoRecord
+	if err := bson.Unmarshal(Document, &Decoded); err != nil {
+		t.Fatalf("Can't unmarshal the record: %v", err)
+	}
+	Loaded, err := Decoded.ToRecord()
+	if err != nil {
+		t.Fatalf("Can't convert the record back: %v", err)
+	}
+	var ServiceLayout m.ServiceLayout
+	if err := json.Unmarshal([]byte(Loaded.Data), &ServiceLayout); err != nil || len(ServiceLayout) != 1 || ServiceLayout[0] != (m.ComponentBitMap{Name: "AGW", Value: true, Oper: "up"}) {
+		t.Errorf("Layout %v is loaded as %v: %v", Record.Data, Loaded.Data, err)
+	}
+	if Loaded.RunID != "run-1" || Loaded.DeviceName != "leaf1" || Loaded.ServiceName != "VNI" || Loaded.InstanceKey != "10100" {
+		t.Errorf("Record %+v is loaded as %+v", Record, Loaded)
+	}
+}
+
+// TestMongoStore runs against the mongod of MONGODB_URI in a database of its
+// own, which it drops when it is done.
+func TestMongoStore(t *testing.T) {
+	URI := os.Getenv("MONGODB_URI")
+	if URI == "" {
+		t.Skip("MONGODB_URI is not set")
+	}
+	Database := fmt.Sprintf("n9k-modeling-test-%v", time.Now().UnixNano())
+	Store, err := OpenMongoStore(StoreConfig{Type: "mongodb", URI: URI, Database: Database})
+	if err != nil {
+		t.Fatalf("Can't open the store: %v", err)
+	}
+	defer Store.Close()
+	defer Store.Database.Drop(context.Background())
+
+	Run := NewRun("run-1", "inventory.json", "VNI", "10100")
+	ProcessedData := m.ProcessedData{
+		ServiceName: "VNI",
+		ServiceDataDB: m.ServiceDataDB{
+			{DeviceName: "leaf1", DeviceData: m.DeviceData{"vnid": float64(10100), "l2BD.id": float64(100)}, OperData: m.DeviceData{"TABLE_nve_vni.vni-state": "Up"}},
+			{DeviceName: "leaf2", DeviceData: m.DeviceData{"vnid": float64(10100), "l2BD.id": float64(100)}, Offline: true},
+		},
+		ServiceLayoutDB: m.ServiceLayoutDB{
+			{DeviceName: "leaf1", ServiceLayout: m.ServiceLayout{{Name: "L2VNI", Value: true}, {Name: "AGW", Value: true}}},
+			{DeviceName: "leaf2", ServiceLayout: m.ServiceLayout{{Name: "L2VNI", Value: true}, {Name: "AGW", Value: false}}},
+		},
+		VPCPairs: []m.VPCPair{{DomainID: "10", Devices: []string{"leaf1", "leaf2"}, Keepalive: []string{"10.1.1.1", "10.1.1.2"}}},
+	}
+	if err := SaveProcessedData(Store, Run, ProcessedData); err != nil {
+		t.Fatalf("Can't save processed data: %v", err)
+	}
+	if err := SaveProcessedData(Store, NewRun("run-2", "inventory.json", "VNI", "10200"), ProcessedData); err != nil {
+		t.Fatalf("Can't save processed data: %v", err)
+	}
+
+	Records, err := Store.FindRecords(ServiceDataCollection, Query{DeviceName: "leaf2"})
+	if err != nil || len(Records) != 2 {
+		t.Errorf("Unexpected records for leaf2: %+v %v", Records, err)
+	}
+	Records, err = Store.FindRecords(ServiceDataCollection, Query{ServiceName: "VNI", InstanceKey: "10100"})
+	if err != nil || len(Records) != 2 || Records[0].RunID != "run-1" || Records[0].Data != `{"l2BD.id":100,"vnid":10100}` {
+		t.Errorf("Unexpected records for instance 10100: %+v %v", Records, err)
+	}
+	Loaded, err := LoadProcessedData(Store, Query{RunID: "run-1"})
+	if err != nil || len(Loaded.ServiceDataDB) != 2 || len(Loaded.ServiceLayoutDB) != 2 || Loaded.ServiceLayoutDB[0].ServiceLayout[1].Name != "AGW" {
+		t.Errorf("Unexpected processed data: %+v %v", Loaded, err)
+	} else if Loaded.ServiceDataDB[0].OperData["TABLE_nve_vni.vni-state"] != "Up" || !Loaded.ServiceDataDB[1].Offline || !reflect.DeepEqual(Loaded.VPCPairs, ProcessedData.VPCPairs) {
+		t.Errorf("Oper state and vPC pairs are not loaded: %+v", Loaded)
+	}
+
+	ctx := context.Background()
+	Count, err := Store.Database.Collection(ServiceDataCollection).CountDocuments(ctx, bson.D{{Key: "Data.vnid", Value: 10100}})
+	if err != nil || Count != 4 {
+		t.Errorf("%v device data documents have vnid 10100, 4 are expected: %v", Count, err)
+	}
+	Count, err = Store.Database.Collection(ServiceLayoutCollection).CountDocuments(ctx, bson.D{{Key: "Data", Value: bson.D{{Key: "$elemMatch", Value: bson.D{{Key: "Name", Value: "AGW"}, {Key: "Value", Value: true}}}}}})
+	if err != nil || Count != 2 {
+		t.Errorf("%v layouts have AGW, 2 are expected: %v", Count, err)
+	}
+
+	for _, Templated := range []string{"leaf1", "leaf2"} {
+		TemplatedData := m.ProcessedData{ServiceName: "VNI", ServiceDataDB: m.ServiceDataDB{{DeviceName: Templated, DeviceData: m.DeviceData{"vnid": float64(10100)}}}}
+		if err := SaveTemplatedData(Store, Run, TemplatedData, nil); err != nil {
+			t.Fatalf("Can't save templated data: %v", err)
+		}
+	}
+	Records, err = Store.FindRecords(TemplatedDataCollection, Query{RunID: "run-1"})
+	if err != nil || len(Records) != 1 || Records[0].DeviceName != "leaf2" {
+		t.Errorf("Templated data is not replaced: %+v %v", Records, err)
+	}
+
+	for Collection, Expected := range map[string][]string{
+		ServiceDataCollection: {"RunID_1_DeviceName_1", "DeviceName_1_Timestamp_-1", "ServiceName_1_InstanceKey_1_Timestamp_-1"},
+		RunsCollection:        {"RunID_1", "ServiceName_1_InstanceKey_1_Timestamp_-1"},
+	} {
+		Cursor, err := Store.Database.Collection(Collection).Indexes().List(ctx)
+		if err != nil {
+			t.Fatalf("Can't list the indexes of %v: %v", Collection, err)
+		}
+		Indexes := make([]bson.M, 0)
+		if err := Cursor.All(ctx, &Indexes); err != nil {
+			t.Fatalf("Can't read the indexes of %v: %v", Collection, err)
+		}
+		Names := make(map[string]bson.M)
+		for _, Index := range Indexes {
+			Names[fmt.Sprint(Index["name"])] = Index
+		}
+		for _, Name := range Expected {
+			if _, ok := Names[Name]; !ok {
+				t.Errorf("Collection %v has no index %v: %v", Collection, Name, Indexes)
+			}
+		}
+		if Collection == RunsCollection && Names["RunID_1"]["unique"] != true {
+			t.Errorf("Run ID index is not unique: %v", Names["RunID_1"])
+		}
+	}
+}
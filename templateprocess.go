@@ -2,7 +2,9 @@ package main
 
 import (
 	"flag"
+	"log"
 	m "n9k-modeling/modeling"
+	s "n9k-modeling/storing"
 	t "n9k-modeling/templating"
 )
 
@@ -10,6 +12,8 @@ func main() {
 	varsFile := flag.String("varsFile", "00000", "file contains all the required variables definition to construct the service template")
 	InputFile := flag.String("in", "00000", "file contains modeled actual data from devices")
 	OutputFile := flag.String("out", "00000", "file to write the result in")
+	RunID := flag.String("run", "", "stored run to read the modeled data from instead of the input file")
+	srcVal := flag.String("key", "", "service instance key to commit the templated data under in the state repository, required there without -run")
 	flag.Parse()
 
 	TemplateData := t.LoadTemplateData(*varsFile)
@@ -18,13 +22,58 @@ func main() {
 
 	var TemplatedData m.ProcessedData
 
-	ProcessedData := t.LoadProcessedData(*InputFile)
+	Store := s.OpenConfigured("config.json")
+	if Store != nil {
+		defer Store.Close()
+	} else if *RunID != "" {
+		log.Fatalf("No store is configured to read run %v from", *RunID)
+	}
+
+	StateRepository := s.OpenConfiguredStateRepository("config.json")
+	if StateRepository != nil && *RunID == "" && *srcVal == "" {
+		log.Fatalf("Service instance key is required to commit templated data without a stored run")
+	}
+
+	var ProcessedData m.ProcessedData
+	if *RunID != "" {
+		var err error
+		ProcessedData, err = s.LoadProcessedData(Store, s.Query{RunID: *RunID})
+		if err != nil {
+			log.Fatalf("Can't load run %v: %v", *RunID, err)
+		}
+	} else {
+		ProcessedData = t.LoadProcessedData(*InputFile)
+	}
+	m.SortProcessedData(&ProcessedData)
 	TemplatedData.ServiceName = ProcessedData.ServiceName
 	TemplatedData.ServiceLayoutDB = ProcessedData.ServiceLayoutDB
 	TemplatedData.ServiceDataDB = make([]m.ServiceDataDBEntry, 0)
-	AddOptions := t.LoadAddOptions(ProcessedData, TemplateData.AddOptions)
+	AddOptions := t.LoadAddOptions(ProcessedData, t.OptionKeys(TemplateData))
 
 	t.TemplateConstruct(ProcessedData, &TemplatedData, AddOptions, TemplateDataMap, TemplateComponentsMap)
+	if TemplateData.PairWise {
+		if err := t.CheckPairWise(&TemplatedData, ProcessedData.VPCPairs); err != nil {
+			log.Fatalf("Can't template the service pair-wise: %v", err)
+		}
+	}
+	Run := s.NewRun(m.NewRunID(), "", TemplatedData.ServiceName, *srcVal)
+	if *RunID != "" {
+		StoredRun, err := s.FindRun(Store, *RunID)
+		if err == nil {
+			Run = StoredRun
+			err = s.SaveTemplatedData(Store, Run, TemplatedData, TemplateData.AddOptions)
+		}
+		if err != nil {
+			log.Println("Can't store templated data:", err)
+		}
+	}
+
+	if StateRepository != nil {
+		if err := StateRepository.CommitTemplatedData(Run, TemplatedData); err != nil {
+			log.Println("Can't commit templated data to the state repository:", err)
+		}
+	}
+
 	MarshalledTemplatedData := m.MarshalToJSON(TemplatedData)
 	m.WriteDataToFile(*OutputFile, MarshalledTemplatedData)
 }
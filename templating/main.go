@@ -16,7 +16,9 @@ type VariablesDB struct {
 		VariableName  string      `json:"VariableName"`
 		VariableValue interface{} `json:"VariableValue"`
 	} `json:"ServiceVariables"`
-	AddOptions []string `json:"AddOptions"`
+	AddOptions   []string `json:"AddOptions"`
+	MergeOptions []string `json:"MergeOptions"`
+	PairWise     bool     `json:"PairWise"`
 }
 
 func LoadTemplateData(fileName string) VariablesDB {
@@ -53,15 +55,38 @@ type TemplateComponentsDBEntry map[string]fn
 func LoadTemplateComponentsMap() TemplateComponentsDB {
 	TemplateComponentsDB := make(TemplateComponentsDB)
 
-	TemplateComponentsDBEntry := make(TemplateComponentsDBEntry)
-	TemplateComponentsDBEntry["L2VNI"] = MakeL2VNITemplate
-	TemplateComponentsDBEntry["AGW"] = MakeAGWTemplate
-	TemplateComponentsDBEntry["PIM"] = MakePIMTemplate
-	TemplateComponentsDBEntry["IR"] = MakeIRTemplate
-	TemplateComponentsDBEntry["MS-IR"] = MakeMSIRTemplate
-	TemplateComponentsDBEntry["ARP-Suppress"] = MakeARPSuppressTemplate
+	VNIComponents := make(TemplateComponentsDBEntry)
+	VNIComponents["L2VNI"] = MakeL2VNITemplate
+	VNIComponents["AGW"] = MakeAGWTemplate
+	VNIComponents["PIM"] = MakePIMTemplate
+	VNIComponents["IR"] = MakeIRTemplate
+	VNIComponents["MS-IR"] = MakeMSIRTemplate
+	VNIComponents["ARP-Suppress"] = MakeARPSuppressTemplate
+	VNIComponents["Leaf"] = MakeLeafTemplate
+	VNIComponents["BGW"] = MakeBGWTemplate
+	VNIComponents["DCI-Tracking"] = MakeTrackingTemplate
+	VNIComponents["Fabric-Tracking"] = MakeTrackingTemplate
 
-	TemplateComponentsDB["VNI"] = TemplateComponentsDBEntry
+	TemplateComponentsDB["VNI"] = VNIComponents
+
+	VRFComponents := make(TemplateComponentsDBEntry)
+	VRFComponents["L3VNI"] = MakeL3VNITemplate
+	VRFComponents["RT-Auto"] = MakeRTAutoTemplate
+	VRFComponents["Advertise-PIP"] = MakeAdvertisePIPTemplate
+	VRFComponents["BGW"] = MakeBGWTemplate
+
+	TemplateComponentsDB["VRF"] = VRFComponents
+
+	AccessPortComponents := make(TemplateComponentsDBEntry)
+	AccessPortComponents["Access"] = MakeAccessTemplate
+	AccessPortComponents["Trunk"] = MakeTrunkTemplate
+	AccessPortComponents["Port-Channel"] = MakePortChannelTemplate
+	AccessPortComponents["PC-Access"] = MakePCAccessTemplate
+	AccessPortComponents["PC-Trunk"] = MakePCTrunkTemplate
+	AccessPortComponents["LACP"] = MakeLACPTemplate
+	AccessPortComponents["vPC"] = MakeVPCTemplate
+
+	TemplateComponentsDB["AccessPort"] = AccessPortComponents
 
 	return TemplateComponentsDB
 }
@@ -70,6 +95,7 @@ func MakeL2VNITemplate(M map[string]interface{}, VariablesMap map[string]interfa
 	M["vnid"], _ = strconv.ParseInt(VariablesMap["VNID"].(string), 10, 64)
 	M["l2BD.accEncap"] = "vxlan-" + VariablesMap["VNID"].(string)
 	M["l2BD.id"], _ = strconv.ParseInt(VariablesMap["VNID"].(string)[3:], 10, 64)
+	M["l2BD.fabEncap"] = "vlan-" + strconv.FormatInt(M["l2BD.id"].(int64), 10)
 	M["l2BD.name"] = VariablesMap["Segment"].(string) + VariablesMap["ZoneID"].(string) + "Z_" + VariablesMap["Subnet"].(string) + "/" + VariablesMap["Mask"].(string)
 	M["rtctrlRttEntry.rtt.export"] = "route-target:as2-nn4:" + strconv.FormatInt(int64(AddOptionsDB[DeviceName]["bgpInst.asn"].(float64)), 10) + ":" + VariablesMap["VNID"].(string)
 	M["rtctrlRttEntry.rtt.import"] = "route-target:as2-nn4:" + strconv.FormatInt(int64(AddOptionsDB[DeviceName]["bgpInst.asn"].(float64)), 10) + ":" + VariablesMap["VNID"].(string)
@@ -100,13 +126,112 @@ func MakePIMTemplate(M map[string]interface{}, VariablesMap map[string]interface
 }
 
 func MakeMSIRTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
-	M["nvoNw.multisiteIngRepl"] = "enable"
+	if _, ok := AddOptionsDB[DeviceName]["nvoEvpnMultisiteBordergw.siteId"]; ok {
+		M["nvoNw.multisiteIngRepl"] = "enable"
+	} else {
+		M["nvoNw.multisiteIngRepl"] = "disable"
+	}
+}
+
+func MakeLeafTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+}
+
+func MakeTrackingTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
 }
 
 func MakeARPSuppressTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
 	M["nvoNw.suppressARP"] = "enabled"
 }
 
+func MakeL3VNITemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["vnid"], _ = strconv.ParseInt(VariablesMap["VNID"].(string), 10, 64)
+	M["l3Inst.name"] = VariablesMap["VRFName"].(string)
+	M["l3Inst.encap"] = "vxlan-" + VariablesMap["VNID"].(string)
+	M["rtctrlDom.rd"] = "rd:unknown:0:0"
+	M["rtctrlRttEntry.rtt.export"] = "route-target:as2-nn4:" + strconv.FormatInt(int64(AddOptionsDB[DeviceName]["bgpInst.asn"].(float64)), 10) + ":" + VariablesMap["VNID"].(string)
+	M["rtctrlRttEntry.rtt.import"] = "route-target:as2-nn4:" + strconv.FormatInt(int64(AddOptionsDB[DeviceName]["bgpInst.asn"].(float64)), 10) + ":" + VariablesMap["VNID"].(string)
+	M["bgpInst.asn"] = AddOptionsDB[DeviceName]["bgpInst.asn"]
+	M["bgpDomAf.type.ipv4-ucast"] = "ipv4-ucast"
+	M["l2BD.id"], _ = strconv.ParseInt(VariablesMap["VLAN"].(string), 10, 64)
+	M["l2BD.fabEncap"] = "vlan-" + VariablesMap["VLAN"].(string)
+	M["l2BD.accEncap"] = "vxlan-" + VariablesMap["VNID"].(string)
+	M["l2BD.name"] = VariablesMap["VRFName"].(string) + "_L3VNI"
+	M["sviIf.id"] = "vlan" + VariablesMap["VLAN"].(string)
+	M["sviIf.adminSt"] = "up"
+	M["nwRtVrfMbr.tDn"] = "sys/inst-" + VariablesMap["VRFName"].(string)
+	M["ipv4If.forward"] = "enabled"
+	M["ipv4Dom.name"] = VariablesMap["VRFName"].(string)
+	M["nvoNw.vni"], _ = strconv.ParseInt(VariablesMap["VNID"].(string), 10, 64)
+	M["nvoNw.associateVrfFlag"] = "yes"
+}
+
+func MakeRTAutoTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["rtctrlRttEntry.rtt.export"] = "route-target:unknown:0:0"
+	M["rtctrlRttEntry.rtt.import"] = "route-target:unknown:0:0"
+}
+
+func MakeAdvertisePIPTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["bgpDomAf.advPip.l2vpn-evpn"] = "enabled"
+	M["nvoEp.advertiseVmac"] = "yes"
+}
+
+func MakeBGWTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["nvoEvpnMultisiteBordergw.siteId"] = AddOptionsDB[DeviceName]["nvoEvpnMultisiteBordergw.siteId"]
+}
+
+func AddVLANToList(List interface{}, VLAN string) string {
+	VLANID, _ := strconv.Atoi(VLAN)
+	if List == nil {
+		return m.FormatVLANList([]int{VLANID})
+	}
+	return m.FormatVLANList(append(m.ParseVLANList(List), VLANID))
+}
+
+func MakeAccessTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["l1PhysIf.id"] = AddOptionsDB[DeviceName]["l1PhysIf.id"]
+	M["l1PhysIf.mode"] = "access"
+	M["l1PhysIf.accessVlan"] = "vlan-" + VariablesMap["VLAN"].(string)
+}
+
+func MakeTrunkTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["l1PhysIf.id"] = AddOptionsDB[DeviceName]["l1PhysIf.id"]
+	M["l1PhysIf.mode"] = "trunk"
+	if _, ok := AddOptionsDB[DeviceName]["pcAggrIf.id"]; ok {
+		M["l1PhysIf.trunkVlans"] = AddOptionsDB[DeviceName]["l1PhysIf.trunkVlans"]
+	} else {
+		M["l1PhysIf.trunkVlans"] = AddVLANToList(AddOptionsDB[DeviceName]["l1PhysIf.trunkVlans"], VariablesMap["VLAN"].(string))
+	}
+}
+
+func MakePortChannelTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["pcAggrIf.id"] = AddOptionsDB[DeviceName]["pcAggrIf.id"]
+}
+
+func MakePCAccessTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["pcAggrIf.mode"] = "access"
+	M["pcAggrIf.accessVlan"] = "vlan-" + VariablesMap["VLAN"].(string)
+}
+
+func MakePCTrunkTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["pcAggrIf.mode"] = "trunk"
+	M["pcAggrIf.trunkVlans"] = AddVLANToList(AddOptionsDB[DeviceName]["pcAggrIf.trunkVlans"], VariablesMap["VLAN"].(string))
+}
+
+func MakeLACPTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["pcAggrIf.pcMode"] = AddOptionsDB[DeviceName]["pcAggrIf.pcMode"]
+}
+
+func MakeVPCTemplate(M map[string]interface{}, VariablesMap map[string]interface{}, AddOptionsDB AddOptionsDB, DeviceName string) {
+	M["vpcIf.id"] = AddOptionsDB[DeviceName]["vpcIf.id"]
+	M["vpcDom.id"] = AddOptionsDB[DeviceName]["vpcDom.id"]
+}
+
+func OptionKeys(VariablesDB VariablesDB) []string {
+	OptionKeys := make([]string, 0)
+	OptionKeys = append(OptionKeys, VariablesDB.AddOptions...)
+	return append(OptionKeys, VariablesDB.MergeOptions...)
+}
+
 type AddOptionsDB map[string]AddOptionsDBEntry
 type AddOptionsDBEntry map[string]interface{}
 
@@ -151,6 +276,34 @@ func LoadProcessedData(fineName string) m.ProcessedData {
 	return ProcessedData
 }
 
+func CheckPairWise(TemplatedData *m.ProcessedData, VPCPairs []m.VPCPair) error {
+	Templated := make(map[string]bool)
+	for _, Device := range TemplatedData.ServiceDataDB {
+		if len(Device.DeviceData) > 0 {
+			Templated[Device.DeviceName] = true
+		}
+	}
+	Layouts := make(map[string]string)
+	for _, Device := range TemplatedData.ServiceLayoutDB {
+		for _, Component := range Device.ServiceLayout {
+			if Component.Value {
+				Layouts[Device.DeviceName] += Component.Name + ","
+			}
+		}
+	}
+	for _, VPCPair := range VPCPairs {
+		a, b := VPCPair.Devices[0], VPCPair.Devices[1]
+		if Templated[a] != Templated[b] {
+			return fmt.Errorf("vPC peers %v and %v must be deployed together, only one of them is templated", a, b)
+		}
+		if Templated[a] && Layouts[a] != Layouts[b] {
+			return fmt.Errorf("vPC peers %v and %v have different service layouts", a, b)
+		}
+	}
+	TemplatedData.VPCPairs = VPCPairs
+	return nil
+}
+
 func TemplateConstruct(ProcessedData m.ProcessedData, TemplatedData *m.ProcessedData, AddOptions AddOptionsDB, TemplateDataMap map[string]interface{}, TemplateComponentsMap TemplateComponentsDB) {
 	for _, Device := range ProcessedData.ServiceLayoutDB {
 		var ServiceDataDBEntry m.ServiceDataDBEntry
@@ -158,7 +311,12 @@ func TemplateConstruct(ProcessedData m.ProcessedData, TemplatedData *m.Processed
 		ServiceDataDBEntry.DeviceData = make(map[string]interface{})
 		for _, Component := range Device.ServiceLayout {
 			if Component.Value == true {
-				TemplateComponentsMap[TemplatedData.ServiceName][Component.Name](ServiceDataDBEntry.DeviceData, TemplateDataMap, AddOptions, ServiceDataDBEntry.DeviceName)
+				MakeTemplate, ok := TemplateComponentsMap[TemplatedData.ServiceName][Component.Name]
+				if !ok {
+					log.Println("No template for component", Component.Name, "of service", TemplatedData.ServiceName)
+					continue
+				}
+				MakeTemplate(ServiceDataDBEntry.DeviceData, TemplateDataMap, AddOptions, ServiceDataDBEntry.DeviceName)
 			}
 		}
 		TemplatedData.ServiceDataDB = append(TemplatedData.ServiceDataDB, ServiceDataDBEntry)